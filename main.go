@@ -3,9 +3,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/rancher/webhook/pkg/replay"
 	"github.com/rancher/webhook/pkg/server"
 	_ "github.com/rancher/wrangler/v3/pkg/generated/controllers/admissionregistration.k8s.io"
 	"github.com/rancher/wrangler/v3/pkg/k8scheck"
@@ -27,6 +30,10 @@ func main() {
 }
 
 func run() error {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		return runReplay(os.Args[2:])
+	}
+
 	if os.Getenv("CATTLE_DEBUG") == "true" || os.Getenv("RANCHER_DEBUG") == "true" {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
@@ -50,10 +57,39 @@ func run() error {
 		return err
 	}
 
-	if err := server.ListenAndServe(ctx, cfg, os.Getenv("ENABLE_MCM") != "false"); err != nil {
+	return server.ListenAndServe(ctx, cfg, os.Getenv("ENABLE_MCM") != "false")
+}
+
+// runReplay runs the replay subcommand, which evaluates captured AdmissionReviews offline.
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [flags] REVIEW_FILE_OR_DIR...\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Runs captured AdmissionReview JSON files through the webhook handlers without an apiserver.")
+		flags.PrintDefaults()
+	}
+	fixturesPath := flags.String("fixtures", "", "YAML file of the cluster state (RoleTemplates, GlobalRoles, bindings, Clusters, Settings...) used to fill the caches")
+	mcmEnabled := flags.Bool("mcm", true, "replay with the handlers used when multi-cluster management is enabled")
+	if err := flags.Parse(args); err != nil {
 		return err
 	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no review files given")
+	}
 
-	<-ctx.Done()
-	return nil
+	var fixtures io.Reader
+	if *fixturesPath != "" {
+		file, err := os.Open(*fixturesPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		fixtures = file
+	}
+	replayer, err := replay.New(fixtures, *mcmEnabled)
+	if err != nil {
+		return err
+	}
+	return replayer.ReplayFiles(flags.Args(), os.Stdout)
 }
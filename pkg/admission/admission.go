@@ -8,8 +8,11 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/rancher/webhook/pkg/audit"
+	"github.com/rancher/webhook/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/admissionregistration/v1"
@@ -22,6 +25,8 @@ const (
 	webhookQualifier     = "rancher.cattle.io"
 	bypassServiceAccount = "system:serviceaccount:cattle-system:rancher-webhook-sudo"
 	systemMasters        = "system:masters"
+	validatingWebhook    = "validating"
+	mutatingWebhook      = "mutating"
 )
 
 var (
@@ -67,7 +72,8 @@ type ValidatingAdmissionHandler interface {
 	ValidatingWebhook(clientConfig v1.WebhookClientConfig) []v1.ValidatingWebhook
 
 	// Admitters returns the admitters that this handler will call when evaluating a resource. If any one of these
-	// fails or encounters an error, the failure/error is immediately returned and the rest are short-circuted.
+	// fails or encounters an error, the failure/error is immediately returned and the rest are short-circuted, unless
+	// the handler is a CollectingAdmissionHandler.
 	Admitters() []Admitter
 }
 
@@ -75,6 +81,7 @@ type ValidatingAdmissionHandler interface {
 type MutatingAdmissionHandler interface {
 	WebhookHandler
 	// Since mutators can change a resource, each MutatingAdmissionHandler can only use 1 admit function.
+	// Handlers with several independent mutations can implement it with a MutatorChain.
 	Admitter
 
 	// MutatingWebhook returns a list of configurations to route to this handler.
@@ -182,77 +189,233 @@ func SubPath(gvr schema.GroupVersionResource) string {
 
 // NewValidatingHandlerFunc returns a new HandlerFunc that will call the functions returned by the ValidatingAdmissionHandler's AdmitFuncs() call.
 // If it encounters a failure or an error, it short-circuts and returns immediately.
+// If the handler is not in EnforcementModeEnforce, denials do not short-circuit and the request is allowed instead.
+// If the handler is a CollectingAdmissionHandler collecting all failures, denials do not short-circuit either and are
+// merged into one response.
+// The response holds the warnings of all the admitters which were called.
+// The immutability rules of ImmutableFieldsHandlers are checked before the admitters of the handler.
 func NewValidatingHandlerFunc(handler ValidatingAdmissionHandler) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, req *http.Request) {
-		review, webReq, err := getReviewAndRequestForHandler(req, handler)
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(req.Context(), requestTimeout(req))
+		defer cancel()
+		review, webReq, err := getReviewAndRequestForHandler(req.WithContext(ctx), handler)
 		if err != nil {
 			sendError(responseWriter, review, err)
 			return
 		}
 
+		result := &decision{webhook: validatingWebhook, mode: EnforcementModeFor(handler)}
+		defer func() { result.record(handler, webReq, start) }()
+
 		if bypassValidation(review.Request) {
-			sendResponse(responseWriter, review, ResponseAllowed())
+			result.bypassed = true
+			result.response = ResponseAllowed()
+			sendResponse(responseWriter, review, result.response)
 			logrus.Debugf("admit bypassed: %s %s %s", webReq.Operation, webReq.Kind.String(), resourceString(webReq.Namespace, webReq.Name))
 			return
 		}
 
-		// save the response from the loop so we can return on success
-		var response *admissionv1.AdmissionResponse
-		for _, admitter := range handler.Admitters() {
+		admitters := validatingAdmitters(handler)
+		collect := collectsAllFailures(handler)
+		var warnings []string
+		for _, admitter := range admitters {
 			if admitter == nil {
 				continue
 			}
-			response, err = admitter.Admit(webReq)
-			if response == nil {
-				response = &admissionv1.AdmissionResponse{}
-			}
-			logrus.Debugf("admit result: %s %s %s user=%s allowed=%v err=%v", webReq.Operation, webReq.Kind.String(), resourceString(webReq.Namespace, webReq.Name), webReq.UserInfo.Username, response.Allowed, err)
+			response, err := admit(handler, admitter, webReq)
 
 			// if we get an error or are not allowed, short circuit the admits
 			if err != nil {
+				result.deny(admitter, response)
+				result.err = err
 				review.Response = response
 				sendError(responseWriter, review, err)
 				return
 			}
 			if !response.Allowed {
-				sendResponse(responseWriter, review, response)
-				return
+				result.deny(admitter, response)
+				if result.mode == EnforcementModeEnforce && !collect {
+					response.Warnings = mergeWarnings(warnings, response)
+					sendResponse(responseWriter, review, response)
+					return
+				}
+			} else {
+				result.response = response
 			}
+			warnings = append(warnings, response.Warnings...)
+		}
+		if result.deniedBy != "" {
+			if result.mode == EnforcementModeEnforce {
+				result.response = mergedDenial(result.denials)
+				result.status = result.response.Result
+			} else {
+				result.response = relaxedResponse(handler, webReq, result)
+			}
+		}
+		if result.response == nil {
+			// the handler has no admitters
+			result.response = ResponseAllowed()
 		}
+		// the final response is the one of a single admitter, so it gets the warnings of all of them
+		result.response.Warnings = mergeWarnings(warnings, result.response)
 		// if we have reached this point, all admits approved
-		sendResponse(responseWriter, review, response)
+		sendResponse(responseWriter, review, result.response)
 	}
 }
 
 // NewMutatingHandlerFunc returns a new HandlerFunc that will call the function returned by the MutatingAdmissionHandler's AdmitFunc() call.
 func NewMutatingHandlerFunc(handler MutatingAdmissionHandler) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, req *http.Request) {
-		review, webReq, err := getReviewAndRequestForHandler(req, handler)
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(req.Context(), requestTimeout(req))
+		defer cancel()
+		review, webReq, err := getReviewAndRequestForHandler(req.WithContext(ctx), handler)
 		if err != nil {
 			// review could not be valid, so initialize some safe defaults
 			sendError(responseWriter, review, err)
 			return
 		}
 
+		result := &decision{webhook: mutatingWebhook, mode: EnforcementModeFor(handler)}
+		defer func() { result.record(handler, webReq, start) }()
+
 		if bypassValidation(review.Request) {
-			sendResponse(responseWriter, review, ResponseAllowed())
+			result.bypassed = true
+			result.response = ResponseAllowed()
+			sendResponse(responseWriter, review, result.response)
 			logrus.Debugf("admit bypassed: %s %s %s", webReq.Operation, webReq.Kind.String(), resourceString(webReq.Namespace, webReq.Name))
 			return
 		}
 
-		response, err := handler.Admit(webReq)
-		if response == nil {
-			response = &admissionv1.AdmissionResponse{}
-		}
-		logrus.Debugf("admit result: %s %s %s user=%s allowed=%v err=%v", webReq.Operation, webReq.Kind.String(), resourceString(webReq.Namespace, webReq.Name), webReq.UserInfo.Username, response.Allowed, err)
-
+		response, err := admit(handler, handler, webReq)
 		if err != nil {
+			result.deny(handler, response)
+			result.err = err
 			review.Response = response
 			sendError(responseWriter, review, err)
 			return
 		}
-		sendResponse(responseWriter, review, response)
+		result.response = response
+		if !response.Allowed {
+			result.deny(handler, response)
+			if result.mode != EnforcementModeEnforce {
+				result.response = relaxedResponse(handler, webReq, result)
+			}
+		}
+		sendResponse(responseWriter, review, result.response)
+	}
+}
+
+// admit calls the given admitter, logs and records the result. The returned response is never nil.
+func admit(handler WebhookHandler, admitter Admitter, webReq *Request) (*admissionv1.AdmissionResponse, error) {
+	start := time.Now()
+	response, err := admitter.Admit(webReq)
+	if response == nil {
+		response = &admissionv1.AdmissionResponse{}
+	}
+	if err != nil || !response.Allowed {
+		if timeoutErr := deadlineError(admitter, webReq, err); timeoutErr != nil {
+			err = timeoutErr
+		}
+	}
+	logrus.Debugf("admit result: %s %s %s user=%s allowed=%v err=%v", webReq.Operation, webReq.Kind.String(), resourceString(webReq.Namespace, webReq.Name), webReq.Principal(), response.Allowed, err)
+	metrics.RecordAdmitter(SubPath(handler.GVR()), string(webReq.Operation), AdmitterName(admitter), metricsResult(response, err), time.Since(start))
+	return response, err
+}
+
+// decision tracks how a webhook decided on a request so that it can be recorded once the response is sent.
+type decision struct {
+	webhook  string
+	mode     EnforcementMode
+	response *admissionv1.AdmissionResponse
+	bypassed bool
+	err      error
+	// denials holds the denials returned by the admitters. In EnforcementModeEnforce the handler stops at the
+	// first denial so it holds at most one entry, unless the handler collects all failures.
+	denials []denial
+	// deniedBy and status describe the first denial, even when it was not enforced. When the handler collects all
+	// failures, status is the merged status sent to the client.
+	deniedBy string
+	status   *metav1.Status
+}
+
+type denial struct {
+	admitter string
+	response *admissionv1.AdmissionResponse
+}
+
+// deny records a denial, or an error, returned by the given admitter.
+func (d *decision) deny(admitter Admitter, response *admissionv1.AdmissionResponse) {
+	name := AdmitterName(admitter)
+	if d.deniedBy == "" {
+		d.deniedBy = name
+		d.status = response.Result
 	}
+	d.response = response
+	d.denials = append(d.denials, denial{admitter: name, response: response})
+}
+
+// record records the final decision in the request metrics and the audit log.
+func (d *decision) record(handler WebhookHandler, webReq *Request, start time.Time) {
+	duration := time.Since(start)
+	metrics.RecordRequest(d.webhook, SubPath(handler.GVR()), string(webReq.Operation), metricsResult(d.response, d.err), duration)
+
+	if !audit.Enabled() {
+		return
+	}
+	principal := webReq.Principal()
+	record := &audit.Record{
+		Time:            start.UTC(),
+		UID:             webReq.UID,
+		User:            principal.User.Username,
+		Groups:          principal.User.Groups,
+		Impersonator:    principal.Impersonator,
+		Resource:        webReq.Resource,
+		SubResource:     webReq.SubResource,
+		Namespace:       webReq.Namespace,
+		Name:            webReq.Name,
+		Operation:       string(webReq.Operation),
+		DryRun:          webReq.DryRun != nil && *webReq.DryRun,
+		Webhook:         CreateWebhookName(handler, ""),
+		EnforcementMode: string(d.mode),
+		Bypassed:        d.bypassed,
+		DeniedBy:        d.deniedBy,
+		Status:          d.status,
+		Duration:        duration.String(),
+	}
+	if d.response != nil {
+		record.Allowed = d.err == nil && d.response.Allowed
+	}
+	if d.err != nil {
+		record.Error = d.err.Error()
+	}
+	audit.Log(record)
+}
+
+// metricsResult returns the metrics.Result matching the given response and error.
+func metricsResult(response *admissionv1.AdmissionResponse, err error) metrics.Result {
+	switch {
+	case err != nil:
+		return metrics.ResultError
+	case response == nil || !response.Allowed:
+		return metrics.ResultDenied
+	default:
+		return metrics.ResultAllowed
+	}
+}
+
+// namedAdmitter is an Admitter choosing its own name, e.g. because its type name is generic.
+type namedAdmitter interface {
+	AdmitterName() string
+}
+
+// AdmitterName returns the name used to identify the given admitter in logs and metrics, e.g. "roletemplate.admitter".
+func AdmitterName(admitter Admitter) string {
+	if named, ok := admitter.(namedAdmitter); ok {
+		return named.AdmitterName()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", admitter), "*")
 }
 
 // getReviewAndRequestForHandler produces a admission.AdmissionReview and a Request for a given http request and handler.
@@ -279,6 +442,23 @@ func getReviewAndRequestForHandler(req *http.Request, handler WebhookHandler) (*
 	return &review, webReq, nil
 }
 
+// NewAllowingHandlerFunc returns a HandlerFunc allowing every AdmissionReview, e.g. for handlers which are disabled
+// while the webhook configurations still reference them.
+func NewAllowingHandlerFunc() http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		review := admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(req.Body).Decode(&review); err != nil {
+			sendError(responseWriter, nil, fmt.Errorf("failed to decode review: %w", err))
+			return
+		}
+		if review.Request == nil {
+			sendError(responseWriter, &review, fmt.Errorf("request is not set: %w", ErrInvalidRequest))
+			return
+		}
+		sendResponse(responseWriter, &review, ResponseAllowed())
+	}
+}
+
 // Ptr is a generic function that returns the pointer of T.
 func Ptr[T any](value T) *T {
 	newVal := value
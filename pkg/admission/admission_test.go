@@ -1,14 +1,19 @@
 package admission_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/audit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/admissionregistration/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
@@ -478,6 +483,374 @@ func TestNewMutatingHandlerFunc(t *testing.T) {
 	}
 }
 
+func TestValidatingHandlerFuncAudit(t *testing.T) {
+	var buf bytes.Buffer
+	audit.SetDefault(audit.NewLogger(&buf))
+	t.Cleanup(func() { audit.SetDefault(nil) })
+
+	handler := fakeValidatingAdmissionHandler{
+		gvr: schema.GroupVersionResource{
+			Group:    "test.cattle.io",
+			Version:  "v1alpha1",
+			Resource: "resources",
+		},
+		operations: []v1.OperationType{v1.Create},
+		admitters: []fakeAdmitter{
+			setupAdmitter(&handlerResponse{hasAllow: true}),
+			{response: *admission.ResponseFailedEscalation("not allowed")},
+		},
+	}
+	req := defaultRequest()
+	req.UserInfo.Groups = []string{"system:authenticated"}
+	req.DryRun = admission.Ptr(true)
+	bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: req})
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	admission.NewValidatingHandlerFunc(&handler)(response, httptest.NewRequest("get", "/testEndpoint", bytes.NewReader(bodyBytes)))
+
+	var record audit.Record
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, types.UID("1"), record.UID)
+	assert.Equal(t, "test-user", record.User)
+	assert.Equal(t, []string{"system:authenticated"}, record.Groups)
+	assert.Equal(t, "CREATE", record.Operation)
+	assert.Equal(t, "test-ns", record.Namespace)
+	assert.Equal(t, "test", record.Name)
+	assert.True(t, record.DryRun)
+	assert.Equal(t, "rancher.cattle.io.resources.test.cattle.io", record.Webhook)
+	assert.False(t, record.Allowed)
+	assert.Equal(t, "admission_test.fakeAdmitter", record.DeniedBy)
+	require.NotNil(t, record.Status)
+	assert.Equal(t, "not allowed", record.Status.Message)
+	assert.NotEmpty(t, record.Duration)
+}
+
+func TestValidatingHandlerFuncAuditImpersonation(t *testing.T) {
+	var buf bytes.Buffer
+	audit.SetDefault(audit.NewLogger(&buf))
+	t.Cleanup(func() { audit.SetDefault(nil) })
+
+	handler := fakeValidatingAdmissionHandler{
+		gvr:        schema.GroupVersionResource{Group: "test.cattle.io", Version: "v1alpha1", Resource: "resources"},
+		operations: []v1.OperationType{v1.Create},
+		admitters:  []fakeAdmitter{setupAdmitter(&handlerResponse{hasAllow: true})},
+	}
+	req := defaultRequest()
+	req.UserInfo.Username = "u-abc"
+	req.UserInfo.Groups = []string{"admins", "system:authenticated"}
+	req.UserInfo.Extra = map[string]authenticationv1.ExtraValue{
+		admission.PrincipalIDsExtra: {"local://u-abc"},
+		"username":                  {"alice"},
+	}
+	bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: req})
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	admission.NewValidatingHandlerFunc(&handler)(response, httptest.NewRequest("get", "/testEndpoint", bytes.NewReader(bodyBytes)))
+
+	var record audit.Record
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "u-abc", record.User)
+	assert.Equal(t, []string{"admins", "system:authenticated"}, record.Groups)
+	assert.Equal(t, "system:serviceaccount:cattle-impersonation-system:cattle-impersonation-u-abc", record.Impersonator)
+	assert.True(t, record.Allowed)
+}
+
+func TestValidatingHandlerFuncEnforcementMode(t *testing.T) {
+	const webhookName = "rancher.cattle.io.resources.test.cattle.io"
+	t.Cleanup(func() { admission.SetEnforcementModes(nil) })
+
+	tests := []struct {
+		name         string
+		mode         admission.EnforcementMode
+		admitters    []fakeAdmitter
+		wantAllowed  bool
+		wantWarnings []string
+		wantErr      bool
+	}{
+		{
+			name: "enforce denies",
+			mode: admission.EnforcementModeEnforce,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+				{response: *admission.ResponseBadRequest("second")},
+			},
+			wantAllowed: false,
+		},
+		{
+			name: "warn allows with a warning for each denial",
+			mode: admission.EnforcementModeWarn,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+				setupAdmitter(&handlerResponse{hasAllow: true}),
+				{response: *admission.ResponseBadRequest("second")},
+			},
+			wantAllowed: true,
+			wantWarnings: []string{
+				webhookName + " would deny this request: first",
+				webhookName + " would deny this request: second",
+			},
+		},
+		{
+			name: "audit allows without warnings",
+			mode: admission.EnforcementModeAudit,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+			},
+			wantAllowed: true,
+		},
+		{
+			name: "errors are returned in warn mode",
+			mode: admission.EnforcementModeWarn,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+				setupAdmitter(&handlerResponse{hasError: true}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			admission.SetEnforcementModes(map[string]admission.EnforcementMode{webhookName: test.mode})
+			handler := fakeValidatingAdmissionHandler{
+				gvr: schema.GroupVersionResource{
+					Group:    "test.cattle.io",
+					Version:  "v1alpha1",
+					Resource: "resources",
+				},
+				operations: []v1.OperationType{v1.Create},
+				admitters:  test.admitters,
+			}
+			bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: defaultRequest()})
+			require.NoError(t, err)
+
+			response := httptest.NewRecorder()
+			admission.NewValidatingHandlerFunc(&handler)(response, httptest.NewRequest("get", "/testEndpoint", bytes.NewReader(bodyBytes)))
+
+			if test.wantErr {
+				assert.Equal(t, http.StatusInternalServerError, response.Code)
+				return
+			}
+			require.Equal(t, http.StatusOK, response.Code)
+			var review admissionv1.AdmissionReview
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &review))
+			require.NotNil(t, review.Response)
+			assert.Equal(t, test.wantAllowed, review.Response.Allowed)
+			assert.Equal(t, test.wantWarnings, review.Response.Warnings)
+		})
+	}
+}
+
+func TestValidatingHandlerFuncCollectAllFailures(t *testing.T) {
+	warning := func(response *admissionv1.AdmissionResponse, warnings ...string) *admissionv1.AdmissionResponse {
+		response.Warnings = warnings
+		return response
+	}
+	tests := []struct {
+		name         string
+		collect      bool
+		admitters    []fakeAdmitter
+		wantAllowed  bool
+		wantMessage  string
+		wantCauses   []metav1.StatusCause
+		wantWarnings []string
+		wantErr      bool
+	}{
+		{
+			name:    "stops at the first denial without collecting",
+			collect: false,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+				{response: *admission.ResponseBadRequest("second")},
+			},
+			wantMessage: "first",
+		},
+		{
+			name:    "carries warnings over to the first denial",
+			collect: false,
+			admitters: []fakeAdmitter{
+				{response: *warning(admission.ResponseAllowed(), "first warning")},
+				{response: *warning(admission.ResponseBadRequest("second"), "second warning")},
+				{response: *warning(admission.ResponseBadRequest("third"), "third warning")},
+			},
+			wantMessage:  "second",
+			wantWarnings: []string{"first warning", "second warning"},
+		},
+		{
+			name:    "combines the warnings of allowed requests without collecting",
+			collect: false,
+			admitters: []fakeAdmitter{
+				{response: *warning(admission.ResponseAllowed(), "first warning")},
+				setupAdmitter(&handlerResponse{hasAllow: true}),
+				{response: *warning(admission.ResponseAllowed(), "second warning")},
+			},
+			wantAllowed:  true,
+			wantWarnings: []string{"first warning", "second warning"},
+		},
+		{
+			name:    "merges all denials",
+			collect: true,
+			admitters: []fakeAdmitter{
+				{response: *warning(admission.ResponseBadRequest("first"), "first warning")},
+				setupAdmitter(&handlerResponse{hasAllow: true}),
+				{response: *warning(admission.ResponseFailedEscalation("second"), "second warning")},
+			},
+			wantMessage: "first; second",
+			wantCauses: []metav1.StatusCause{
+				{Type: admission.DenialCause, Message: "admission_test.fakeAdmitter: first"},
+				{Type: admission.DenialCause, Message: "admission_test.fakeAdmitter: second"},
+			},
+			wantWarnings: []string{"first warning", "second warning"},
+		},
+		{
+			name:    "keeps the causes of the denials",
+			collect: true,
+			admitters: []fakeAdmitter{
+				{response: *withCauses(admission.ResponseBadRequest("first"),
+					metav1.StatusCause{Type: metav1.CauseTypeFieldValueInvalid, Field: "spec.name", Message: "invalid name"},
+					metav1.StatusCause{Type: metav1.CauseTypeFieldValueRequired, Field: "spec.role", Message: "role is required"},
+				)},
+				{response: *withCauses(admission.ResponseFailedEscalation("second"),
+					metav1.StatusCause{Type: "MissingPermission", Message: "[get] on pods"},
+				)},
+				{response: *admission.ResponseBadRequest("third")},
+			},
+			wantMessage: "first; second; third",
+			wantCauses: []metav1.StatusCause{
+				{Type: metav1.CauseTypeFieldValueInvalid, Field: "spec.name", Message: "admission_test.fakeAdmitter: invalid name"},
+				{Type: metav1.CauseTypeFieldValueRequired, Field: "spec.role", Message: "admission_test.fakeAdmitter: role is required"},
+				{Type: "MissingPermission", Message: "admission_test.fakeAdmitter: [get] on pods"},
+				{Type: admission.DenialCause, Message: "admission_test.fakeAdmitter: third"},
+			},
+		},
+		{
+			name:    "defaults the code when the first denial has no status",
+			collect: true,
+			admitters: []fakeAdmitter{
+				{response: admissionv1.AdmissionResponse{Allowed: false}},
+				{response: *admission.ResponseBadRequest("second")},
+			},
+			wantMessage: "request denied; second",
+		},
+		{
+			name:    "keeps a single denial",
+			collect: true,
+			admitters: []fakeAdmitter{
+				setupAdmitter(&handlerResponse{hasAllow: true}),
+				{response: *admission.ResponseBadRequest("first")},
+			},
+			wantMessage: "first",
+		},
+		{
+			name:    "combines the warnings of allowed requests",
+			collect: true,
+			admitters: []fakeAdmitter{
+				{response: *warning(admission.ResponseAllowed(), "first warning", "shared warning")},
+				{response: *warning(admission.ResponseAllowed(), "shared warning", "second warning")},
+			},
+			wantAllowed:  true,
+			wantWarnings: []string{"first warning", "shared warning", "second warning"},
+		},
+		{
+			name:    "errors still short-circuit",
+			collect: true,
+			admitters: []fakeAdmitter{
+				{response: *admission.ResponseBadRequest("first")},
+				setupAdmitter(&handlerResponse{hasError: true}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := fakeCollectingAdmissionHandler{
+				fakeValidatingAdmissionHandler: fakeValidatingAdmissionHandler{
+					gvr: schema.GroupVersionResource{
+						Group:    "test.cattle.io",
+						Version:  "v1alpha1",
+						Resource: "resources",
+					},
+					operations: []v1.OperationType{v1.Create},
+					admitters:  test.admitters,
+				},
+				collect: test.collect,
+			}
+			bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: defaultRequest()})
+			require.NoError(t, err)
+
+			response := httptest.NewRecorder()
+			admission.NewValidatingHandlerFunc(&handler)(response, httptest.NewRequest("get", "/testEndpoint", bytes.NewReader(bodyBytes)))
+
+			if test.wantErr {
+				assert.Equal(t, http.StatusInternalServerError, response.Code)
+				return
+			}
+			require.Equal(t, http.StatusOK, response.Code)
+			var review admissionv1.AdmissionReview
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &review))
+			require.NotNil(t, review.Response)
+			assert.Equal(t, test.wantAllowed, review.Response.Allowed)
+			assert.Equal(t, test.wantWarnings, review.Response.Warnings)
+			if test.wantAllowed {
+				return
+			}
+			require.NotNil(t, review.Response.Result)
+			assert.Equal(t, test.wantMessage, review.Response.Result.Message)
+			assert.Equal(t, int32(http.StatusBadRequest), review.Response.Result.Code)
+			if test.wantCauses != nil {
+				require.NotNil(t, review.Response.Result.Details)
+				assert.Equal(t, test.wantCauses, review.Response.Result.Details.Causes)
+			}
+		})
+	}
+}
+
+// withCauses adds the causes to the status of the response.
+func withCauses(response *admissionv1.AdmissionResponse, causes ...metav1.StatusCause) *admissionv1.AdmissionResponse {
+	response.Result.Details = &metav1.StatusDetails{Causes: causes}
+	return response
+}
+
+func TestParseEnforcementMode(t *testing.T) {
+	mode, err := admission.ParseEnforcementMode("warn")
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeWarn, mode)
+
+	_, err = admission.ParseEnforcementMode("off")
+	assert.Error(t, err)
+}
+
+func TestValidatingHandlerFuncTimeout(t *testing.T) {
+	handler := fakeValidatingAdmissionHandler{
+		gvr: schema.GroupVersionResource{
+			Group:    "test.cattle.io",
+			Version:  "v1alpha1",
+			Resource: "resources",
+		},
+		operations: []v1.OperationType{v1.Create},
+		admitters: []fakeAdmitter{
+			setupAdmitter(&handlerResponse{hasAllow: true}),
+			// an admitter swallowing the error of a call that timed out and denying the request
+			{response: *admission.ResponseFailedEscalation("not allowed"), waitForDeadline: true},
+		},
+	}
+	bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: defaultRequest()})
+	require.NoError(t, err)
+
+	// the apiserver sends the timeout of the webhook as a query parameter
+	response := httptest.NewRecorder()
+	start := time.Now()
+	admission.NewValidatingHandlerFunc(&handler)(response, httptest.NewRequest("get", "/testEndpoint?timeout=100ms", bytes.NewReader(bodyBytes)))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	var review admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &review))
+	require.NotNil(t, review.Response.Result)
+	assert.Contains(t, review.Response.Result.Message, "timed out evaluating admission_test.fakeAdmitter for CREATE")
+}
+
 func defaultRequest() *admissionv1.AdmissionRequest {
 	return &admissionv1.AdmissionRequest{
 		Operation: admissionv1.Create,
@@ -535,6 +908,15 @@ func (f *fakeValidatingAdmissionHandler) Admitters() []admission.Admitter {
 	return admitters
 }
 
+type fakeCollectingAdmissionHandler struct {
+	fakeValidatingAdmissionHandler
+	collect bool
+}
+
+func (f *fakeCollectingAdmissionHandler) CollectAllFailures() bool {
+	return f.collect
+}
+
 type fakeMutatingAdmissionHandler struct {
 	gvr        schema.GroupVersionResource
 	operations []v1.OperationType
@@ -559,8 +941,13 @@ func (f *fakeMutatingAdmissionHandler) MutatingWebhook(_ v1.WebhookClientConfig)
 type fakeAdmitter struct {
 	response admissionv1.AdmissionResponse
 	err      error
+	// waitForDeadline makes Admit block until the deadline of the request expires.
+	waitForDeadline bool
 }
 
-func (f *fakeAdmitter) Admit(_ *admission.Request) (*admissionv1.AdmissionResponse, error) {
+func (f *fakeAdmitter) Admit(req *admission.Request) (*admissionv1.AdmissionResponse, error) {
+	if f.waitForDeadline {
+		<-req.Context.Done()
+	}
 	return &f.response, f.err
 }
@@ -0,0 +1,78 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rancher/webhook/pkg/patch"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// MutationStep is one step of a MutatorChain.
+type MutationStep[T any] struct {
+	// Name identifies the step in errors.
+	Name string
+	// SkipOnDryRun skips the step on dry-run requests. Steps with side effects beyond the mutated object, such as
+	// creating other objects, must set it.
+	SkipOnDryRun bool
+	// Mutate mutates newObj in place, after the previous steps of the chain. oldObj is the old object decoded from
+	// the request and must not be modified. Returning a response which is not allowed denies the request and stops
+	// the chain. The warnings of allowed responses are returned to the client.
+	Mutate func(request *Request, oldObj, newObj T) (*admissionv1.AdmissionResponse, error)
+}
+
+// MutatorChain runs a list of MutationSteps on the object of a request and returns a single JSON patch holding the
+// changes of all steps. It lets a MutatingAdmissionHandler, which only has one Admit function, be split into
+// independent steps.
+type MutatorChain[T any] struct {
+	decode func(*admissionv1.AdmissionRequest) (T, T, error)
+	steps  []MutationStep[T]
+}
+
+// NewMutatorChain returns a MutatorChain running the given steps in order. decode returns the old and the new objects
+// of a request, e.g. objectsv1.ClusterOldAndNewFromRequest.
+func NewMutatorChain[T any](decode func(*admissionv1.AdmissionRequest) (T, T, error), steps ...MutationStep[T]) *MutatorChain[T] {
+	return &MutatorChain[T]{
+		decode: decode,
+		steps:  steps,
+	}
+}
+
+// Admit runs the steps of the chain, then creates the patch between the decoded object and the mutated one.
+func (c *MutatorChain[T]) Admit(request *Request) (*admissionv1.AdmissionResponse, error) {
+	oldObj, newObj, err := c.decode(&request.AdmissionRequest)
+	if err != nil {
+		return nil, err
+	}
+	// Re-marshal the decoded object rather than using the raw object of the request. If the CRD known by the webhook
+	// is out of date, the patch would otherwise drop the unknown fields.
+	newJSON, err := json.Marshal(newObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal object: %w", err)
+	}
+
+	dryRun := request.DryRun != nil && *request.DryRun
+	builder := NewResponseBuilder()
+	for _, step := range c.steps {
+		if dryRun && step.SkipOnDryRun {
+			continue
+		}
+		stepResponse, err := step.Mutate(request, oldObj, newObj)
+		if err != nil {
+			return nil, fmt.Errorf("mutation step %s failed: %w", step.Name, err)
+		}
+		if stepResponse == nil {
+			continue
+		}
+		if !stepResponse.Allowed {
+			return builder.Respond(stepResponse), nil
+		}
+		builder.AddWarnings(stepResponse.Warnings...)
+	}
+
+	response := builder.Allow()
+	if err := patch.CreatePatch(newJSON, newObj, response); err != nil {
+		return nil, fmt.Errorf("failed to create patch: %w", err)
+	}
+	return response, nil
+}
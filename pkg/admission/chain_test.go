@@ -0,0 +1,145 @@
+package admission_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func decodeConfigMaps(request *admissionv1.AdmissionRequest) (*corev1.ConfigMap, *corev1.ConfigMap, error) {
+	oldObj, newObj := &corev1.ConfigMap{}, &corev1.ConfigMap{}
+	if err := json.Unmarshal(request.Object.Raw, newObj); err != nil {
+		return nil, nil, err
+	}
+	if request.Operation == admissionv1.Update {
+		if err := json.Unmarshal(request.OldObject.Raw, oldObj); err != nil {
+			return nil, nil, err
+		}
+	}
+	return oldObj, newObj, nil
+}
+
+func TestMutatorChain(t *testing.T) {
+	t.Parallel()
+	setData := func(key, value string) admission.MutationStep[*corev1.ConfigMap] {
+		return admission.MutationStep[*corev1.ConfigMap]{
+			Name: "set-" + key,
+			Mutate: func(_ *admission.Request, _, configMap *corev1.ConfigMap) (*admissionv1.AdmissionResponse, error) {
+				if configMap.Data == nil {
+					configMap.Data = map[string]string{}
+				}
+				configMap.Data[key] = value
+				return admission.ResponseAllowed(), nil
+			},
+		}
+	}
+	// copyData sees the mutations of the previous steps
+	copyData := admission.MutationStep[*corev1.ConfigMap]{
+		Name: "copy",
+		Mutate: func(_ *admission.Request, _, configMap *corev1.ConfigMap) (*admissionv1.AdmissionResponse, error) {
+			configMap.Data["copy"] = configMap.Data["first"]
+			response := admission.ResponseAllowed()
+			response.Warnings = []string{"copied"}
+			return response, nil
+		},
+	}
+	sideEffect := setData("side-effect", "true")
+	sideEffect.SkipOnDryRun = true
+	deny := admission.MutationStep[*corev1.ConfigMap]{
+		Name: "deny",
+		Mutate: func(_ *admission.Request, _, _ *corev1.ConfigMap) (*admissionv1.AdmissionResponse, error) {
+			return admission.ResponseBadRequest("denied"), nil
+		},
+	}
+	fail := admission.MutationStep[*corev1.ConfigMap]{
+		Name: "fail",
+		Mutate: func(_ *admission.Request, _, _ *corev1.ConfigMap) (*admissionv1.AdmissionResponse, error) {
+			return nil, fmt.Errorf("server unavailable")
+		},
+	}
+
+	tests := []struct {
+		name         string
+		steps        []admission.MutationStep[*corev1.ConfigMap]
+		dryRun       bool
+		wantAllowed  bool
+		wantPatch    string
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:         "steps see the mutations of the previous steps",
+			steps:        []admission.MutationStep[*corev1.ConfigMap]{setData("first", "a"), copyData},
+			wantAllowed:  true,
+			wantPatch:    `[{"op":"add","path":"/data","value":{"copy":"a","first":"a"}}]`,
+			wantWarnings: []string{"copied"},
+		},
+		{
+			name:        "no mutation",
+			wantAllowed: true,
+		},
+		{
+			name:        "steps with side effects are skipped on dry run",
+			steps:       []admission.MutationStep[*corev1.ConfigMap]{setData("first", "a"), sideEffect},
+			dryRun:      true,
+			wantAllowed: true,
+			wantPatch:   `[{"op":"add","path":"/data","value":{"first":"a"}}]`,
+		},
+		{
+			name:        "steps with side effects run without dry run",
+			steps:       []admission.MutationStep[*corev1.ConfigMap]{sideEffect},
+			wantAllowed: true,
+			wantPatch:   `[{"op":"add","path":"/data","value":{"side-effect":"true"}}]`,
+		},
+		{
+			name:  "a denial stops the chain",
+			steps: []admission.MutationStep[*corev1.ConfigMap]{setData("first", "a"), deny, fail},
+		},
+		{
+			name:    "an error stops the chain",
+			steps:   []admission.MutationStep[*corev1.ConfigMap]{fail, deny},
+			wantErr: "mutation step fail failed: server unavailable",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			raw, err := json.Marshal(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}})
+			require.NoError(t, err)
+			request := &admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: raw},
+					DryRun:    admission.Ptr(test.dryRun),
+				},
+			}
+
+			response, err := admission.NewMutatorChain(decodeConfigMaps, test.steps...).Admit(request)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantAllowed, response.Allowed)
+			if !test.wantAllowed {
+				assert.Nil(t, response.Patch)
+				return
+			}
+			if test.wantPatch == "" {
+				assert.Nil(t, response.Patch)
+			} else {
+				assert.JSONEq(t, test.wantPatch, string(response.Patch))
+			}
+			assert.Equal(t, test.wantWarnings, response.Warnings)
+		})
+	}
+}
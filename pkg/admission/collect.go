@@ -0,0 +1,70 @@
+package admission
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CollectingAdmissionHandler is a ValidatingAdmissionHandler which can run all of its admitters instead of stopping at
+// the first denial, so that clients learn about every failure of a request in one round trip.
+type CollectingAdmissionHandler interface {
+	ValidatingAdmissionHandler
+
+	// CollectAllFailures returns true if every admitter must run even after one of them denied the request. The
+	// denials are then merged into one response. Errors still short-circuit the remaining admitters.
+	CollectAllFailures() bool
+}
+
+// collectsAllFailures returns true if the handler opted into running all of its admitters.
+func collectsAllFailures(handler ValidatingAdmissionHandler) bool {
+	collecting, ok := handler.(CollectingAdmissionHandler)
+	return ok && collecting.CollectAllFailures()
+}
+
+// DenialCause is the type of the causes of merged denials for admitters whose denial lists no cause of its own.
+const DenialCause metav1.CauseType = "Denial"
+
+// mergedDenial returns a single response for the given denials. A single denial is returned as is. Otherwise, the
+// status takes the code and reason of the first denial, or those of a bad request if it has none, and joins the
+// messages of all of them. The causes of each denial are kept with their message prefixed by the admitter, and a
+// denial without causes is listed as one DenialCause.
+func mergedDenial(denials []denial) *admissionv1.AdmissionResponse {
+	if len(denials) == 1 {
+		return denials[0].response
+	}
+	status := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusBadRequest,
+		Reason:  metav1.StatusReasonBadRequest,
+		Details: &metav1.StatusDetails{},
+	}
+	if first := denials[0].response.Result; first != nil && first.Code != 0 {
+		status.Code = first.Code
+		status.Reason = first.Reason
+	}
+	messages := make([]string, 0, len(denials))
+	for _, denial := range denials {
+		message := denialMessage(denial.response)
+		messages = append(messages, message)
+		if result := denial.response.Result; result != nil && result.Details != nil && len(result.Details.Causes) > 0 {
+			for _, cause := range result.Details.Causes {
+				cause.Message = fmt.Sprintf("%s: %s", denial.admitter, cause.Message)
+				status.Details.Causes = append(status.Details.Causes, cause)
+			}
+			continue
+		}
+		status.Details.Causes = append(status.Details.Causes, metav1.StatusCause{
+			Type:    DenialCause,
+			Message: fmt.Sprintf("%s: %s", denial.admitter, message),
+		})
+	}
+	status.Message = strings.Join(messages, "; ")
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result:  status,
+	}
+}
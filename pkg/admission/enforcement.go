@@ -0,0 +1,79 @@
+package admission
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// EnforcementMode controls what a webhook does with a request that one of its admitters denied.
+type EnforcementMode string
+
+const (
+	// EnforcementModeEnforce denies the request. This is the default mode.
+	EnforcementModeEnforce EnforcementMode = "enforce"
+	// EnforcementModeWarn allows the request and returns the denial messages as warnings to the client.
+	EnforcementModeWarn EnforcementMode = "warn"
+	// EnforcementModeAudit allows the request and only logs the denial.
+	EnforcementModeAudit EnforcementMode = "audit"
+)
+
+var (
+	enforcementModes      map[string]EnforcementMode
+	enforcementModesMutex sync.RWMutex
+)
+
+// ParseEnforcementMode returns the EnforcementMode matching the given value.
+func ParseEnforcementMode(value string) (EnforcementMode, error) {
+	switch mode := EnforcementMode(value); mode {
+	case EnforcementModeEnforce, EnforcementModeWarn, EnforcementModeAudit:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown enforcement mode '%s': must be one of %s, %s or %s", value, EnforcementModeEnforce, EnforcementModeWarn, EnforcementModeAudit)
+	}
+}
+
+// SetEnforcementModes replaces the enforcement modes of all webhooks. The modes are keyed by the name of the webhook
+// as returned by CreateWebhookName. Webhooks missing from the map use EnforcementModeEnforce.
+func SetEnforcementModes(modes map[string]EnforcementMode) {
+	copied := make(map[string]EnforcementMode, len(modes))
+	for name, mode := range modes {
+		copied[name] = mode
+	}
+	enforcementModesMutex.Lock()
+	defer enforcementModesMutex.Unlock()
+	enforcementModes = copied
+}
+
+// EnforcementModeFor returns the enforcement mode of the given handler.
+func EnforcementModeFor(handler WebhookHandler) EnforcementMode {
+	enforcementModesMutex.RLock()
+	defer enforcementModesMutex.RUnlock()
+	if mode, ok := enforcementModes[CreateWebhookName(handler, "")]; ok {
+		return mode
+	}
+	return EnforcementModeEnforce
+}
+
+// relaxedResponse returns the response sent when a webhook that is not enforcing its decisions denied a request.
+func relaxedResponse(handler WebhookHandler, webReq *Request, result *decision) *admissionv1.AdmissionResponse {
+	response := ResponseAllowed()
+	for _, denial := range result.denials {
+		message := fmt.Sprintf("%s would deny this request: %s", CreateWebhookName(handler, ""), denialMessage(denial.response))
+		if result.mode == EnforcementModeWarn {
+			response.Warnings = append(response.Warnings, message)
+		}
+		logrus.Infof("[%s] %s %s %s user=%s: %s was not enforced: %s", result.mode, webReq.Operation, webReq.Kind.String(),
+			resourceString(webReq.Namespace, webReq.Name), webReq.Principal(), denial.admitter, denialMessage(denial.response))
+	}
+	return response
+}
+
+func denialMessage(response *admissionv1.AdmissionResponse) string {
+	if response.Result == nil || response.Result.Message == "" {
+		return "request denied"
+	}
+	return response.Result.Message
+}
@@ -0,0 +1,170 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ImmutabilityRule lists fields, labels and annotations of a resource which must not change on update.
+type ImmutabilityRule struct {
+	// Fields are the dot-separated JSON paths of the immutable fields, e.g. "roleTemplateName" or "spec.displayName".
+	Fields []string
+	// Labels are the keys of the immutable labels.
+	Labels []string
+	// Annotations are the keys of the immutable annotations.
+	Annotations []string
+	// AllowSet lets unset values be set once. Set values still can't be changed or removed.
+	AllowSet bool
+	// AllowChange lets set values be changed to other set values. They still can't be unset.
+	AllowChange bool
+	// SkipDeleting skips the check when the object is being deleted, i.e. when the new object has a deletionTimestamp.
+	SkipDeleting bool
+	// ExemptVerb optionally names a verb which lets the users holding it on the object change the values anyway. It is
+	// checked with HasVerb, and exempts no one if HasVerb is nil.
+	ExemptVerb string
+	// HasVerb checks whether the user of the request holds ExemptVerb, e.g. with a SubjectAccessReview.
+	HasVerb VerbChecker
+}
+
+// VerbChecker returns whether the user of the request has the given verb on the named object of the resource.
+type VerbChecker func(request *Request, gvr schema.GroupVersionResource, verb, name, namespace string) (bool, error)
+
+// ImmutableFieldsHandler is implemented by the ValidatingAdmissionHandlers whose resource has fields, labels or
+// annotations which can't change once an object is created. The rules are checked on the update requests received by
+// the validating webhook of the handler, before its admitters, so the webhook must handle updates.
+type ImmutableFieldsHandler interface {
+	ValidatingAdmissionHandler
+
+	// ImmutableFields returns the immutability rules of the resource of the handler.
+	ImmutableFields() []ImmutabilityRule
+}
+
+// ValidateImmutableFields returns a field.Forbidden error for each immutable value changed by the update request,
+// according to the rules of the given resource. Other operations have no errors.
+func ValidateImmutableFields(request *Request, gvr schema.GroupVersionResource, rules []ImmutabilityRule) (field.ErrorList, error) {
+	if request.Operation != admissionv1.Update || len(rules) == 0 {
+		return nil, nil
+	}
+	var oldObj, newObj map[string]any
+	if err := json.Unmarshal(request.OldObject.Raw, &oldObj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request oldObject: %w", err)
+	}
+	if err := json.Unmarshal(request.Object.Raw, &newObj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+	}
+
+	var errs field.ErrorList
+	for _, rule := range rules {
+		ruleErrs := rule.validate(oldObj, newObj)
+		if len(ruleErrs) == 0 {
+			continue
+		}
+		if rule.ExemptVerb != "" && rule.HasVerb != nil {
+			exempt, err := rule.HasVerb(request, gvr, rule.ExemptVerb, request.Name, request.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check verb %s on %s: %w", rule.ExemptVerb, gvr.GroupResource(), err)
+			}
+			if exempt {
+				continue
+			}
+		}
+		errs = append(errs, ruleErrs...)
+	}
+	return errs, nil
+}
+
+func (rule *ImmutabilityRule) validate(oldObj, newObj map[string]any) field.ErrorList {
+	if rule.SkipDeleting {
+		if deletionTimestamp, found, _ := unstructured.NestedFieldNoCopy(newObj, "metadata", "deletionTimestamp"); !isUnset(deletionTimestamp, found) {
+			return nil
+		}
+	}
+	message := "field is immutable"
+	switch {
+	case rule.AllowChange:
+		message = "field cannot be unset once set"
+	case rule.AllowSet:
+		message = "field is immutable once set"
+	}
+	var errs field.ErrorList
+	// labels and annotations are set when present, even if empty, while fields are unset when empty
+	check := func(path *field.Path, metadata bool, fields ...string) {
+		oldValue, oldFound, _ := unstructured.NestedFieldNoCopy(oldObj, fields...)
+		newValue, newFound, _ := unstructured.NestedFieldNoCopy(newObj, fields...)
+		oldUnset, newUnset := !oldFound, !newFound
+		if !metadata {
+			oldUnset, newUnset = isUnset(oldValue, oldFound), isUnset(newValue, newFound)
+		}
+		switch {
+		case oldUnset && newUnset:
+		case oldUnset && rule.AllowSet:
+		case !oldUnset && !newUnset && rule.AllowChange:
+		case oldUnset != newUnset || !reflect.DeepEqual(oldValue, newValue):
+			errs = append(errs, field.Forbidden(path, message))
+		}
+	}
+	for _, fieldPath := range rule.Fields {
+		fields := strings.Split(fieldPath, ".")
+		check(field.NewPath(fields[0], fields[1:]...), false, fields...)
+	}
+	for _, key := range rule.Labels {
+		check(field.NewPath("metadata", "labels").Key(key), true, "metadata", "labels", key)
+	}
+	for _, key := range rule.Annotations {
+		check(field.NewPath("metadata", "annotations").Key(key), true, "metadata", "annotations", key)
+	}
+	return errs
+}
+
+// isUnset returns whether a value is missing, null or empty.
+func isUnset(value any, found bool) bool {
+	if !found || value == nil {
+		return true
+	}
+	switch value := value.(type) {
+	case string:
+		return value == ""
+	case map[string]any:
+		return len(value) == 0
+	case []any:
+		return len(value) == 0
+	default:
+		return false
+	}
+}
+
+// validatingAdmitters returns the admitters called by the validating webhook of the handler: the admitter checking its
+// immutability rules, if the handler is an ImmutableFieldsHandler with rules, followed by the admitters of the handler.
+func validatingAdmitters(handler ValidatingAdmissionHandler) []Admitter {
+	immutable, ok := handler.(ImmutableFieldsHandler)
+	if !ok {
+		return handler.Admitters()
+	}
+	rules := immutable.ImmutableFields()
+	if len(rules) == 0 {
+		return handler.Admitters()
+	}
+	return append([]Admitter{&immutabilityAdmitter{gvr: handler.GVR(), rules: rules}}, handler.Admitters()...)
+}
+
+// immutabilityAdmitter denies the requests changing immutable values of a resource.
+type immutabilityAdmitter struct {
+	gvr   schema.GroupVersionResource
+	rules []ImmutabilityRule
+}
+
+// Admit validates the request against the immutability rules of the resource.
+func (a *immutabilityAdmitter) Admit(request *Request) (*admissionv1.AdmissionResponse, error) {
+	errs, err := ValidateImmutableFields(request, a.gvr, a.rules)
+	if err != nil {
+		return nil, err
+	}
+	return ResponseFromErrorList(errs)
+}
@@ -0,0 +1,238 @@
+package admission_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func updateRequest(t *testing.T, oldObj, newObj *corev1.ConfigMap) *admission.Request {
+	t.Helper()
+	oldRaw, err := json.Marshal(oldObj)
+	require.NoError(t, err)
+	newRaw, err := json.Marshal(newObj)
+	require.NoError(t, err)
+	return &admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		Name:      "test",
+		Namespace: "test-ns",
+		Object:    runtime.RawExtension{Raw: newRaw},
+		OldObject: runtime.RawExtension{Raw: oldRaw},
+	}}
+}
+
+func TestValidateImmutableFields(t *testing.T) {
+	t.Parallel()
+	configMap := func(labels map[string]string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Labels: labels}, Data: data}
+	}
+	deleting := func(configMap *corev1.ConfigMap) *corev1.ConfigMap {
+		configMap.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		return configMap
+	}
+	tests := []struct {
+		name     string
+		rule     admission.ImmutabilityRule
+		oldObj   *corev1.ConfigMap
+		newObj   *corev1.ConfigMap
+		wantErrs field.ErrorList
+	}{
+		{
+			name:   "unchanged field",
+			rule:   admission.ImmutabilityRule{Fields: []string{"data.key"}},
+			oldObj: configMap(nil, map[string]string{"key": "a", "other": "a"}),
+			newObj: configMap(nil, map[string]string{"key": "a", "other": "b"}),
+		},
+		{
+			name:     "changed field",
+			rule:     admission.ImmutabilityRule{Fields: []string{"data.key"}},
+			oldObj:   configMap(nil, map[string]string{"key": "a"}),
+			newObj:   configMap(nil, map[string]string{"key": "b"}),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("data", "key"), "field is immutable")},
+		},
+		{
+			name:     "set field",
+			rule:     admission.ImmutabilityRule{Fields: []string{"data.key"}},
+			oldObj:   configMap(nil, nil),
+			newObj:   configMap(nil, map[string]string{"key": "a"}),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("data", "key"), "field is immutable")},
+		},
+		{
+			name:   "set field allowed to be set",
+			rule:   admission.ImmutabilityRule{Fields: []string{"data.key"}, AllowSet: true},
+			oldObj: configMap(nil, map[string]string{"key": ""}),
+			newObj: configMap(nil, map[string]string{"key": "a"}),
+		},
+		{
+			name:     "removed field allowed to be set",
+			rule:     admission.ImmutabilityRule{Fields: []string{"data.key"}, AllowSet: true},
+			oldObj:   configMap(nil, map[string]string{"key": "a"}),
+			newObj:   configMap(nil, nil),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("data", "key"), "field is immutable once set")},
+		},
+		{
+			name:     "label set to an empty value",
+			rule:     admission.ImmutabilityRule{Labels: []string{"owner"}},
+			oldObj:   configMap(nil, nil),
+			newObj:   configMap(map[string]string{"owner": ""}, nil),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("metadata", "labels").Key("owner"), "field is immutable")},
+		},
+		{
+			name:   "label allowed to be set",
+			rule:   admission.ImmutabilityRule{Labels: []string{"owner"}, AllowSet: true},
+			oldObj: configMap(map[string]string{"other": "a"}, nil),
+			newObj: configMap(map[string]string{"owner": "a"}, nil),
+		},
+		{
+			name:   "changed field allowed to change",
+			rule:   admission.ImmutabilityRule{Fields: []string{"data.key"}, AllowSet: true, AllowChange: true},
+			oldObj: configMap(nil, map[string]string{"key": "a"}),
+			newObj: configMap(nil, map[string]string{"key": "b"}),
+		},
+		{
+			name:     "removed field allowed to change",
+			rule:     admission.ImmutabilityRule{Fields: []string{"data.key"}, AllowSet: true, AllowChange: true},
+			oldObj:   configMap(nil, map[string]string{"key": "a"}),
+			newObj:   configMap(nil, map[string]string{"key": ""}),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("data", "key"), "field cannot be unset once set")},
+		},
+		{
+			name:   "changed field of an object being deleted",
+			rule:   admission.ImmutabilityRule{Fields: []string{"data.key"}, SkipDeleting: true},
+			oldObj: configMap(nil, map[string]string{"key": "a"}),
+			newObj: deleting(configMap(nil, map[string]string{"key": "b"})),
+		},
+		{
+			name:     "changed fields and labels",
+			rule:     admission.ImmutabilityRule{Fields: []string{"data.key", "data.other"}, Labels: []string{"owner"}},
+			oldObj:   configMap(map[string]string{"owner": "a"}, map[string]string{"key": "a", "other": "a"}),
+			newObj:   configMap(map[string]string{"owner": "b"}, map[string]string{"key": "b", "other": "a"}),
+			wantErrs: field.ErrorList{field.Forbidden(field.NewPath("data", "key"), "field is immutable"), field.Forbidden(field.NewPath("metadata", "labels").Key("owner"), "field is immutable")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			errs, err := admission.ValidateImmutableFields(updateRequest(t, test.oldObj, test.newObj), configMapsGVR, []admission.ImmutabilityRule{test.rule})
+			require.NoError(t, err)
+			assert.Equal(t, test.wantErrs, errs)
+		})
+	}
+}
+
+func TestValidateImmutableFieldsExemptVerb(t *testing.T) {
+	t.Parallel()
+	oldObj := &corev1.ConfigMap{Data: map[string]string{"key": "a"}}
+	newObj := &corev1.ConfigMap{Data: map[string]string{"key": "b"}}
+	tests := []struct {
+		name     string
+		hasVerb  bool
+		verbErr  error
+		wantErrs int
+		wantErr  bool
+	}{
+		{name: "user with the verb", hasVerb: true},
+		{name: "user without the verb", wantErrs: 1},
+		{name: "verb check failure", verbErr: errors.New("sar failed"), wantErr: true},
+	}
+
+	// rules without a verb checker exempt no one
+	errs, err := admission.ValidateImmutableFields(updateRequest(t, oldObj, newObj), configMapsGVR,
+		[]admission.ImmutabilityRule{{Fields: []string{"data.key"}, ExemptVerb: "edit-immutable"}})
+	require.NoError(t, err)
+	assert.Len(t, errs, 1)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			rule := admission.ImmutabilityRule{
+				Fields:     []string{"data.key"},
+				ExemptVerb: "edit-immutable",
+				HasVerb: func(_ *admission.Request, gvr schema.GroupVersionResource, verb, name, namespace string) (bool, error) {
+					assert.Equal(t, configMapsGVR, gvr)
+					assert.Equal(t, "edit-immutable", verb)
+					assert.Equal(t, "test", name)
+					assert.Equal(t, "test-ns", namespace)
+					return test.hasVerb, test.verbErr
+				},
+			}
+
+			errs, err := admission.ValidateImmutableFields(updateRequest(t, oldObj, newObj), configMapsGVR, []admission.ImmutabilityRule{rule})
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, errs, test.wantErrs)
+		})
+	}
+}
+
+// fakeImmutableFieldsHandler is a fakeValidatingAdmissionHandler with immutability rules.
+type fakeImmutableFieldsHandler struct {
+	fakeValidatingAdmissionHandler
+	rules []admission.ImmutabilityRule
+}
+
+func (f *fakeImmutableFieldsHandler) ImmutableFields() []admission.ImmutabilityRule {
+	return f.rules
+}
+
+func TestValidatingHandlerFuncImmutability(t *testing.T) {
+	t.Parallel()
+	rules := []admission.ImmutabilityRule{{Fields: []string{"data.key"}}}
+	review := func(t *testing.T, handler admission.ValidatingAdmissionHandler, newValue string) *admissionv1.AdmissionResponse {
+		request := updateRequest(t, &corev1.ConfigMap{Data: map[string]string{"key": "a"}}, &corev1.ConfigMap{Data: map[string]string{"key": newValue}})
+		bodyBytes, err := json.Marshal(admissionv1.AdmissionReview{Request: &request.AdmissionRequest})
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+		admission.NewValidatingHandlerFunc(handler)(response, httptest.NewRequest("get", "/testEndpoint", bytes.NewReader(bodyBytes)))
+		require.Equal(t, http.StatusOK, response.Code)
+		var result admissionv1.AdmissionReview
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+		require.NotNil(t, result.Response)
+		return result.Response
+	}
+
+	// the rules are checked before the admitters, even for handlers without admitters
+	withoutAdmitters := &fakeImmutableFieldsHandler{
+		fakeValidatingAdmissionHandler: fakeValidatingAdmissionHandler{gvr: configMapsGVR, operations: []v1.OperationType{v1.Update}},
+		rules:                          rules,
+	}
+	response := review(t, withoutAdmitters, "b")
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "data.key: Forbidden: field is immutable", response.Result.Message)
+	assert.True(t, review(t, withoutAdmitters, "a").Allowed)
+
+	withAdmitter := &fakeImmutableFieldsHandler{
+		fakeValidatingAdmissionHandler: fakeValidatingAdmissionHandler{
+			gvr:        configMapsGVR,
+			operations: []v1.OperationType{v1.Update},
+			admitters:  []fakeAdmitter{{response: *admission.ResponseBadRequest("denied by the admitter")}},
+		},
+		rules: rules,
+	}
+	assert.Equal(t, "data.key: Forbidden: field is immutable", review(t, withAdmitter, "b").Result.Message)
+	assert.Equal(t, "denied by the admitter", review(t, withAdmitter, "a").Result.Message)
+
+	// handlers without rules are not checked
+	withoutRules := &fakeValidatingAdmissionHandler{gvr: configMapsGVR, operations: []v1.OperationType{v1.Update}}
+	assert.True(t, review(t, withoutRules, "b").Allowed)
+}
@@ -0,0 +1,81 @@
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	// PrincipalIDsExtra is the extra holding the Rancher principal IDs of a user.
+	PrincipalIDsExtra = "principalid"
+	// impersonationNamespace is the namespace of the service accounts Rancher impersonates users with.
+	impersonationNamespace = "cattle-impersonation-system"
+	// impersonationPrefix prefixes the user ID in the names of the impersonation service accounts.
+	impersonationPrefix = "cattle-impersonation-"
+	// apiserverExtraPrefix prefixes the extras the apiserver sets on the credentials it authenticates itself, such as
+	// service account tokens and, in recent versions, client certificates.
+	apiserverExtraPrefix = "authentication.kubernetes.io/"
+)
+
+// Principal is the identity authorization decisions are made for.
+type Principal struct {
+	// User is the user of the request. For impersonated requests, the apiserver has already replaced the impersonating
+	// client with the impersonated user, whose groups and extras are those given by the impersonation headers.
+	User authenticationv1.UserInfo
+	// Impersonator is the service account Rancher impersonated User with, as derived by PrincipalFor, or empty if the
+	// request does not come from Rancher's impersonation. It is informational and must not be used for authorization.
+	Impersonator string
+}
+
+// Principal returns the principal of the request.
+func (r *Request) Principal() Principal {
+	return PrincipalFor(r.UserInfo)
+}
+
+// PrincipalFor returns the principal of a request made by the given user. The user is used as is, including its groups
+// and extras.
+//
+// The apiserver does not tell admission webhooks who impersonated a user, so the impersonator is derived from the
+// user: Rancher impersonates its users with the cattle-impersonation-<user ID> service account of the
+// cattle-impersonation-system namespace, and always sets their PrincipalIDsExtra. Service accounts, including those of
+// the cattle-impersonation-system namespace, act as themselves, and users holding the authentication.kubernetes.io/
+// extras the apiserver sets on the credentials it authenticated itself were not impersonated.
+func PrincipalFor(userInfo authenticationv1.UserInfo) Principal {
+	principal := Principal{User: userInfo}
+	if len(userInfo.Extra[PrincipalIDsExtra]) == 0 || strings.HasPrefix(userInfo.Username, serviceaccount.ServiceAccountUsernamePrefix) {
+		return principal
+	}
+	for key := range userInfo.Extra {
+		if strings.HasPrefix(key, apiserverExtraPrefix) {
+			return principal
+		}
+	}
+	principal.Impersonator = serviceaccount.MakeUsername(impersonationNamespace, impersonationPrefix+userInfo.Username)
+	return principal
+}
+
+// String returns the name of the user, followed by the name of the impersonator if any.
+func (p Principal) String() string {
+	if p.Impersonator == "" {
+		return p.User.Username
+	}
+	return fmt.Sprintf("%s (impersonated by %s)", p.User.Username, p.Impersonator)
+}
+
+// UserInfo returns the user as a user.Info, as used by rule resolvers.
+func (p Principal) UserInfo() user.Info {
+	extra := make(map[string][]string, len(p.User.Extra))
+	for key, value := range p.User.Extra {
+		extra[key] = value
+	}
+	return &user.DefaultInfo{
+		Name:   p.User.Username,
+		UID:    p.User.UID,
+		Groups: p.User.Groups,
+		Extra:  extra,
+	}
+}
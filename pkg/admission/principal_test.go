@@ -0,0 +1,89 @@
+package admission_test
+
+import (
+	"testing"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestPrincipalFor(t *testing.T) {
+	t.Parallel()
+	const impersonator = "system:serviceaccount:cattle-impersonation-system:cattle-impersonation-u-abc"
+	tests := []struct {
+		name             string
+		userInfo         authenticationv1.UserInfo
+		wantImpersonator string
+		wantString       string
+	}{
+		{
+			name: "user without principal IDs",
+			userInfo: authenticationv1.UserInfo{
+				Username: "u-abc",
+				Groups:   []string{"system:authenticated"},
+			},
+			wantString: "u-abc",
+		},
+		{
+			name: "user authenticated with a client certificate",
+			userInfo: authenticationv1.UserInfo{
+				Username: "u-abc",
+				Groups:   []string{"system:authenticated"},
+				Extra: map[string]authenticationv1.ExtraValue{
+					admission.PrincipalIDsExtra:                  {"local://u-abc"},
+					"authentication.kubernetes.io/credential-id": {"X509SHA256=0123abcd"},
+				},
+			},
+			wantString: "u-abc",
+		},
+		{
+			name: "impersonation service account acting as itself",
+			userInfo: authenticationv1.UserInfo{
+				Username: impersonator,
+				Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:cattle-impersonation-system", "system:authenticated"},
+				Extra: map[string]authenticationv1.ExtraValue{
+					"authentication.kubernetes.io/credential-id": {"JTI=7e2a3c1b"},
+					"authentication.kubernetes.io/pod-name":      {"rancher-1"},
+				},
+			},
+			wantString: impersonator,
+		},
+		{
+			name: "user impersonated by Rancher",
+			userInfo: authenticationv1.UserInfo{
+				Username: "u-abc",
+				Groups:   []string{"admins", "system:authenticated"},
+				Extra: map[string]authenticationv1.ExtraValue{
+					admission.PrincipalIDsExtra: {"local://u-abc", "openldap_user://uid=alice"},
+					"username":                  {"alice"},
+					"requesttokenid":            {"token-xyz"},
+				},
+			},
+			wantImpersonator: impersonator,
+			wantString:       "u-abc (impersonated by " + impersonator + ")",
+		},
+		{
+			name: "impersonator asserted by the client",
+			userInfo: authenticationv1.UserInfo{
+				Username: "u-abc",
+				Groups:   []string{"system:authenticated"},
+				Extra:    map[string]authenticationv1.ExtraValue{"impersonator": {"system:admin"}},
+			},
+			wantString: "u-abc",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			principal := admission.PrincipalFor(test.userInfo)
+			// the user is authorized as given by the apiserver, including its groups and extras
+			assert.Equal(t, test.userInfo, principal.User)
+			assert.Equal(t, test.wantImpersonator, principal.Impersonator)
+			assert.Equal(t, test.wantString, principal.String())
+			assert.Equal(t, test.userInfo.Username, principal.UserInfo().GetName())
+			assert.Equal(t, test.userInfo.Groups, principal.UserInfo().GetGroups())
+		})
+	}
+}
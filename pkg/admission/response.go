@@ -0,0 +1,65 @@
+package admission
+
+import (
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ResponseBuilder accumulates the warnings of an admitter while it evaluates a request, and adds them to the response
+// it returns, whether the request is allowed or denied. Warnings are shown to the client, e.g. by kubectl, and suit
+// checks which should not block the request.
+type ResponseBuilder struct {
+	warnings []string
+}
+
+// NewResponseBuilder returns a ResponseBuilder without warnings.
+func NewResponseBuilder() *ResponseBuilder {
+	return &ResponseBuilder{}
+}
+
+// Warn adds a warning formatted according to the format specifier.
+func (b *ResponseBuilder) Warn(format string, args ...any) {
+	b.warnings = append(b.warnings, fmt.Sprintf(format, args...))
+}
+
+// AddWarnings adds the given warnings, e.g. the warnings of a response returned by a helper.
+func (b *ResponseBuilder) AddWarnings(warnings ...string) {
+	b.warnings = append(b.warnings, warnings...)
+}
+
+// Warnings returns the warnings added so far.
+func (b *ResponseBuilder) Warnings() []string {
+	return b.warnings
+}
+
+// Allow returns an allowed response holding the warnings.
+func (b *ResponseBuilder) Allow() *admissionv1.AdmissionResponse {
+	return b.Respond(ResponseAllowed())
+}
+
+// Respond adds the warnings to the given response, e.g. a denial made with ResponseBadRequest, and returns it. A nil
+// response is returned as is.
+func (b *ResponseBuilder) Respond(response *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	if response == nil || len(b.warnings) == 0 {
+		return response
+	}
+	response.Warnings = mergeWarnings(b.warnings, response)
+	return response
+}
+
+// mergeWarnings returns the given warnings followed by the ones of the response, without duplicates.
+func mergeWarnings(warnings []string, response *admissionv1.AdmissionResponse) []string {
+	var merged []string
+	seen := sets.New[string]()
+	for _, list := range [][]string{warnings, response.Warnings} {
+		for _, warning := range list {
+			if !seen.Has(warning) {
+				seen.Insert(warning)
+				merged = append(merged, warning)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,33 @@
+package admission_test
+
+import (
+	"testing"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestResponseBuilder(t *testing.T) {
+	t.Parallel()
+
+	builder := admission.NewResponseBuilder()
+	assert.Empty(t, builder.Allow().Warnings)
+
+	builder.Warn("namespace %s does not exist", "foo")
+	builder.AddWarnings("shared warning")
+	assert.Equal(t, []string{"namespace foo does not exist", "shared warning"}, builder.Warnings())
+
+	allowed := builder.Allow()
+	assert.True(t, allowed.Allowed)
+	assert.Equal(t, []string{"namespace foo does not exist", "shared warning"}, allowed.Warnings)
+
+	denied := admission.ResponseBadRequest("denied")
+	denied.Warnings = []string{"shared warning", "denial warning"}
+	denied = builder.Respond(denied)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, []string{"namespace foo does not exist", "shared warning", "denial warning"}, denied.Warnings)
+
+	var response *admissionv1.AdmissionResponse
+	assert.Nil(t, builder.Respond(response))
+}
@@ -0,0 +1,55 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultWebhookTimeout is the timeout applied by the apiserver to webhooks that do not set TimeoutSeconds.
+	defaultWebhookTimeout = 10 * time.Second
+	// timeoutMargin is kept from the webhook timeout so that the response reaches the apiserver before it gives up.
+	timeoutMargin = time.Second
+)
+
+// ErrTimedOut is wrapped by the errors returned when the deadline of a request expires before it is fully evaluated.
+var ErrTimedOut = errors.New("timed out")
+
+// CheckDeadline returns an error wrapping ErrTimedOut if the deadline of ctx has expired while evaluating what, and
+// nil otherwise.
+func CheckDeadline(ctx context.Context, what string) error {
+	if ctx == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return fmt.Errorf("%w evaluating %s", ErrTimedOut, what)
+}
+
+// requestTimeout returns how long a webhook request may be evaluated for. The apiserver sends the TimeoutSeconds of the
+// webhook in the timeout query parameter; when it is missing, the default webhook timeout is used. A margin is kept so
+// that the webhook answers before the apiserver times out.
+func requestTimeout(req *http.Request) time.Duration {
+	timeout := defaultWebhookTimeout
+	if value := req.URL.Query().Get("timeout"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			timeout = parsed
+		}
+	}
+	if timeout > 2*timeoutMargin {
+		return timeout - timeoutMargin
+	}
+	return timeout / 2
+}
+
+// deadlineError returns the error to report when the deadline of the request expired while the admitter was evaluating
+// it, or nil otherwise. Admitters may swallow the errors of the calls that timed out and deny the request instead, so a
+// denial made after the deadline is reported as a timeout rather than as a decision.
+func deadlineError(admitter Admitter, webReq *Request, err error) error {
+	if errors.Is(err, ErrTimedOut) {
+		return err
+	}
+	return CheckDeadline(webReq.Context, fmt.Sprintf("%s for %s %s %s", AdmitterName(admitter), webReq.Operation,
+		webReq.Resource.Resource, resourceString(webReq.Namespace, webReq.Name)))
+}
@@ -0,0 +1,190 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/trace"
+)
+
+// TypedValidator is a ValidatingAdmissionHandler validating objects of type T through typed callbacks, so that
+// validators of a single resource only need to implement their checks. It derives the operations of its webhook from
+// the callbacks which are set, decodes the objects of the request with Decode and converts the errors returned by the
+// callbacks to a response. Requests whose objects can't be decoded are denied with a BadRequest status.
+//
+// TypedValidators are created by the New<Type>Validator and New<Type>PartialValidator functions generated in
+// pkg/generated/objects by pkg/codegen for the types opting in, which set the resource, the scope and the decoding of
+// their type, e.g. objectsv3.NewFeatureValidator. Callers then set the callbacks.
+//
+// Callbacks return a field.ErrorList. An empty list allows the request. Otherwise the request is denied with a
+// BadRequest status holding one cause per error, unless one of the errors is a field.InternalError, which is returned
+// as an error so that the failure policy of the webhook applies. Callbacks are also called for dry-run requests, which
+// must be validated like the others, and must not have side effects.
+type TypedValidator[T any] struct {
+	// Resource is the resource validated by the webhook.
+	Resource schema.GroupVersionResource
+	// Scope is the scope of the webhook, e.g. v1.ClusterScope.
+	Scope v1.ScopeType
+	// Decode returns the old and the new objects of a request, e.g. objectsv3.FeatureOldAndNewFromRequest, as generated
+	// by pkg/codegen, or DecodeOldAndNewFromRequest for partial views of the objects.
+	Decode func(*admissionv1.AdmissionRequest) (T, T, error)
+	// OnCreate validates the object of Create requests.
+	OnCreate func(request *Request, newObj T) field.ErrorList
+	// OnUpdate validates the objects of Update requests.
+	OnUpdate func(request *Request, oldObj, newObj T) field.ErrorList
+	// OnDelete validates the object of Delete requests.
+	OnDelete func(request *Request, oldObj T) field.ErrorList
+	// Immutable are the immutability rules of the resource, checked on Update requests before OnUpdate.
+	Immutable []ImmutabilityRule
+	// CustomizeWebhook optionally changes the default webhook, e.g. its failure policy or object selector.
+	CustomizeWebhook func(webhook *v1.ValidatingWebhook)
+}
+
+// GVR returns the GroupVersionResource of the validated resource.
+func (v *TypedValidator[T]) GVR() schema.GroupVersionResource {
+	return v.Resource
+}
+
+// Operations returns the operations which have a callback, and Update if the resource has immutability rules.
+func (v *TypedValidator[T]) Operations() []v1.OperationType {
+	var ops []v1.OperationType
+	if v.OnCreate != nil {
+		ops = append(ops, v1.Create)
+	}
+	if v.OnUpdate != nil || len(v.Immutable) > 0 {
+		ops = append(ops, v1.Update)
+	}
+	if v.OnDelete != nil {
+		ops = append(ops, v1.Delete)
+	}
+	return ops
+}
+
+// ValidatingWebhook returns the default webhook for the resource, changed by CustomizeWebhook.
+func (v *TypedValidator[T]) ValidatingWebhook(clientConfig v1.WebhookClientConfig) []v1.ValidatingWebhook {
+	webhook := NewDefaultValidatingWebhook(v, clientConfig, v.Scope, v.Operations())
+	if v.CustomizeWebhook != nil {
+		v.CustomizeWebhook(webhook)
+	}
+	return []v1.ValidatingWebhook{*webhook}
+}
+
+// ImmutableFields returns the immutability rules of the resource, making the validator an ImmutableFieldsHandler.
+func (v *TypedValidator[T]) ImmutableFields() []ImmutabilityRule {
+	return v.Immutable
+}
+
+// Admitters returns the validator itself.
+func (v *TypedValidator[T]) Admitters() []Admitter {
+	return []Admitter{v}
+}
+
+// AdmitterName returns the name identifying the validator in logs and metrics, e.g. "features.management.cattle.io".
+func (v *TypedValidator[T]) AdmitterName() string {
+	return v.Resource.GroupResource().String()
+}
+
+// Admit decodes the objects of the request and calls the callback of its operation.
+func (v *TypedValidator[T]) Admit(request *Request) (*admissionv1.AdmissionResponse, error) {
+	dryRun := request.DryRun != nil && *request.DryRun
+	admitTrace := trace.New(v.AdmitterName()+" Admit",
+		trace.Field{Key: "user", Value: request.UserInfo.Username}, trace.Field{Key: "dryRun", Value: dryRun})
+	defer admitTrace.LogIfLong(SlowTraceDuration)
+
+	var errs field.ErrorList
+	switch request.Operation {
+	case admissionv1.Create:
+		if v.OnCreate == nil {
+			return ResponseAllowed(), nil
+		}
+		_, newObj, err := v.Decode(&request.AdmissionRequest)
+		if err != nil {
+			return v.decodeFailure(err), nil
+		}
+		errs = v.OnCreate(request, newObj)
+	case admissionv1.Update:
+		if v.OnUpdate == nil {
+			return ResponseAllowed(), nil
+		}
+		oldObj, newObj, err := v.Decode(&request.AdmissionRequest)
+		if err != nil {
+			return v.decodeFailure(err), nil
+		}
+		errs = v.OnUpdate(request, oldObj, newObj)
+	case admissionv1.Delete:
+		if v.OnDelete == nil {
+			return ResponseAllowed(), nil
+		}
+		oldObj, _, err := v.Decode(&request.AdmissionRequest)
+		if err != nil {
+			return v.decodeFailure(err), nil
+		}
+		errs = v.OnDelete(request, oldObj)
+	default:
+		return ResponseAllowed(), nil
+	}
+
+	return ResponseFromErrorList(errs)
+}
+
+// decodeFailure denies a request whose objects can't be decoded, since they are malformed rather than a failure of the
+// webhook.
+func (v *TypedValidator[T]) decodeFailure(err error) *admissionv1.AdmissionResponse {
+	return ResponseBadRequest(fmt.Sprintf("failed to get %s from request: %v", v.Resource.Resource, err))
+}
+
+// ResponseFromErrorList returns an allowed response if errs is empty, and otherwise a BadRequest response with one
+// cause per error. If one of the errors is a field.InternalError, it is returned instead.
+func ResponseFromErrorList(errs field.ErrorList) (*admissionv1.AdmissionResponse, error) {
+	if len(errs) == 0 {
+		return ResponseAllowed(), nil
+	}
+	causes := make([]metav1.StatusCause, 0, len(errs))
+	for _, err := range errs {
+		if err.Type == field.ErrorTypeInternal {
+			return nil, err
+		}
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseType(err.Type),
+			Message: err.ErrorBody(),
+			Field:   err.Field,
+		})
+	}
+	response := ResponseBadRequest(errs.ToAggregate().Error())
+	response.Result.Details = &metav1.StatusDetails{Causes: causes}
+	return response, nil
+}
+
+// DecodeOldAndNewFromRequest gets the old and new objects of type T from the request, like the
+// <Type>OldAndNewFromRequest functions generated by pkg/codegen. It suits types without generated functions, such as
+// the partial views of an object decoded by the New<Type>PartialValidator validators. The old object of Create requests
+// and the new object of Delete requests are zero values.
+func DecodeOldAndNewFromRequest[T any](request *admissionv1.AdmissionRequest) (*T, *T, error) {
+	if request == nil {
+		return nil, nil, fmt.Errorf("nil request")
+	}
+
+	object := new(T)
+	oldObject := new(T)
+
+	if request.Operation != admissionv1.Delete {
+		if err := json.Unmarshal(request.Object.Raw, object); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+		}
+	}
+
+	if request.Operation == admissionv1.Create {
+		return oldObject, object, nil
+	}
+
+	if err := json.Unmarshal(request.OldObject.Raw, oldObject); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal request oldObject: %w", err)
+	}
+
+	return oldObject, object, nil
+}
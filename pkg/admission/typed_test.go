@@ -0,0 +1,143 @@
+package admission_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func newConfigMapValidator() *admission.TypedValidator[*corev1.ConfigMap] {
+	return &admission.TypedValidator[*corev1.ConfigMap]{
+		Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Scope:    v1.NamespacedScope,
+		Decode:   admission.DecodeOldAndNewFromRequest[corev1.ConfigMap],
+		OnCreate: func(_ *admission.Request, newObj *corev1.ConfigMap) field.ErrorList {
+			var errs field.ErrorList
+			for _, key := range []string{"a", "b"} {
+				if newObj.Data[key] == "" {
+					errs = append(errs, field.Required(field.NewPath("data", key), "must be set"))
+				}
+			}
+			return errs
+		},
+		OnUpdate: func(_ *admission.Request, oldObj, newObj *corev1.ConfigMap) field.ErrorList {
+			if oldObj.Data["a"] != newObj.Data["a"] {
+				return field.ErrorList{field.InternalError(field.NewPath("data", "a"), assert.AnError)}
+			}
+			return nil
+		},
+		CustomizeWebhook: func(webhook *v1.ValidatingWebhook) {
+			webhook.FailurePolicy = admission.Ptr(v1.Ignore)
+		},
+	}
+}
+
+func TestTypedValidatorWebhook(t *testing.T) {
+	t.Parallel()
+	validator := newConfigMapValidator()
+
+	assert.Equal(t, []v1.OperationType{v1.Create, v1.Update}, validator.Operations())
+	webhooks := validator.ValidatingWebhook(v1.WebhookClientConfig{})
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, v1.Ignore, *webhooks[0].FailurePolicy)
+	assert.Equal(t, v1.NamespacedScope, *webhooks[0].Rules[0].Scope)
+	assert.Equal(t, []v1.OperationType{v1.Create, v1.Update}, webhooks[0].Rules[0].Operations)
+	assert.Equal(t, "configmaps", admission.AdmitterName(validator.Admitters()[0]))
+
+	// validators with immutability rules handle updates
+	immutable := &admission.TypedValidator[*corev1.ConfigMap]{
+		Resource:  schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Immutable: []admission.ImmutabilityRule{{Fields: []string{"data.key"}}},
+	}
+	assert.Equal(t, []v1.OperationType{v1.Update}, immutable.Operations())
+	assert.Implements(t, (*admission.ImmutableFieldsHandler)(nil), immutable)
+}
+
+func TestTypedValidatorAdmit(t *testing.T) {
+	t.Parallel()
+	request := func(op admissionv1.Operation, oldObj, newObj *corev1.ConfigMap) *admission.Request {
+		oldRaw, err := json.Marshal(oldObj)
+		require.NoError(t, err)
+		newRaw, err := json.Marshal(newObj)
+		require.NoError(t, err)
+		return &admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: op,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		}}
+	}
+	configMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{Data: data}
+	}
+	validator := newConfigMapValidator()
+
+	response, err := validator.Admit(request(admissionv1.Create, nil, configMap(map[string]string{"a": "1", "b": "2"})))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	response, err = validator.Admit(request(admissionv1.Create, nil, configMap(nil)))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, metav1.StatusReasonBadRequest, response.Result.Reason)
+	assert.Equal(t, "[data.a: Required value: must be set, data.b: Required value: must be set]", response.Result.Message)
+	assert.Equal(t, []metav1.StatusCause{
+		{Type: metav1.CauseType(field.ErrorTypeRequired), Message: "Required value: must be set", Field: "data.a"},
+		{Type: metav1.CauseType(field.ErrorTypeRequired), Message: "Required value: must be set", Field: "data.b"},
+	}, response.Result.Details.Causes)
+
+	// internal errors are returned as errors
+	_, err = validator.Admit(request(admissionv1.Update, configMap(map[string]string{"a": "1"}), configMap(map[string]string{"a": "2"})))
+	assert.EqualError(t, err, "data.a: Internal error: "+assert.AnError.Error())
+
+	// operations without callback are allowed
+	response, err = validator.Admit(request(admissionv1.Delete, configMap(nil), nil))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	// objects which can't be decoded are denied
+	response, err = validator.Admit(&admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, metav1.StatusReasonBadRequest, response.Result.Reason)
+	assert.Contains(t, response.Result.Message, "failed to get configmaps from request")
+}
+
+func TestTypedValidatorPartialDecode(t *testing.T) {
+	t.Parallel()
+	type partialConfigMap struct {
+		Data map[string]int `json:"data"`
+	}
+	validator := &admission.TypedValidator[*partialConfigMap]{
+		Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Scope:    v1.NamespacedScope,
+		Decode:   admission.DecodeOldAndNewFromRequest[partialConfigMap],
+	}
+	validator.OnCreate = func(_ *admission.Request, newObj *partialConfigMap) field.ErrorList {
+		if newObj.Data["a"] < 0 {
+			return field.ErrorList{field.Invalid(field.NewPath("data", "a"), newObj.Data["a"], "must not be negative")}
+		}
+		return nil
+	}
+
+	assert.Equal(t, schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, validator.GVR())
+	assert.Equal(t, []v1.OperationType{v1.Create}, validator.Operations())
+	assert.Equal(t, v1.NamespacedScope, *validator.ValidatingWebhook(v1.WebhookClientConfig{})[0].Rules[0].Scope)
+
+	response, err := validator.Admit(&admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(`{"data":{"a":-1}}`)},
+	}})
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "data.a: Invalid value: -1: must not be negative", response.Result.Message)
+}
@@ -0,0 +1,152 @@
+// Package audit writes a structured record for every admission decision made by the webhook.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// LogPathEnv is the environment variable used to enable the audit log. The value is either a file path or "stdout".
+	LogPathEnv = "CATTLE_WEBHOOK_AUDIT_LOG_PATH"
+	// LogMaxSizeEnv is the environment variable used to set the size in megabytes at which the audit log file is rotated.
+	LogMaxSizeEnv = "CATTLE_WEBHOOK_AUDIT_LOG_MAX_SIZE"
+	// LogMaxBackupsEnv is the environment variable used to set the number of rotated audit log files to keep.
+	LogMaxBackupsEnv = "CATTLE_WEBHOOK_AUDIT_LOG_MAX_BACKUPS"
+
+	stdout            = "stdout"
+	defaultMaxSize    = 100
+	defaultMaxBackups = 10
+)
+
+// Record is a single admission decision. User and Groups are those of the user of the request, which is the
+// impersonated user for impersonated requests, in which case Impersonator is the Rancher impersonation service account
+// derived by admission.PrincipalFor.
+type Record struct {
+	Time         time.Time                   `json:"time"`
+	UID          types.UID                   `json:"uid"`
+	User         string                      `json:"user"`
+	Groups       []string                    `json:"groups,omitempty"`
+	Impersonator string                      `json:"impersonator,omitempty"`
+	Resource     metav1.GroupVersionResource `json:"resource"`
+	SubResource  string                      `json:"subResource,omitempty"`
+	Namespace    string                      `json:"namespace,omitempty"`
+	Name         string                      `json:"name,omitempty"`
+	Operation    string                      `json:"operation"`
+	DryRun       bool                        `json:"dryRun"`
+	Webhook      string                      `json:"webhook"`
+	// EnforcementMode is the mode of the webhook. In the "warn" and "audit" modes, a request can be allowed even though
+	// an admitter denied it, in which case DeniedBy and Status describe the denial that was not enforced.
+	EnforcementMode string         `json:"enforcementMode,omitempty"`
+	Allowed         bool           `json:"allowed"`
+	Bypassed        bool           `json:"bypassed,omitempty"`
+	DeniedBy        string         `json:"deniedBy,omitempty"`
+	Status          *metav1.Status `json:"status,omitempty"`
+	Error           string         `json:"error,omitempty"`
+	Duration        string         `json:"duration"`
+}
+
+// Logger writes one JSON encoded Record per line to its output.
+type Logger struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+// NewLogger returns a Logger writing to out.
+func NewLogger(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+// NewLoggerFromEnv returns a Logger configured through the LogPathEnv, LogMaxSizeEnv and LogMaxBackupsEnv environment
+// variables. If LogPathEnv is not set the audit log is disabled and nil is returned.
+func NewLoggerFromEnv() (*Logger, error) {
+	path := os.Getenv(LogPathEnv)
+	if path == "" {
+		return nil, nil
+	}
+	if path == stdout {
+		return NewLogger(os.Stdout), nil
+	}
+	maxSize, err := intFromEnv(LogMaxSizeEnv, defaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	maxBackups, err := intFromEnv(LogMaxBackupsEnv, defaultMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogger(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}), nil
+}
+
+// Log writes the record to the Logger's output. Write failures are logged and otherwise ignored so that auditing
+// never changes the outcome of an admission request.
+func (l *Logger) Log(record *Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		logrus.Warnf("failed to encode audit record for request %s: %v", record.UID, err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := l.out.Write(data); err != nil {
+		logrus.Warnf("failed to write audit record for request %s: %v", record.UID, err)
+	}
+}
+
+var (
+	defaultLogger *Logger
+	defaultMutex  sync.RWMutex
+)
+
+// SetDefault sets the Logger used by Log. A nil logger disables auditing.
+func SetDefault(logger *Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultLogger = logger
+}
+
+// Enabled returns true if a default Logger has been set.
+func Enabled() bool {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultLogger != nil
+}
+
+// Log writes the record using the default Logger. It is a no-op if auditing is disabled.
+func Log(record *Record) {
+	defaultMutex.RLock()
+	logger := defaultLogger
+	defaultMutex.RUnlock()
+	if logger == nil {
+		return
+	}
+	logger.Log(record)
+}
+
+func intFromEnv(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil || result <= 0 {
+		return 0, fmt.Errorf("invalid value '%s' for %s: must be a positive integer", value, key)
+	}
+	return result, nil
+}
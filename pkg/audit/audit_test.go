@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/natefinch/lumberjack.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoggerLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+
+	logger.Log(&Record{UID: "1", User: "u-abc", Operation: "CREATE", Allowed: true})
+	logger.Log(&Record{UID: "2", User: "u-abc", Operation: "UPDATE", DeniedBy: "roletemplate.admitter", Status: &metav1.Status{Message: "denied"}})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var second Record
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, "UPDATE", second.Operation)
+	assert.Equal(t, "roletemplate.admitter", second.DeniedBy)
+	assert.False(t, second.Allowed)
+	require.NotNil(t, second.Status)
+	assert.Equal(t, "denied", second.Status.Message)
+}
+
+func TestDefaultLogger(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+
+	// logging without a default logger must not panic
+	assert.False(t, Enabled())
+	Log(&Record{UID: "1"})
+
+	var buf bytes.Buffer
+	SetDefault(NewLogger(&buf))
+	assert.True(t, Enabled())
+	Log(&Record{UID: "2"})
+	assert.Contains(t, buf.String(), `"uid":"2"`)
+}
+
+func TestNewLoggerFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantNil    bool
+		wantErr    bool
+		wantStdout bool
+		wantFile   bool
+	}{
+		{
+			name:    "disabled by default",
+			wantNil: true,
+		},
+		{
+			name:       "stdout",
+			env:        map[string]string{LogPathEnv: "stdout"},
+			wantStdout: true,
+		},
+		{
+			name:     "file",
+			env:      map[string]string{LogPathEnv: filepath.Join(t.TempDir(), "audit.log"), LogMaxSizeEnv: "5", LogMaxBackupsEnv: "2"},
+			wantFile: true,
+		},
+		{
+			name:    "invalid max size",
+			env:     map[string]string{LogPathEnv: filepath.Join(t.TempDir(), "audit.log"), LogMaxSizeEnv: "big"},
+			wantErr: true,
+		},
+		{
+			name:    "negative max backups",
+			env:     map[string]string{LogPathEnv: filepath.Join(t.TempDir(), "audit.log"), LogMaxBackupsEnv: "-1"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{LogPathEnv, LogMaxSizeEnv, LogMaxBackupsEnv} {
+				t.Setenv(key, test.env[key])
+			}
+			logger, err := NewLoggerFromEnv()
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if test.wantNil {
+				assert.Nil(t, logger)
+				return
+			}
+			require.NotNil(t, logger)
+			if test.wantFile {
+				rotating, ok := logger.out.(*lumberjack.Logger)
+				require.True(t, ok, "expected a rotating file logger")
+				assert.Equal(t, 5, rotating.MaxSize)
+				assert.Equal(t, 2, rotating.MaxBackups)
+			}
+			if test.wantStdout {
+				_, ok := logger.out.(*lumberjack.Logger)
+				assert.False(t, ok, "expected stdout to not be rotated")
+			}
+		})
+	}
+}
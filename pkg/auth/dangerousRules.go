@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	rbacvalidation "k8s.io/component-helpers/auth/rbac/validation"
+)
+
+// DangerousRuleAction is the action taken when a role grants a rule matching a DangerousRule.
+type DangerousRuleAction string
+
+const (
+	// DangerousRuleWarn admits the role and returns a warning to the user.
+	DangerousRuleWarn DangerousRuleAction = "Warn"
+	// DangerousRuleDeny denies the role, even if the user has the escalate verb.
+	DangerousRuleDeny DangerousRuleAction = "Deny"
+)
+
+// DangerousRule describes permissions which should not be granted without notice. A granted rule matches if it allows
+// any of the verbs on any of the resources or non-resource URLs of the DangerousRule. Wildcards are matched literally,
+// e.g. a DangerousRule with the verb "*" only matches rules granting all verbs. Granted rules restricted to resource
+// names never match.
+type DangerousRule struct {
+	// Name identifies the rule in warnings and denials.
+	Name string `json:"name"`
+	rbacv1.PolicyRule
+	// ClusterWide rules only match permissions granted in all the namespaces of a cluster, such as the rules of
+	// cluster RoleTemplates and GlobalRoles, and not permissions granted in a project or a namespace.
+	ClusterWide bool `json:"clusterWide,omitempty"`
+	// Action overrides the action of the policy for this rule.
+	Action DangerousRuleAction `json:"action,omitempty"`
+}
+
+// DangerousRulesPolicy lists the rules checked by the RoleTemplate and GlobalRole validators.
+type DangerousRulesPolicy struct {
+	// Action is the action taken for the rules which do not set one.
+	Action DangerousRuleAction `json:"action"`
+	Rules  []DangerousRule     `json:"rules"`
+}
+
+// DefaultDangerousRulesPolicy is the policy used unless another is set with SetDangerousRulesPolicy.
+var DefaultDangerousRulesPolicy = DangerousRulesPolicy{
+	Action: DangerousRuleWarn,
+	Rules: []DangerousRule{
+		{
+			Name: "all-resources",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{rbacv1.APIGroupAll},
+				Resources: []string{rbacv1.ResourceAll},
+				Verbs:     []string{rbacv1.VerbAll},
+			},
+		},
+		{
+			Name: "escalate-or-bind",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{rbacv1.GroupName, "management.cattle.io"},
+				Resources: []string{"roles", "clusterroles", "roletemplates", "globalroles"},
+				Verbs:     []string{"escalate", "bind"},
+			},
+		},
+		{
+			Name: "impersonate",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{"", "authentication.k8s.io"},
+				Resources: []string{"users", "groups", "serviceaccounts", "uids", "userextras"},
+				Verbs:     []string{"impersonate"},
+			},
+		},
+		{
+			Name: "cluster-wide-secrets",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			ClusterWide: true,
+		},
+		{
+			Name: "nodes-proxy",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"nodes/proxy"},
+				Verbs:     []string{"get", "create"},
+			},
+		},
+		{
+			Name: "serviceaccount-tokens",
+			PolicyRule: rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"serviceaccounts/token"},
+				Verbs:     []string{"create"},
+			},
+		},
+	},
+}
+
+var (
+	dangerousRulesPolicy      = DefaultDangerousRulesPolicy
+	dangerousRulesPolicyMutex sync.RWMutex
+)
+
+// SetDangerousRulesPolicy replaces the policy enforced on RoleTemplates and GlobalRoles. A nil value restores
+// DefaultDangerousRulesPolicy.
+func SetDangerousRulesPolicy(policy *DangerousRulesPolicy) {
+	dangerousRulesPolicyMutex.Lock()
+	defer dangerousRulesPolicyMutex.Unlock()
+	if policy == nil {
+		dangerousRulesPolicy = DefaultDangerousRulesPolicy
+		return
+	}
+	dangerousRulesPolicy = *policy
+}
+
+// CurrentDangerousRulesPolicy returns the policy enforced on RoleTemplates and GlobalRoles.
+func CurrentDangerousRulesPolicy() DangerousRulesPolicy {
+	dangerousRulesPolicyMutex.RLock()
+	defer dangerousRulesPolicyMutex.RUnlock()
+	return dangerousRulesPolicy
+}
+
+// Validate returns an error if an action is unknown or a rule can not match any permission.
+func (p DangerousRulesPolicy) Validate() error {
+	if err := validateDangerousRuleAction(p.Action); err != nil {
+		return err
+	}
+	names := sets.New[string]()
+	for _, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("dangerous rules must have a name")
+		}
+		if names.Has(rule.Name) {
+			return fmt.Errorf("dangerous rule %q is defined more than once", rule.Name)
+		}
+		names.Insert(rule.Name)
+		if rule.Action != "" {
+			if err := validateDangerousRuleAction(rule.Action); err != nil {
+				return fmt.Errorf("dangerous rule %q: %w", rule.Name, err)
+			}
+		}
+		if len(rule.Verbs) == 0 {
+			return fmt.Errorf("dangerous rule %q must have verbs", rule.Name)
+		}
+		if len(rule.NonResourceURLs) == 0 && (len(rule.APIGroups) == 0 || len(rule.Resources) == 0) {
+			return fmt.Errorf("dangerous rule %q must have apiGroups and resources, or nonResourceURLs", rule.Name)
+		}
+	}
+	return nil
+}
+
+func validateDangerousRuleAction(action DangerousRuleAction) error {
+	if action != DangerousRuleWarn && action != DangerousRuleDeny {
+		return fmt.Errorf("action must be %s or %s", DangerousRuleWarn, DangerousRuleDeny)
+	}
+	return nil
+}
+
+// DangerousGrant is a granted rule matching a DangerousRule.
+type DangerousGrant struct {
+	Rule          rbacv1.PolicyRule
+	DangerousRule string
+	Action        DangerousRuleAction
+}
+
+// DangerousGrants are the granted rules matching the rules of a DangerousRulesPolicy.
+type DangerousGrants []DangerousGrant
+
+// Check returns the grants of the given rules matching the rules of the policy. clusterWide is true if the rules are
+// granted in all the namespaces of a cluster.
+func (p DangerousRulesPolicy) Check(rules []rbacv1.PolicyRule, clusterWide bool) DangerousGrants {
+	var grants DangerousGrants
+	for _, dangerous := range p.Rules {
+		if dangerous.ClusterWide && !clusterWide {
+			continue
+		}
+		action := dangerous.Action
+		if action == "" {
+			action = p.Action
+		}
+		subRules := rbacvalidation.BreakdownRule(dangerous.PolicyRule)
+		for _, rule := range rules {
+			if ruleCoversAny(rule, subRules) {
+				grants = append(grants, DangerousGrant{Rule: rule, DangerousRule: dangerous.Name, Action: action})
+			}
+		}
+	}
+	return grants
+}
+
+// ruleCoversAny returns true if the rule allows any of the subRules.
+func ruleCoversAny(rule rbacv1.PolicyRule, subRules []rbacv1.PolicyRule) bool {
+	for _, subRule := range subRules {
+		if covers, _ := rbacvalidation.Covers([]rbacv1.PolicyRule{rule}, []rbacv1.PolicyRule{subRule}); covers {
+			return true
+		}
+	}
+	return false
+}
+
+// Denied returns the grants whose action is DangerousRuleDeny.
+func (g DangerousGrants) Denied() DangerousGrants {
+	var denied DangerousGrants
+	for _, grant := range g {
+		if grant.Action == DangerousRuleDeny {
+			denied = append(denied, grant)
+		}
+	}
+	return denied
+}
+
+// Messages returns a message for each distinct grant, e.g.
+// RoleTemplate read-all grants [get] on secrets, which matches the dangerous rule "cluster-wide-secrets".
+func (g DangerousGrants) Messages(kind, name string) []string {
+	var messages []string
+	seen := sets.New[string]()
+	for _, grant := range g {
+		message := fmt.Sprintf("%s %s grants %s, which matches the dangerous rule %q", kind, name, DescribeRule(grant.Rule), grant.DangerousRule)
+		if seen.Has(message) {
+			continue
+		}
+		seen.Insert(message)
+		messages = append(messages, message)
+	}
+	return messages
+}
@@ -0,0 +1,120 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestDangerousRulesPolicyCheck(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		rules       []rbacv1.PolicyRule
+		clusterWide bool
+		want        []string
+	}{
+		{
+			name: "all verbs on all resources",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+			},
+			want: []string{
+				`RoleTemplate test grants [*] on *.*, which matches the dangerous rule "all-resources"`,
+				`RoleTemplate test grants [*] on *.*, which matches the dangerous rule "escalate-or-bind"`,
+				`RoleTemplate test grants [*] on *.*, which matches the dangerous rule "impersonate"`,
+				`RoleTemplate test grants [*] on *.*, which matches the dangerous rule "nodes-proxy"`,
+				`RoleTemplate test grants [*] on *.*, which matches the dangerous rule "serviceaccount-tokens"`,
+			},
+		},
+		{
+			name: "all verbs on pods",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"*"}},
+			},
+		},
+		{
+			name: "bind on cluster roles",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"get", "bind"}},
+			},
+			want: []string{`RoleTemplate test grants [get bind] on clusterroles.rbac.authorization.k8s.io, which matches the dangerous rule "escalate-or-bind"`},
+		},
+		{
+			name: "bind on named cluster roles",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"bind"}, ResourceNames: []string{"view"}},
+			},
+		},
+		{
+			name: "impersonate users",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+			},
+			want: []string{`RoleTemplate test grants [impersonate] on users, which matches the dangerous rule "impersonate"`},
+		},
+		{
+			name: "secrets in a namespace",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}},
+			},
+		},
+		{
+			name: "secrets in all namespaces",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}},
+			},
+			clusterWide: true,
+			want:        []string{`RoleTemplate test grants [list] on secrets, which matches the dangerous rule "cluster-wide-secrets"`},
+		},
+		{
+			name: "subresources",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"nodes/proxy", "serviceaccounts/token"}, Verbs: []string{"create"}},
+				{APIGroups: []string{""}, Resources: []string{"serviceaccounts"}, Verbs: []string{"create"}},
+			},
+			want: []string{
+				`RoleTemplate test grants [create] on nodes/proxy, serviceaccounts/token, which matches the dangerous rule "nodes-proxy"`,
+				`RoleTemplate test grants [create] on nodes/proxy, serviceaccounts/token, which matches the dangerous rule "serviceaccount-tokens"`,
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			grants := auth.DefaultDangerousRulesPolicy.Check(test.rules, test.clusterWide)
+			assert.Equal(t, test.want, grants.Messages("RoleTemplate", "test"))
+			assert.Empty(t, grants.Denied())
+		})
+	}
+}
+
+func TestDangerousRulesPolicyActions(t *testing.T) {
+	t.Parallel()
+	policy := auth.DangerousRulesPolicy{
+		Action: auth.DangerousRuleWarn,
+		Rules: []auth.DangerousRule{
+			{
+				Name:       "delete-pods",
+				PolicyRule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"delete"}},
+				Action:     auth.DangerousRuleDeny,
+			},
+			{
+				Name:       "list-pods",
+				PolicyRule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}},
+			},
+		},
+	}
+	assert.NoError(t, policy.Validate())
+
+	grants := policy.Check([]rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"*"}}}, false)
+	assert.Len(t, grants, 2)
+	assert.Equal(t, []string{`GlobalRole test grants [*] on pods, which matches the dangerous rule "delete-pods"`},
+		grants.Denied().Messages("GlobalRole", "test"))
+
+	policy.Action = "Ignore"
+	assert.Error(t, policy.Validate())
+}
@@ -2,27 +2,32 @@
 package auth
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/rancher/webhook/pkg/admission"
+	"github.com/sirupsen/logrus"
 	admissionv1 "k8s.io/api/admission/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/authorization/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apiserver/pkg/authentication/user"
-	k8srequest "k8s.io/apiserver/pkg/endpoints/request"
 	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	rbacvalidation "k8s.io/component-helpers/auth/rbac/validation"
 	"k8s.io/kubernetes/pkg/registry/rbac/validation"
 )
 
-// RequestUserHasVerb checks if the user associated with the context has a given verb on a given gvr for a specified name/namespace
+// RequestUserHasVerb checks if the user associated with the context has a given verb on a given gvr for a specified name/namespace.
+// The SubjectAccessReview is bound to the deadline of the request, and an error wrapping admission.ErrTimedOut is
+// returned if it expires.
 func RequestUserHasVerb(request *admission.Request, gvr schema.GroupVersionResource, sar authorizationv1.SubjectAccessReviewInterface, verb, name, namespace string) (bool, error) {
+	principal := request.Principal()
 	extras := map[string]v1.ExtraValue{}
-	for k, v := range request.UserInfo.Extra {
+	for k, v := range principal.User.Extra {
 		extras[k] = v1.ExtraValue(v)
 	}
 
@@ -36,32 +41,156 @@ func RequestUserHasVerb(request *admission.Request, gvr schema.GroupVersionResou
 				Group:     gvr.Group,
 				Name:      name,
 			},
-			User:   request.UserInfo.Username,
-			Groups: request.UserInfo.Groups,
+			User:   principal.User.Username,
+			Groups: principal.User.Groups,
 			Extra:  extras,
-			UID:    request.UserInfo.UID,
+			UID:    principal.User.UID,
 		},
 	}, metav1.CreateOptions{})
 	if err != nil {
+		if timeoutErr := admission.CheckDeadline(request.Context, fmt.Sprintf("SubjectAccessReview for verb '%s' on %s", verb, gvr.GroupResource())); timeoutErr != nil {
+			return false, timeoutErr
+		}
 		return false, fmt.Errorf("failed to checkout create sar request: %w", err)
 	}
+	if principal.Impersonator != "" {
+		logrus.Debugf("SubjectAccessReview for verb '%s' on %s for %s: allowed=%v", verb, gvr.GroupResource(), principal, resp.Status.Allowed)
+	}
 
 	return resp.Status.Allowed, nil
 }
 
 // ConfirmNoEscalation checks that the user attempting to create a binding/role has all the permissions they are attempting
-// to grant.
+// to grant. An *EscalationError listing the missing rules is returned if they do not, and an error wrapping
+// admission.ErrTimedOut is returned if the deadline of the request expires.
 func ConfirmNoEscalation(request *admission.Request, rules []rbacv1.PolicyRule, namespace string, ruleResolver validation.AuthorizationRuleResolver) error {
-	userInfo := &user.DefaultInfo{
-		Name:   request.UserInfo.Username,
-		UID:    request.UserInfo.UID,
-		Groups: request.UserInfo.Groups,
-		Extra:  ToExtraString(request.UserInfo.Extra),
+	principal := request.Principal()
+	userInfo := principal.UserInfo()
+
+	// As per the AuthorizationRuleResolver contract, an error may be returned along with an incomplete list of rules.
+	ownerRules, resolutionErr := ruleResolver.RulesFor(userInfo, namespace)
+	covered, missing := rbacvalidation.Covers(ownerRules, rules)
+	if principal.Impersonator != "" {
+		logrus.Debugf("Escalation check in namespace %q for %s: covered=%v", namespace, principal, covered)
+	}
+	if covered {
+		return nil
+	}
+	if timeoutErr := admission.CheckDeadline(request.Context, "escalation of rules"); timeoutErr != nil {
+		return timeoutErr
 	}
+	if compacted, err := validation.CompactRules(missing); err == nil {
+		missing = compacted
+	}
+	// compacting does not preserve the order of the rules
+	sort.SliceStable(missing, func(i, j int) bool { return DescribeRule(missing[i]) < DescribeRule(missing[j]) })
+	return &EscalationError{
+		User:            userInfo.GetName(),
+		Namespace:       namespace,
+		Missing:         missing,
+		ResolutionError: resolutionErr,
+	}
+}
 
-	globalCtx := k8srequest.WithNamespace(k8srequest.WithUser(context.Background(), userInfo), namespace)
+// EscalationError is returned when a user attempts to grant rules they do not hold.
+type EscalationError struct {
+	User string
+	// Namespace is the namespace the rules of the user were resolved in, empty for cluster-wide rules.
+	Namespace string
+	// Missing holds the requested rules that are not covered by the rules of the user.
+	Missing []rbacv1.PolicyRule
+	// ResolutionError is the error returned while resolving the rules of the user, if any. When set, the rules of the
+	// user may be incomplete.
+	ResolutionError error
+}
 
-	return validation.ConfirmNoEscalation(globalCtx, ruleResolver, rules)
+// Error returns a compact description of the missing rules, e.g.
+// user "u-abc" is missing permissions: [get list] on pods; [create] on deployments.apps named app-1.
+func (e *EscalationError) Error() string {
+	descriptions := make([]string, 0, len(e.Missing))
+	for _, rule := range e.Missing {
+		descriptions = append(descriptions, DescribeRule(rule))
+	}
+	sort.Strings(descriptions)
+	msg := fmt.Sprintf("user %q is missing permissions", e.User)
+	if e.Namespace != "" {
+		msg += fmt.Sprintf(" in namespace %q", e.Namespace)
+	}
+	msg += ": " + strings.Join(descriptions, "; ")
+	if e.ResolutionError != nil {
+		msg += fmt.Sprintf(" (resolution errors: %v)", e.ResolutionError)
+	}
+	return msg
+}
+
+// Causes returns a StatusCause of type MissingPermissionCause for each missing rule.
+func (e *EscalationError) Causes() []metav1.StatusCause {
+	causes := make([]metav1.StatusCause, 0, len(e.Missing))
+	for _, rule := range e.Missing {
+		message := DescribeRule(rule)
+		if e.Namespace != "" {
+			message += fmt.Sprintf(" in namespace %q", e.Namespace)
+		}
+		causes = append(causes, metav1.StatusCause{
+			Type:    MissingPermissionCause,
+			Message: message,
+		})
+	}
+	return causes
+}
+
+// MissingPermissionCause is the type of the StatusCauses listing the rules missing from a user in an escalation denial.
+const MissingPermissionCause metav1.CauseType = "MissingPermission"
+
+// DescribeRule returns a compact description of a rule, e.g. "[get list] on pods, deployments.apps named app-1" or
+// "[get] on non-resource URLs /healthz".
+func DescribeRule(rule rbacv1.PolicyRule) string {
+	verbs := "[" + strings.Join(rule.Verbs, " ") + "]"
+	if len(rule.NonResourceURLs) > 0 {
+		return verbs + " on non-resource URLs " + strings.Join(rule.NonResourceURLs, ", ")
+	}
+	var resources []string
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			if group != "" {
+				resource += "." + group
+			}
+			resources = append(resources, resource)
+		}
+	}
+	description := verbs + " on " + strings.Join(resources, ", ")
+	if len(rule.ResourceNames) > 0 {
+		description += " named " + strings.Join(rule.ResourceNames, ", ")
+	}
+	return description
+}
+
+// FailedEscalationResponse returns an escalation denial with the given message. The missing rules of every
+// EscalationError wrapped in err are attached as the causes of the status.
+func FailedEscalationResponse(message string, err error) *admissionv1.AdmissionResponse {
+	response := admission.ResponseFailedEscalation(message)
+	if causes := escalationCauses(err); len(causes) > 0 {
+		response.Result.Details = &metav1.StatusDetails{Causes: causes}
+	}
+	return response
+}
+
+// escalationCauses returns the causes of the EscalationErrors wrapped in err, including those joined with errors.Join.
+func escalationCauses(err error) []metav1.StatusCause {
+	switch wrapped := err.(type) {
+	case nil:
+		return nil
+	case *EscalationError:
+		return wrapped.Causes()
+	case interface{ Unwrap() []error }:
+		var causes []metav1.StatusCause
+		for _, joined := range wrapped.Unwrap() {
+			causes = append(causes, escalationCauses(joined)...)
+		}
+		return causes
+	default:
+		return escalationCauses(errors.Unwrap(err))
+	}
 }
 
 // ToExtraString will convert a map of map[string]authenticationv1.ExtraValue to map[string]string.
@@ -86,4 +215,7 @@ func SetEscalationResponse(response *admissionv1.AdmissionResponse, err error) {
 		Reason:  metav1.StatusReasonInvalid,
 		Code:    http.StatusUnprocessableEntity,
 	}
+	if causes := escalationCauses(err); len(causes) > 0 {
+		response.Result.Details = &metav1.StatusDetails{Causes: causes}
+	}
 }
@@ -3,8 +3,11 @@ package auth_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/rancher/webhook/pkg/admission"
 	"github.com/rancher/webhook/pkg/auth"
@@ -166,6 +169,100 @@ func (e *EscalationSuite) TestConfirmNoEscalation() {
 	}
 }
 
+func (e *EscalationSuite) TestConfirmNoEscalationMissingRules() {
+	const testUser = "test-user"
+	roleBindings := []*rbacv1.RoleBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: e.readServiceRole.Namespace},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: testUser}},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: e.readServiceRole.Name},
+		},
+	}
+	resolver, _ := validation.NewTestRuleResolver([]*rbacv1.Role{e.readServiceRole}, roleBindings, nil, nil)
+	request := e.newDefaultRequest(testUser)
+
+	err := auth.ConfirmNoEscalation(request, []rbacv1.PolicyRule{e.ruleReadPods, e.ruleReadServices, e.ruleWriteNodes}, request.Namespace, resolver)
+	var escalationErr *auth.EscalationError
+	e.Require().ErrorAs(err, &escalationErr)
+	e.Equal(testUser, escalationErr.User)
+	// rules held by the user are not reported
+	e.Equal([]rbacv1.PolicyRule{e.ruleReadPods, e.ruleWriteNodes}, escalationErr.Missing)
+	e.Equal(`user "test-user" is missing permissions in namespace "namespace1": [GET WATCH] on pods.v1; [PUT CREATE UPDATE] on nodes.v1`, err.Error())
+
+	// errors of several checks are joined, and all their missing rules are attached as causes
+	joined := errors.Join(err, &auth.EscalationError{User: testUser, Missing: []rbacv1.PolicyRule{e.ruleAdmin}})
+	response := auth.FailedEscalationResponse(joined.Error(), fmt.Errorf("wrapped: %w", joined))
+	e.False(response.Allowed)
+	e.Equal(int32(http.StatusForbidden), response.Result.Code)
+	e.Require().NotNil(response.Result.Details)
+	e.Equal([]metav1.StatusCause{
+		{Type: auth.MissingPermissionCause, Message: `[GET WATCH] on pods.v1 in namespace "namespace1"`},
+		{Type: auth.MissingPermissionCause, Message: `[PUT CREATE UPDATE] on nodes.v1 in namespace "namespace1"`},
+		{Type: auth.MissingPermissionCause, Message: `[*] on *.*`},
+	}, response.Result.Details.Causes)
+}
+
+func (e *EscalationSuite) TestConfirmNoEscalationImpersonated() {
+	const testUser = "u-abc"
+	const adminGroup = "admins"
+	serviceAccount := "system:serviceaccount:cattle-impersonation-system:cattle-impersonation-" + testUser
+	clusterRoleBindings := []*rbacv1.ClusterRoleBinding{
+		{
+			Subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: testUser}},
+			RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: e.writeNodeCR.Name},
+		},
+		{
+			Subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: adminGroup}},
+			RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: e.adminCR.Name},
+		},
+	}
+	resolver, _ := validation.NewTestRuleResolver(nil, nil, []*rbacv1.ClusterRole{e.adminCR, e.writeNodeCR}, clusterRoleBindings)
+
+	// the impersonated user keeps the groups given by the apiserver
+	request := e.newDefaultRequest(testUser)
+	request.UserInfo.Groups = []string{adminGroup}
+	request.UserInfo.Extra[admission.PrincipalIDsExtra] = []string{"local://" + testUser}
+	e.Equal(serviceAccount, request.Principal().Impersonator)
+	e.NoError(auth.ConfirmNoEscalation(request, []rbacv1.PolicyRule{e.ruleAdmin}, "", resolver))
+
+	// service accounts of the impersonation namespace acting as themselves are not evaluated as the user they are named after
+	err := auth.ConfirmNoEscalation(e.newDefaultRequest(serviceAccount), []rbacv1.PolicyRule{e.ruleWriteNodes}, "", resolver)
+	var escalationErr *auth.EscalationError
+	e.Require().ErrorAs(err, &escalationErr)
+	e.Equal(serviceAccount, escalationErr.User)
+}
+
+func TestDescribeRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule rbacv1.PolicyRule
+		want string
+	}{
+		{
+			name: "core resources",
+			rule: rbacv1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "secrets"}},
+			want: "[get list] on pods, secrets",
+		},
+		{
+			name: "named resources",
+			rule: rbacv1.PolicyRule{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}, ResourceNames: []string{"app-1"}},
+			want: "[update] on deployments.apps named app-1",
+		},
+		{
+			name: "non-resource URLs",
+			rule: rbacv1.PolicyRule{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}},
+			want: "[get] on non-resource URLs /healthz",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := auth.DescribeRule(test.rule); got != test.want {
+				t.Errorf("DescribeRule() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
 func (e *EscalationSuite) TestRequestUserHasVerb() {
 	gvr := schema.GroupVersionResource{
 		Group:    "management.cattle.io",
@@ -223,6 +320,15 @@ func (e *EscalationSuite) TestRequestUserHasVerb() {
 			wantErr: true,
 		},
 	}
+	expiredRequest := e.newDefaultRequest(errorUser)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	expiredRequest.Context = ctx
+	got, err := auth.RequestUserHasVerb(expiredRequest, gvr, fakeSAR, "escalate", "test-resource", namespace)
+	e.False(got)
+	e.ErrorIs(err, admission.ErrTimedOut)
+	e.ErrorContains(err, "timed out evaluating SubjectAccessReview for verb 'escalate' on roletemplates.management.cattle.io")
+
 	for i := range tests {
 		test := tests[i]
 		e.Run(test.name, func() {
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ExpiresAtAnnotation holds the RFC3339 time at which a ClusterRoleTemplateBinding, ProjectRoleTemplateBinding or
+	// GlobalRoleBinding expires. Expired bindings grant nothing during escalation checks.
+	ExpiresAtAnnotation = "authz.cattle.io/expires-at"
+	// ExtendExpirationVerb is the verb needed on a binding to postpone its expiration or to remove it.
+	ExtendExpirationVerb = "extend-expiration"
+)
+
+// DefaultMaxBindingTTL is the maximum time until the expiration of a binding unless another is set with
+// SetMaxBindingTTL.
+const DefaultMaxBindingTTL = 30 * 24 * time.Hour
+
+var (
+	maxBindingTTL      = DefaultMaxBindingTTL
+	maxBindingTTLMutex sync.RWMutex
+)
+
+// SetMaxBindingTTL replaces the maximum time until the expiration of a binding. A nil value restores
+// DefaultMaxBindingTTL.
+func SetMaxBindingTTL(ttl *time.Duration) {
+	maxBindingTTLMutex.Lock()
+	defer maxBindingTTLMutex.Unlock()
+	if ttl == nil {
+		maxBindingTTL = DefaultMaxBindingTTL
+		return
+	}
+	maxBindingTTL = *ttl
+}
+
+// CurrentMaxBindingTTL returns the maximum time until the expiration of a binding.
+func CurrentMaxBindingTTL() time.Duration {
+	maxBindingTTLMutex.RLock()
+	defer maxBindingTTLMutex.RUnlock()
+	return maxBindingTTL
+}
+
+// BindingExpiration returns the expiration of a binding, and false if the binding does not expire.
+func BindingExpiration(binding metav1.Object) (time.Time, bool, error) {
+	value, ok := binding.GetAnnotations()[ExpiresAtAnnotation]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("annotation %s must be an RFC3339 time: %w", ExpiresAtAnnotation, err)
+	}
+	return expiresAt, true, nil
+}
+
+// BindingExpired returns true if the binding expired at the given time. Bindings with an invalid expiration are
+// expired, so that they grant nothing.
+func BindingExpired(binding metav1.Object, now time.Time) bool {
+	expiresAt, expires, err := BindingExpiration(binding)
+	if err != nil {
+		return true
+	}
+	return expires && !now.Before(expiresAt)
+}
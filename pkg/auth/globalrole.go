@@ -2,10 +2,12 @@ package auth
 
 import (
 	"fmt"
+	"slices"
 
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	controllerv3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // GlobalRoleResolver provides utilities to determine which rules a globalRoles gives in various contexts.
@@ -26,6 +28,11 @@ func NewGlobalRoleResolver(roleTemplateResolver *RoleTemplateResolver, grCache c
 	}
 }
 
+// RoleTemplateResolver returns the resolver of the role templates inherited by global roles.
+func (g *GlobalRoleResolver) RoleTemplateResolver() *RoleTemplateResolver {
+	return g.roleTemplateResolver
+}
+
 // GlobalRoleCache allows caller to retrieve the globalRoleCache used by the resolver.
 func (g *GlobalRoleResolver) GlobalRoleCache() controllerv3.GlobalRoleCache {
 	return g.globalRoles
@@ -69,6 +76,31 @@ func (g *GlobalRoleResolver) ClusterRulesFromRole(gr *v3.GlobalRole) ([]rbacv1.P
 	return rules, nil
 }
 
+// ClusterRoleTemplateNames returns the names of the role templates, including inherited ones, whose rules are returned
+// by ClusterRulesFromRole for this gr. Templates which can not be resolved are included, but not the templates they
+// inherit.
+func (g *GlobalRoleResolver) ClusterRoleTemplateNames(gr *v3.GlobalRole) []string {
+	if gr == nil {
+		return nil
+	}
+	roleTemplateNames := gr.InheritedClusterRoles
+	if slices.Contains(adminRoles, gr.Name) {
+		roleTemplateNames = []string{ownerRT}
+	}
+	names := sets.New[string]()
+	for _, name := range roleTemplateNames {
+		names.Insert(name)
+		roleTemplate, err := g.roleTemplateResolver.RoleTemplateCache().Get(name)
+		if err != nil {
+			continue
+		}
+		_ = g.roleTemplateResolver.VisitRulesFromTemplate(roleTemplate, func(templateName string, _ []rbacv1.PolicyRule) {
+			names.Insert(templateName)
+		})
+	}
+	return sets.List(names)
+}
+
 // FleetWorkspacePermissionsResourceRulesFromRole finds rules which this GlobalRole gives on fleet resources in the workspace backing namespace.
 // This is assuming a user has permissions in all workspaces (including fleet-local), which is not true. That's fine if we
 // use it to evaluate InheritedFleetWorkspacePermissions.ResourceRules. However, it shouldn't be used in a more generic evaluation
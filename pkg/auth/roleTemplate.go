@@ -5,14 +5,19 @@ import (
 
 	rancherv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/memo"
 	v1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // RoleTemplateResolver provides an interface to flatten role templates into slice of rules.
 type RoleTemplateResolver struct {
 	roleTemplates v3.RoleTemplateCache
 	clusterRoles  v1.ClusterRoleCache
+	// memo holds the flattened rules of role templates. It is nil unless the resolver was created with
+	// NewMemoizedRoleTemplateResolver.
+	memo *memo.Memo[*flattenedTemplate]
 }
 
 // NewRoleTemplateResolver creates a newly allocated RoleTemplateResolver from the provided caches
@@ -28,36 +33,44 @@ func (r *RoleTemplateResolver) RoleTemplateCache() v3.RoleTemplateCache { return
 
 // RulesFromTemplateName gets the rules for a roleTemplate with a given name. Simple wrapper around RulesFromTemplate.
 func (r *RoleTemplateResolver) RulesFromTemplateName(name string) ([]rbacv1.PolicyRule, error) {
-	rt, err := r.roleTemplates.Get(name)
+	flattened, err := r.flattenByName(name, sets.New[string]())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get RoleTemplate '%s': %w", name, err)
+		return nil, err
 	}
-	return r.RulesFromTemplate(rt)
+	return flattened.rules(), nil
 }
 
 // RulesFromTemplate gets all rules from the template and all referenced templates.
 func (r *RoleTemplateResolver) RulesFromTemplate(roleTemplate *rancherv3.RoleTemplate) ([]rbacv1.PolicyRule, error) {
-	var rules []rbacv1.PolicyRule
-	var err error
-
 	if roleTemplate == nil {
-		return rules, nil
+		return nil, nil
 	}
-
-	templatesSeen := make(map[string]bool)
-
-	// Kickoff gathering rules
-	rules, err = r.gatherRules(roleTemplate, rules, templatesSeen)
+	flattened, err := r.flatten(roleTemplate, sets.New[string]())
 	if err != nil {
-		return rules, err
+		return nil, err
 	}
-	return rules, nil
+	return flattened.rules(), nil
 }
 
-// gatherRules appends the rules from current template and does a recursive call to get all inherited roles referenced.
-func (r *RoleTemplateResolver) gatherRules(roleTemplate *rancherv3.RoleTemplate, rules []rbacv1.PolicyRule, seen map[string]bool) ([]rbacv1.PolicyRule, error) {
-	seen[roleTemplate.Name] = true
+// VisitRulesFromTemplate calls visitor with the rules of the template and of each referenced template, along with the
+// name of the template holding them. Each template is visited once, even if it is referenced several times.
+func (r *RoleTemplateResolver) VisitRulesFromTemplate(roleTemplate *rancherv3.RoleTemplate, visitor func(templateName string, rules []rbacv1.PolicyRule)) error {
+	if roleTemplate == nil {
+		return nil
+	}
+	flattened, err := r.flatten(roleTemplate, sets.New[string]())
+	if err != nil {
+		return err
+	}
+	for _, template := range flattened.templates {
+		visitor(template.name, template.rules[:len(template.rules):len(template.rules)])
+	}
+	return nil
+}
 
+// TemplateRules gets the rules of the template itself, without the rules of the referenced templates.
+func (r *RoleTemplateResolver) TemplateRules(roleTemplate *rancherv3.RoleTemplate) ([]rbacv1.PolicyRule, error) {
+	var rules []rbacv1.PolicyRule
 	if roleTemplate.External {
 		if roleTemplate.ExternalRules != nil {
 			rules = append(rules, roleTemplate.ExternalRules...)
@@ -69,22 +82,78 @@ func (r *RoleTemplateResolver) gatherRules(roleTemplate *rancherv3.RoleTemplate,
 			rules = append(rules, cr.Rules...)
 		}
 	}
+	return append(rules, roleTemplate.Rules...), nil
+}
 
-	rules = append(rules, roleTemplate.Rules...)
+// flattenByName flattens the role template with the given name, using the memoized rules of the template when
+// they are up-to-date.
+func (r *RoleTemplateResolver) flattenByName(name string, visiting sets.Set[string]) (*flattenedTemplate, error) {
+	roleTemplate, err := r.roleTemplates.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get RoleTemplate '%s': %w", name, err)
+	}
+	if r.memo == nil {
+		return r.flatten(roleTemplate, visiting)
+	}
+	if flattened, ok := r.memo.Get(name); ok && roleTemplate.ResourceVersion != "" && flattened.resourceVersion == roleTemplate.ResourceVersion {
+		return flattened, nil
+	}
+	generation := r.memo.Generation()
+	flattened, err := r.flatten(roleTemplate, visiting)
+	if err != nil {
+		return nil, err
+	}
+	if flattened.complete {
+		r.memo.Store(name, flattened, flattened.dependencies(), generation)
+	}
+	return flattened, nil
+}
+
+// flatten gathers the rules from the current template and the rules of all inherited templates. Templates being
+// flattened by the callers are listed in visiting: they are skipped to break reference cycles, and since the rules of
+// the result are then incomplete it is not memoized.
+func (r *RoleTemplateResolver) flatten(roleTemplate *rancherv3.RoleTemplate, visiting sets.Set[string]) (*flattenedTemplate, error) {
+	visiting.Insert(roleTemplate.Name)
+	defer visiting.Delete(roleTemplate.Name)
+
+	result := &flattenedTemplate{
+		resourceVersion: roleTemplate.ResourceVersion,
+		roleTemplates:   sets.New(roleTemplate.Name),
+		clusterRoles:    sets.New[string](),
+		complete:        true,
+	}
+
+	rules, err := r.TemplateRules(roleTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if roleTemplate.External && roleTemplate.ExternalRules == nil {
+		result.clusterRoles.Insert(roleTemplate.Name)
+	}
+	result.templates = append(result.templates, templateRules{name: roleTemplate.Name, rules: rules})
 
 	for _, templateName := range roleTemplate.RoleTemplateNames {
 		// If we have already seen the roleTemplate, skip it
-		if seen[templateName] {
+		if result.roleTemplates.Has(templateName) {
 			continue
 		}
-		next, err := r.roleTemplates.Get(templateName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get RoleTemplate '%s': %w", templateName, err)
+		if visiting.Has(templateName) {
+			result.complete = false
+			continue
 		}
-		rules, err = r.gatherRules(next, rules, seen)
+		inherited, err := r.flattenByName(templateName, visiting)
 		if err != nil {
 			return nil, err
 		}
+		result.complete = result.complete && inherited.complete
+		result.clusterRoles = result.clusterRoles.Union(inherited.clusterRoles)
+		for _, template := range inherited.templates {
+			if result.roleTemplates.Has(template.name) {
+				continue
+			}
+			result.roleTemplates.Insert(template.name)
+			result.templates = append(result.templates, template)
+		}
 	}
-	return rules, nil
+	return result, nil
 }
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+
+	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/memo"
+	v1 "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// NewMemoizedRoleTemplateResolver creates a RoleTemplateResolver which memoizes the flattened rules of the role templates
+// it gets from the cache of the roleTemplates controller. Memoized rules are keyed by the name and resourceVersion of
+// the template, and are invalidated by informer event handlers when one of the inherited templates, or one of the
+// ClusterRoles backing external templates, changes.
+func NewMemoizedRoleTemplateResolver(roleTemplates v3.RoleTemplateController, clusterRoles v1.ClusterRoleController) (*RoleTemplateResolver, error) {
+	resolver := NewRoleTemplateResolver(roleTemplates.Cache(), clusterRoles.Cache())
+	resolver.memo = memo.New[*flattenedTemplate](memo.DefaultMaxEntries)
+
+	if _, err := roleTemplates.Informer().AddEventHandler(resolver.memo.EventHandler(memo.ByName(roleTemplateKind))); err != nil {
+		return nil, fmt.Errorf("failed to add RoleTemplate event handler: %w", err)
+	}
+	if _, err := clusterRoles.Informer().AddEventHandler(resolver.memo.EventHandler(memo.ByName(clusterRoleKind))); err != nil {
+		return nil, fmt.Errorf("failed to add ClusterRole event handler: %w", err)
+	}
+	return resolver, nil
+}
+
+// OnRulesChanged registers a function called with the name of each RoleTemplate, or of each ClusterRole backing an
+// external RoleTemplate, which changed, once the memoized rules depending on it were invalidated. Values computed from
+// the rules returned by the resolver, such as the rule indexes of the resolvers package, must be invalidated this way
+// rather than by event handlers of their own, so that they can't be computed again from stale memoized rules. It
+// returns false, and registers nothing, if the resolver does not memoize rules.
+func (r *RoleTemplateResolver) OnRulesChanged(f func(name string)) bool {
+	if r.memo == nil {
+		return false
+	}
+	r.memo.OnInvalidate(func(dependency memo.Dependency) {
+		f(dependency.Name)
+	})
+	return true
+}
+
+const (
+	roleTemplateKind = "RoleTemplate"
+	clusterRoleKind  = "ClusterRole"
+)
+
+// templateRules are the rules held by a single role template.
+type templateRules struct {
+	name  string
+	rules []rbacv1.PolicyRule
+}
+
+// flattenedTemplate holds the rules of a role template and of all the templates it inherits.
+type flattenedTemplate struct {
+	resourceVersion string
+	// templates holds the rules of each template, in the order they are visited.
+	templates []templateRules
+	// roleTemplates and clusterRoles are the names of the objects the rules were read from.
+	roleTemplates sets.Set[string]
+	clusterRoles  sets.Set[string]
+	// complete is false if inherited templates were skipped to break a reference cycle.
+	complete bool
+}
+
+// rules returns the rules of all the templates.
+func (f *flattenedTemplate) rules() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	for _, template := range f.templates {
+		rules = append(rules, template.rules...)
+	}
+	return rules
+}
+
+// dependencies returns the objects the rules were read from.
+func (f *flattenedTemplate) dependencies() []memo.Dependency {
+	dependencies := make([]memo.Dependency, 0, f.roleTemplates.Len()+f.clusterRoles.Len())
+	for _, name := range sets.List(f.roleTemplates) {
+		dependencies = append(dependencies, memo.Dependency{Kind: roleTemplateKind, Name: name})
+	}
+	for _, name := range sets.List(f.clusterRoles) {
+		dependencies = append(dependencies, memo.Dependency{Kind: clusterRoleKind, Name: name})
+	}
+	return dependencies
+}
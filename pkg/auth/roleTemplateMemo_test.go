@@ -0,0 +1,199 @@
+package auth_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+)
+
+var (
+	getPods  = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	listPods = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}}
+	getNodes = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}}
+)
+
+type memoizedResolverState struct {
+	resolver             *auth.RoleTemplateResolver
+	roleTemplates        *fcache.FakeControllerSource
+	clusterRoles         *fcache.FakeControllerSource
+	roleTemplateInformer cache.SharedIndexInformer
+	clusterRoleInformer  cache.SharedIndexInformer
+	// roleTemplateGets counts the calls to the RoleTemplate cache.
+	roleTemplateGets atomic.Int32
+}
+
+func TestMemoizedRoleTemplateResolver(t *testing.T) {
+	state := newMemoizedResolverState(t)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "read-pods"},
+		Rules:      []rbacv1.PolicyRule{getPods},
+	})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta:        metav1.ObjectMeta{Name: "member"},
+		RoleTemplateNames: []string{"read-pods"},
+	})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta:        metav1.ObjectMeta{Name: "owner"},
+		RoleTemplateNames: []string{"member", "external"},
+	})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "external"},
+		External:   true,
+	})
+	state.clusterRoles.Add(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "external"},
+		Rules:      []rbacv1.PolicyRule{getNodes},
+	})
+	state.start(t)
+
+	rules, err := state.resolver.RulesFromTemplateName("owner")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{getPods, getNodes}, rules)
+	// owner, member, read-pods and external are read once
+	assert.Equal(t, int32(4), state.roleTemplateGets.Load())
+
+	rules, err = state.resolver.RulesFromTemplateName("owner")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{getPods, getNodes}, rules)
+	// only the resourceVersion of owner is checked
+	assert.Equal(t, int32(5), state.roleTemplateGets.Load())
+
+	// changing a transitively inherited template invalidates the rules of its parents
+	state.roleTemplates.Modify(&apisv3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "read-pods"},
+		Rules:      []rbacv1.PolicyRule{getPods, listPods},
+	})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.resolver.RulesFromTemplateName("owner")
+		assert.NoError(c, err)
+		assert.Equal(c, []rbacv1.PolicyRule{getPods, listPods, getNodes}, rules)
+	}, time.Second, 10*time.Millisecond)
+
+	// changing the ClusterRole backing an external template invalidates the rules of its parents
+	state.clusterRoles.Modify(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "external"},
+	})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.resolver.RulesFromTemplateName("owner")
+		assert.NoError(c, err)
+		assert.Equal(c, []rbacv1.PolicyRule{getPods, listPods}, rules)
+	}, time.Second, 10*time.Millisecond)
+
+	// deleting an inherited template invalidates the rules of its parents
+	state.roleTemplates.Delete(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read-pods"}})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		_, err := state.resolver.RulesFromTemplateName("member")
+		assert.Error(c, err)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMemoizedRoleTemplateResolverCycle(t *testing.T) {
+	state := newMemoizedResolverState(t)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta:        metav1.ObjectMeta{Name: "a"},
+		Rules:             []rbacv1.PolicyRule{getPods},
+		RoleTemplateNames: []string{"b"},
+	})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta:        metav1.ObjectMeta{Name: "b"},
+		Rules:             []rbacv1.PolicyRule{getNodes},
+		RoleTemplateNames: []string{"a"},
+	})
+	state.start(t)
+
+	for i := 0; i < 2; i++ {
+		rules, err := state.resolver.RulesFromTemplateName("a")
+		require.NoError(t, err)
+		assert.Equal(t, []rbacv1.PolicyRule{getPods, getNodes}, rules)
+
+		rules, err = state.resolver.RulesFromTemplateName("b")
+		require.NoError(t, err)
+		assert.Equal(t, []rbacv1.PolicyRule{getNodes, getPods}, rules)
+	}
+}
+
+func TestMemoizedRoleTemplateResolverRequestObject(t *testing.T) {
+	state := newMemoizedResolverState(t)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "read-pods"},
+		Rules:      []rbacv1.PolicyRule{getPods},
+	})
+	state.start(t)
+
+	stored, err := state.resolver.RoleTemplateCache().Get("read-pods")
+	require.NoError(t, err)
+	_, err = state.resolver.RulesFromTemplate(stored)
+	require.NoError(t, err)
+
+	// objects from admission requests keep the resourceVersion of the stored object, so their rules are never memoized
+	updated := stored.DeepCopy()
+	updated.Rules = append(updated.Rules, listPods)
+	rules, err := state.resolver.RulesFromTemplate(updated)
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{getPods, listPods}, rules)
+}
+
+func newMemoizedResolverState(t *testing.T) *memoizedResolverState {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	state := &memoizedResolverState{
+		roleTemplates: fcache.NewFakeControllerSource(),
+		clusterRoles:  fcache.NewFakeControllerSource(),
+	}
+	state.roleTemplateInformer = cache.NewSharedIndexInformer(state.roleTemplates, &apisv3.RoleTemplate{}, 0, cache.Indexers{})
+	state.clusterRoleInformer = cache.NewSharedIndexInformer(state.clusterRoles, &rbacv1.ClusterRole{}, 0, cache.Indexers{})
+
+	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.RoleTemplate](ctrl)
+	roleTemplateCache.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) (*apisv3.RoleTemplate, error) {
+		state.roleTemplateGets.Add(1)
+		obj, exists, err := state.roleTemplateInformer.GetIndexer().GetByKey(name)
+		if err != nil || !exists {
+			return nil, apierrors.NewNotFound(schema.GroupResource{Group: "management.cattle.io", Resource: "roletemplates"}, name)
+		}
+		return obj.(*apisv3.RoleTemplate), nil
+	}).AnyTimes()
+	clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+	clusterRoleCache.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) (*rbacv1.ClusterRole, error) {
+		obj, exists, err := state.clusterRoleInformer.GetIndexer().GetByKey(name)
+		if err != nil || !exists {
+			return nil, apierrors.NewNotFound(schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "clusterroles"}, name)
+		}
+		return obj.(*rbacv1.ClusterRole), nil
+	}).AnyTimes()
+
+	roleTemplateController := fake.NewMockNonNamespacedControllerInterface[*apisv3.RoleTemplate, *apisv3.RoleTemplateList](ctrl)
+	roleTemplateController.EXPECT().Cache().Return(roleTemplateCache).AnyTimes()
+	roleTemplateController.EXPECT().Informer().Return(state.roleTemplateInformer).AnyTimes()
+	clusterRoleController := fake.NewMockNonNamespacedControllerInterface[*rbacv1.ClusterRole, *rbacv1.ClusterRoleList](ctrl)
+	clusterRoleController.EXPECT().Cache().Return(clusterRoleCache).AnyTimes()
+	clusterRoleController.EXPECT().Informer().Return(state.clusterRoleInformer).AnyTimes()
+
+	resolver, err := auth.NewMemoizedRoleTemplateResolver(roleTemplateController, clusterRoleController)
+	require.NoError(t, err)
+	state.resolver = resolver
+	return state
+}
+
+// start runs the informers until the test ends and waits for their caches to sync.
+func (s *memoizedResolverState) start(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.roleTemplateInformer.Run(ctx.Done())
+	go s.clusterRoleInformer.Run(ctx.Done())
+	require.True(t, cache.WaitForCacheSync(ctx.Done(), s.roleTemplateInformer.HasSynced, s.clusterRoleInformer.HasSynced))
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// RoleTemplateDutyKind is the kind of the DutyRoles referring to RoleTemplates.
+	RoleTemplateDutyKind = "RoleTemplate"
+	// GlobalRoleDutyKind is the kind of the DutyRoles referring to GlobalRoles.
+	GlobalRoleDutyKind = "GlobalRole"
+)
+
+// DutyRole is a RoleTemplate or a GlobalRole held by a subject.
+type DutyRole struct {
+	Kind string
+	Name string
+}
+
+// String returns the kind and the name of the role, e.g. RoleTemplate cluster-owner.
+func (r DutyRole) String() string {
+	return r.Kind + " " + r.Name
+}
+
+// DutyConflict declares mutually exclusive roles: a subject may hold at most one of them in the same scope.
+type DutyConflict struct {
+	// Name identifies the conflict in denials.
+	Name          string   `json:"name"`
+	RoleTemplates []string `json:"roleTemplates,omitempty"`
+	GlobalRoles   []string `json:"globalRoles,omitempty"`
+}
+
+// Has returns true if the role is one of the mutually exclusive roles of the conflict.
+func (c DutyConflict) Has(role DutyRole) bool {
+	switch role.Kind {
+	case RoleTemplateDutyKind:
+		return sets.New(c.RoleTemplates...).Has(role.Name)
+	case GlobalRoleDutyKind:
+		return sets.New(c.GlobalRoles...).Has(role.Name)
+	default:
+		return false
+	}
+}
+
+// SeparationOfDutiesPolicy lists the conflicts enforced by the ClusterRoleTemplateBinding, ProjectRoleTemplateBinding
+// and GlobalRoleBinding validators.
+type SeparationOfDutiesPolicy struct {
+	Conflicts []DutyConflict `json:"conflicts"`
+}
+
+var (
+	separationOfDutiesPolicy      SeparationOfDutiesPolicy
+	separationOfDutiesPolicyMutex sync.RWMutex
+)
+
+// SetSeparationOfDutiesPolicy replaces the policy enforced on bindings. A nil value restores the empty policy, which
+// has no conflicts.
+func SetSeparationOfDutiesPolicy(policy *SeparationOfDutiesPolicy) {
+	separationOfDutiesPolicyMutex.Lock()
+	defer separationOfDutiesPolicyMutex.Unlock()
+	if policy == nil {
+		separationOfDutiesPolicy = SeparationOfDutiesPolicy{}
+		return
+	}
+	separationOfDutiesPolicy = *policy
+}
+
+// CurrentSeparationOfDutiesPolicy returns the policy enforced on bindings.
+func CurrentSeparationOfDutiesPolicy() SeparationOfDutiesPolicy {
+	separationOfDutiesPolicyMutex.RLock()
+	defer separationOfDutiesPolicyMutex.RUnlock()
+	return separationOfDutiesPolicy
+}
+
+// Validate returns an error if a conflict has no name or fewer than two roles.
+func (p SeparationOfDutiesPolicy) Validate() error {
+	names := sets.New[string]()
+	for _, conflict := range p.Conflicts {
+		if conflict.Name == "" {
+			return fmt.Errorf("separation of duties conflicts must have a name")
+		}
+		if names.Has(conflict.Name) {
+			return fmt.Errorf("separation of duties conflict %q is defined more than once", conflict.Name)
+		}
+		names.Insert(conflict.Name)
+		if roles := len(sets.New(conflict.RoleTemplates...)) + len(sets.New(conflict.GlobalRoles...)); roles < 2 {
+			return fmt.Errorf("separation of duties conflict %q must have at least two roles", conflict.Name)
+		}
+	}
+	return nil
+}
+
+// ConflictsOf returns the conflicts which include the role.
+func (p SeparationOfDutiesPolicy) ConflictsOf(role DutyRole) []DutyConflict {
+	var conflicts []DutyConflict
+	for _, conflict := range p.Conflicts {
+		if conflict.Has(role) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
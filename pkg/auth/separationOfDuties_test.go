@@ -0,0 +1,31 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeparationOfDutiesPolicy(t *testing.T) {
+	t.Parallel()
+	policy := auth.SeparationOfDutiesPolicy{
+		Conflicts: []auth.DutyConflict{
+			{Name: "owner-auditor", RoleTemplates: []string{"cluster-owner", "auditor"}},
+			{Name: "admin-auditor", RoleTemplates: []string{"auditor"}, GlobalRoles: []string{"admin"}},
+		},
+	}
+	assert.NoError(t, policy.Validate())
+
+	auditor := auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: "auditor"}
+	assert.Equal(t, policy.Conflicts, policy.ConflictsOf(auditor))
+	assert.Equal(t, policy.Conflicts[1:], policy.ConflictsOf(auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: "admin"}))
+	assert.Empty(t, policy.ConflictsOf(auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: "auditor"}))
+
+	policy.Conflicts = append(policy.Conflicts, auth.DutyConflict{Name: "owner-auditor", RoleTemplates: []string{"a", "b"}})
+	assert.Error(t, policy.Validate())
+	policy.Conflicts = []auth.DutyConflict{{Name: "duplicate", RoleTemplates: []string{"auditor", "auditor"}}}
+	assert.Error(t, policy.Validate())
+	policy.Conflicts = []auth.DutyConflict{{RoleTemplates: []string{"auditor", "cluster-owner"}}}
+	assert.Error(t, policy.Validate())
+}
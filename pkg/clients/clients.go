@@ -2,19 +2,46 @@ package clients
 
 import (
 	"context"
+	"os"
+	"time"
 
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/controller"
 	"github.com/rancher/webhook/pkg/auth"
 	"github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io"
 	managementv3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/generated/controllers/provisioning.cattle.io"
 	provv1 "github.com/rancher/webhook/pkg/generated/controllers/provisioning.cattle.io/v1"
+	"github.com/rancher/webhook/pkg/resolvers"
 	"github.com/rancher/wrangler/v3/pkg/clients"
+	admissioncontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/admissionregistration.k8s.io/v1"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	rbaccontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/rbac/v1"
+	"github.com/rancher/wrangler/v3/pkg/generic"
+	"github.com/rancher/wrangler/v3/pkg/ratelimit"
 	"github.com/rancher/wrangler/v3/pkg/schemes"
 	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/kubernetes/pkg/registry/rbac/validation"
 )
 
+const (
+	// ConfigMapNamespace and ConfigMapName identify the ConfigMap configuring the webhook at runtime. It is the only
+	// ConfigMap read by the webhook, so the ConfigMap informer only watches it.
+	ConfigMapNamespace = "cattle-system"
+	ConfigMapName      = "rancher-webhook-config"
+)
+
+// ruleIndexSelfCheckEnvKey is the environment variable enabling the consistency check of the rule indexes of the
+// resolvers against the bindings on each lookup, when set to "true".
+const ruleIndexSelfCheckEnvKey = "CATTLE_WEBHOOK_RULE_INDEX_SELF_CHECK"
+
 type Clients struct {
 	clients.Clients
 
@@ -24,10 +51,22 @@ type Clients struct {
 	RoleTemplateResolver   *auth.RoleTemplateResolver
 	GlobalRoleResolver     *auth.GlobalRoleResolver
 	DefaultResolver        validation.AuthorizationRuleResolver
+	// CRTBResolver, PRTBResolver and GRBResolvers are shared by the handlers and the permissions endpoint, since their
+	// cache indexers can only be added once.
+	CRTBResolver *resolvers.CRTBRuleResolver
+	PRTBResolver *resolvers.PRTBRuleResolver
+	GRBResolvers *resolvers.GRBRuleResolvers
+	// SeparationOfDuties uses the subject indexes added by the CRTB, PRTB and GRB resolvers.
+	SeparationOfDuties *resolvers.SeparationOfDuties
 }
 
 func New(ctx context.Context, rest *rest.Config, mcmEnabled bool) (*Clients, error) {
-	clients, err := clients.NewFromConfig(rest, nil)
+	controllerFactory, err := newControllerFactory(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := clients.NewFromConfig(rest, &generic.FactoryOptions{SharedControllerFactory: controllerFactory})
 	if err != nil {
 		return nil, err
 	}
@@ -50,24 +89,90 @@ func New(ctx context.Context, rest *rest.Config, mcmEnabled bool) (*Clients, err
 		return nil, err
 	}
 
+	return newClients(*clients, mgmt.Management().V3(), prov.Provisioning().V1(), mcmEnabled)
+}
+
+// newControllerFactory returns the factory of the controllers of the webhook, like the one created by
+// clients.NewFromConfig, except that the ConfigMap informer is scoped to the ConfigMap configuring the webhook.
+func newControllerFactory(cfg *rest.Config) (controller.SharedControllerFactory, error) {
+	cfg = rest.CopyConfig(cfg)
+	cfg.Timeout = 15 * time.Minute
+	cfg.RateLimiter = ratelimit.None
+
+	clientFactory, err := client.NewSharedClientFactory(cfg, &client.SharedClientFactoryOptions{Scheme: schemes.All})
+	if err != nil {
+		return nil, err
+	}
+	configMapGVK := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	cacheFactory := cache.NewSharedCachedFactory(clientFactory, &cache.SharedCacheFactoryOptions{
+		KindNamespace: map[schema.GroupVersionKind]string{configMapGVK: ConfigMapNamespace},
+		KindTweakList: map[schema.GroupVersionKind]cache.TweakListOptionsFunc{
+			configMapGVK: func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", ConfigMapName).String()
+			},
+		},
+	})
+	return controller.NewSharedControllerFactory(cacheFactory, nil), nil
+}
+
+// NewFromControllerFactory returns Clients whose controllers are created by the given factory. Unlike New, it does not
+// connect to an apiserver or start any controller, which allows running the webhook handlers offline.
+func NewFromControllerFactory(factory controller.SharedControllerFactory, k8s kubernetes.Interface, mcmEnabled bool) (*Clients, error) {
+	base := clients.Clients{
+		K8s:                     k8s,
+		Core:                    corecontrollers.New(factory),
+		RBAC:                    rbaccontrollers.New(factory),
+		Admission:               admissioncontrollers.New(factory),
+		SharedControllerFactory: factory,
+	}
+	return newClients(base, managementv3.New(factory), provv1.New(factory), mcmEnabled)
+}
+
+func newClients(base clients.Clients, mgmt managementv3.Interface, prov provv1.Interface, mcmEnabled bool) (*Clients, error) {
 	rbacRestGetter := auth.RBACRestGetter{
-		Roles:               clients.RBAC.Role().Cache(),
-		RoleBindings:        clients.RBAC.RoleBinding().Cache(),
-		ClusterRoles:        clients.RBAC.ClusterRole().Cache(),
-		ClusterRoleBindings: clients.RBAC.ClusterRoleBinding().Cache(),
+		Roles:               base.RBAC.Role().Cache(),
+		RoleBindings:        base.RBAC.RoleBinding().Cache(),
+		ClusterRoles:        base.RBAC.ClusterRole().Cache(),
+		ClusterRoleBindings: base.RBAC.ClusterRoleBinding().Cache(),
 	}
 
 	result := &Clients{
-		Clients:                *clients,
-		Management:             mgmt.Management().V3(),
-		Provisioning:           prov.Provisioning().V1(),
+		Clients:                base,
+		Management:             mgmt,
+		Provisioning:           prov,
 		MultiClusterManagement: mcmEnabled,
 		DefaultResolver:        validation.NewDefaultRuleResolver(rbacRestGetter, rbacRestGetter, rbacRestGetter, rbacRestGetter),
 	}
 
 	if mcmEnabled {
-		result.RoleTemplateResolver = auth.NewRoleTemplateResolver(mgmt.Management().V3().RoleTemplate().Cache(), clients.RBAC.ClusterRole().Cache())
-		result.GlobalRoleResolver = auth.NewGlobalRoleResolver(result.RoleTemplateResolver, mgmt.Management().V3().GlobalRole().Cache())
+		roleTemplateResolver, err := auth.NewMemoizedRoleTemplateResolver(mgmt.RoleTemplate(), base.RBAC.ClusterRole())
+		if err != nil {
+			return nil, err
+		}
+		result.RoleTemplateResolver = roleTemplateResolver
+		result.GlobalRoleResolver = auth.NewGlobalRoleResolver(result.RoleTemplateResolver, mgmt.GlobalRole().Cache())
+		result.CRTBResolver = resolvers.NewCRTBRuleResolver(mgmt.ClusterRoleTemplateBinding().Cache(), result.RoleTemplateResolver)
+		result.PRTBResolver = resolvers.NewPRTBRuleResolver(mgmt.ProjectRoleTemplateBinding().Cache(), result.RoleTemplateResolver)
+		result.GRBResolvers = resolvers.NewGRBRuleResolvers(mgmt.GlobalRoleBinding().Cache(), result.GlobalRoleResolver)
+		result.SeparationOfDuties = resolvers.NewSeparationOfDuties(mgmt.ClusterRoleTemplateBinding().Cache(),
+			mgmt.ProjectRoleTemplateBinding().Cache(), mgmt.GlobalRoleBinding().Cache(), mgmt.GlobalRole().Cache(),
+			mgmt.Project().Cache(), mgmt.User().Cache(), mgmt.UserAttribute().Cache())
+
+		indexOptions := resolvers.RuleIndexOptions{
+			RoleTemplates: mgmt.RoleTemplate().Informer(),
+			ClusterRoles:  base.RBAC.ClusterRole().Informer(),
+			GlobalRoles:   mgmt.GlobalRole().Informer(),
+			SelfCheck:     os.Getenv(ruleIndexSelfCheckEnvKey) == "true",
+		}
+		if err := result.CRTBResolver.EnableRuleIndex(mgmt.ClusterRoleTemplateBinding().Informer(), indexOptions); err != nil {
+			return nil, err
+		}
+		if err := result.PRTBResolver.EnableRuleIndex(mgmt.ProjectRoleTemplateBinding().Informer(), indexOptions); err != nil {
+			return nil, err
+		}
+		if err := result.GRBResolvers.EnableRuleIndex(mgmt.GlobalRoleBinding().Informer(), indexOptions); err != nil {
+			return nil, err
+		}
 	}
 
 	return result, nil
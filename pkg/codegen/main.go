@@ -17,11 +17,38 @@ import (
 	"golang.org/x/tools/imports"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type typeInfo struct {
 	Name, Type, Package string
+	// Resource is the resource of the type, and Scope the scope of its webhooks. They are only set for types with a
+	// typed validator.
+	Resource schema.GroupVersionResource
+	Scope    string
+	// Validator and PartialValidator tell whether the New<Type>Validator or New<Type>PartialValidator function is
+	// generated for the type.
+	Validator, PartialValidator bool
+}
+
+// withValidator wraps a type of generateObjectsFromRequest which gets a New<Type>Validator function.
+type withValidator struct {
+	object interface{}
+	// partial is set for types which get a New<Type>PartialValidator function instead.
+	partial bool
+}
+
+// validated opts the type of object in to a New<Type>Validator function.
+func validated(object interface{}) withValidator {
+	return withValidator{object: object}
+}
+
+// partiallyValidated opts the type of object in to a New<Type>PartialValidator function, whose validator decodes
+// partial views of the objects, e.g. for objects which may hold values the type can't decode.
+func partiallyValidated(object interface{}) withValidator {
+	return withValidator{object: object, partial: true}
 }
 
 func main() {
@@ -49,6 +76,7 @@ func main() {
 					v3.Feature{},
 					v3.Setting{},
 					v3.User{},
+					v3.UserAttribute{},
 				},
 			},
 			"provisioning.cattle.io": {
@@ -64,7 +92,9 @@ func main() {
 		},
 	})
 
-	// Generate the <TYPE>FromRequest and <TYPE>OldAndNewFromRequest functions to get the new and old objects from the webhook request.
+	// Generate the <TYPE>FromRequest and <TYPE>OldAndNewFromRequest functions to get the new and old objects from the webhook request,
+	// and, for the types opting in, the New<TYPE>Validator or New<TYPE>PartialValidator functions returning a TypedValidator
+	// for the resource of the type.
 	if err := generateObjectsFromRequest("pkg/generated/objects", map[string]args.Group{
 		"catalog.cattle.io": {
 			Types: []interface{}{
@@ -75,7 +105,7 @@ func main() {
 			Types: []interface{}{
 				&v3.Cluster{},
 				&v3.ClusterRoleTemplateBinding{},
-				&v3.Feature{},
+				validated(&v3.Feature{}),
 				&v3.FleetWorkspace{},
 				&v3.PodSecurityAdmissionConfigurationTemplate{},
 				&v3.GlobalRole{},
@@ -85,6 +115,8 @@ func main() {
 				&v3.NodeDriver{},
 				&v3.Project{},
 				&v3.Setting{},
+				partiallyValidated(&v3.Token{}),
+				partiallyValidated(&v3.UserAttribute{}),
 			},
 		},
 		"provisioning.cattle.io": {
@@ -103,7 +135,7 @@ func main() {
 			Types: []interface{}{
 				&rbacv1.Role{},
 				&rbacv1.RoleBinding{},
-				&rbacv1.ClusterRole{},
+				validated(&rbacv1.ClusterRole{}),
 				&rbacv1.ClusterRoleBinding{},
 			},
 		}}); err != nil {
@@ -115,12 +147,21 @@ func generateObjectsFromRequest(outputDir string, groups map[string]args.Group)
 	temp := template.Must(template.New("objectsFromRequest").Funcs(template.FuncMap{
 		"replace": strings.ReplaceAll,
 	}).Parse(objectsFromRequestTemplate))
+	scopes := scopeReader{}
 
 	for groupName, group := range groups {
 		var packageName string
+		apiGroup := groupName
+		if groupName == "core" {
+			apiGroup = ""
+		}
 		types := make([]typeInfo, 0, len(group.Types))
 
 		for _, t := range group.Types {
+			validator, hasValidator := t.(withValidator)
+			if hasValidator {
+				t = validator.object
+			}
 			rt := reflect.TypeOf(t)
 			ti := typeInfo{
 				Type: rt.String(),
@@ -133,6 +174,22 @@ func generateObjectsFromRequest(outputDir string, groups map[string]args.Group)
 			ti.Package = rt.PkgPath()
 			ti.Name = rt.Name()
 			packageName = path.Base(ti.Package)
+			if hasValidator {
+				ti.Validator, ti.PartialValidator = !validator.partial, validator.partial
+				ti.Resource, _ = meta.UnsafeGuessKindToResource(schema.GroupVersionKind{
+					Group:   apiGroup,
+					Version: packageName,
+					Kind:    ti.Name,
+				})
+				namespaced, err := scopes.namespaced(rt)
+				if err != nil {
+					return err
+				}
+				ti.Scope = "ClusterScope"
+				if namespaced {
+					ti.Scope = "NamespacedScope"
+				}
+			}
 			types = append(types, ti)
 		}
 
@@ -141,9 +198,14 @@ func generateObjectsFromRequest(outputDir string, groups map[string]args.Group)
 			return err
 		}
 
+		validators := false
+		for _, ti := range types {
+			validators = validators || ti.Validator || ti.PartialValidator
+		}
 		data := map[string]interface{}{
-			"types":   types,
-			"package": packageName,
+			"types":      types,
+			"package":    packageName,
+			"validators": validators,
 		}
 
 		var content bytes.Buffer
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// nonNamespacedTag is the client-gen tag of the types of cluster-scoped resources, which controller-gen also reads to
+// generate their controllers.
+const nonNamespacedTag = "+genclient:nonNamespaced"
+
+// scopeReader reads the scope of resource types from the tags of their declarations, loading each package once.
+type scopeReader map[string]*packages.Package
+
+// namespaced returns whether the resource of the type is namespaced, i.e. whether its declaration lacks the
+// +genclient:nonNamespaced tag. Like for client-gen, the tag is read from the doc comment of the type, or from the
+// comment separated from it by a blank line.
+func (s scopeReader) namespaced(rt reflect.Type) (bool, error) {
+	pkg, ok := s[rt.PkgPath()]
+	if !ok {
+		pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax}, rt.PkgPath())
+		if err != nil {
+			return false, fmt.Errorf("failed to load package %s: %w", rt.PkgPath(), err)
+		}
+		if len(pkgs) != 1 || len(pkgs[0].Errors) > 0 {
+			return false, fmt.Errorf("failed to load package %s: %v", rt.PkgPath(), pkgs)
+		}
+		pkg = pkgs[0]
+		s[rt.PkgPath()] = pkg
+	}
+
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				if spec.(*ast.TypeSpec).Name.Name != rt.Name() {
+					continue
+				}
+				for _, comments := range typeComments(pkg.Fset, file, genDecl) {
+					for _, comment := range comments.List {
+						if strings.TrimSpace(strings.TrimPrefix(comment.Text, "//")) == nonNamespacedTag {
+							return false, nil
+						}
+					}
+				}
+				return true, nil
+			}
+		}
+	}
+	return false, fmt.Errorf("type %s not found in package %s", rt.Name(), rt.PkgPath())
+}
+
+// typeComments returns the doc comment of the declaration and the comment ending one blank line before it.
+func typeComments(fset *token.FileSet, file *ast.File, decl *ast.GenDecl) []*ast.CommentGroup {
+	start := decl.Pos()
+	var comments []*ast.CommentGroup
+	if decl.Doc != nil {
+		start = decl.Doc.Pos()
+		comments = append(comments, decl.Doc)
+	}
+	startLine := fset.Position(start).Line
+	for _, group := range file.Comments {
+		if fset.Position(group.End()).Line == startLine-2 {
+			comments = append(comments, group)
+		}
+	}
+	return comments
+}
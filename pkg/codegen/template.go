@@ -9,7 +9,12 @@ import (
 
 	{{ range .types }}
 	"{{ .Package }}"{{ end }}
+	{{- if .validators }}
+	"github.com/rancher/webhook/pkg/admission"{{ end }}
 	admissionv1 "k8s.io/api/admission/v1"
+	{{- if .validators }}
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"{{ end }}
 )
 {{ range .types }}
 
@@ -65,5 +70,34 @@ func {{ .Name }}FromRequest(request *admissionv1.AdmissionRequest) ({{ .Type }},
 
 	return object, nil
 }
-{{ end }}
+{{ if .Validator }}
+// New{{ .Name }}Validator returns a TypedValidator for the {{ .Resource.Resource }} resource, with a {{ .Scope }} webhook,
+// decoding the objects of requests with {{ .Name }}OldAndNewFromRequest. Callers set its callbacks.
+func New{{ .Name }}Validator() *admission.TypedValidator[{{ .Type }}] {
+	return &admission.TypedValidator[{{ .Type }}]{
+		Resource: schema.GroupVersionResource{
+			Group:    "{{ .Resource.Group }}",
+			Version:  "{{ .Resource.Version }}",
+			Resource: "{{ .Resource.Resource }}",
+		},
+		Scope:  admissionregistrationv1.{{ .Scope }},
+		Decode: {{ .Name }}OldAndNewFromRequest,
+	}
+}
+{{ end }}{{ if .PartialValidator }}
+// New{{ .Name }}PartialValidator returns a TypedValidator for the {{ .Resource.Resource }} resource, with a {{ .Scope }} webhook,
+// decoding the objects of requests as partial views of type P, e.g. for objects which may hold values {{ .Name }} can't
+// decode. Callers set its callbacks.
+func New{{ .Name }}PartialValidator[P any]() *admission.TypedValidator[*P] {
+	return &admission.TypedValidator[*P]{
+		Resource: schema.GroupVersionResource{
+			Group:    "{{ .Resource.Group }}",
+			Version:  "{{ .Resource.Version }}",
+			Resource: "{{ .Resource.Resource }}",
+		},
+		Scope:  admissionregistrationv1.{{ .Scope }},
+		Decode: admission.DecodeOldAndNewFromRequest[P],
+	}
+}
+{{ end }}{{ end }}
 `
@@ -5,7 +5,10 @@ import (
 	"fmt"
 
 	"github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/admission"
 	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // ClusterOldAndNewFromRequest gets the old and new Cluster objects, respectively, from the webhook request.
@@ -167,6 +170,20 @@ func FeatureFromRequest(request *admissionv1.AdmissionRequest) (*v3.Feature, err
 	return object, nil
 }
 
+// NewFeatureValidator returns a TypedValidator for the features resource, with a ClusterScope webhook,
+// decoding the objects of requests with FeatureOldAndNewFromRequest. Callers set its callbacks.
+func NewFeatureValidator() *admission.TypedValidator[*v3.Feature] {
+	return &admission.TypedValidator[*v3.Feature]{
+		Resource: schema.GroupVersionResource{
+			Group:    "management.cattle.io",
+			Version:  "v3",
+			Resource: "features",
+		},
+		Scope:  admissionregistrationv1.ClusterScope,
+		Decode: FeatureOldAndNewFromRequest,
+	}
+}
+
 // FleetWorkspaceOldAndNewFromRequest gets the old and new FleetWorkspace objects, respectively, from the webhook request.
 // If the request is a Delete operation, then the new object is the zero value for FleetWorkspace.
 // Similarly, if the request is a Create operation, then the old object is the zero value for FleetWorkspace.
@@ -643,3 +660,139 @@ func SettingFromRequest(request *admissionv1.AdmissionRequest) (*v3.Setting, err
 
 	return object, nil
 }
+
+// TokenOldAndNewFromRequest gets the old and new Token objects, respectively, from the webhook request.
+// If the request is a Delete operation, then the new object is the zero value for Token.
+// Similarly, if the request is a Create operation, then the old object is the zero value for Token.
+func TokenOldAndNewFromRequest(request *admissionv1.AdmissionRequest) (*v3.Token, *v3.Token, error) {
+	if request == nil {
+		return nil, nil, fmt.Errorf("nil request")
+	}
+
+	object := &v3.Token{}
+	oldObject := &v3.Token{}
+
+	if request.Operation != admissionv1.Delete {
+		err := json.Unmarshal(request.Object.Raw, object)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+		}
+	}
+
+	if request.Operation == admissionv1.Create {
+		return oldObject, object, nil
+	}
+
+	err := json.Unmarshal(request.OldObject.Raw, oldObject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal request oldObject: %w", err)
+	}
+
+	return oldObject, object, nil
+}
+
+// TokenFromRequest returns a Token object from the webhook request.
+// If the operation is a Delete operation, then the old object is returned.
+// Otherwise, the new object is returned.
+func TokenFromRequest(request *admissionv1.AdmissionRequest) (*v3.Token, error) {
+	if request == nil {
+		return nil, fmt.Errorf("nil request")
+	}
+
+	object := &v3.Token{}
+	raw := request.Object.Raw
+
+	if request.Operation == admissionv1.Delete {
+		raw = request.OldObject.Raw
+	}
+
+	err := json.Unmarshal(raw, object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+	}
+
+	return object, nil
+}
+
+// NewTokenPartialValidator returns a TypedValidator for the tokens resource, with a ClusterScope webhook,
+// decoding the objects of requests as partial views of type P, e.g. for objects which may hold values Token can't
+// decode. Callers set its callbacks.
+func NewTokenPartialValidator[P any]() *admission.TypedValidator[*P] {
+	return &admission.TypedValidator[*P]{
+		Resource: schema.GroupVersionResource{
+			Group:    "management.cattle.io",
+			Version:  "v3",
+			Resource: "tokens",
+		},
+		Scope:  admissionregistrationv1.ClusterScope,
+		Decode: admission.DecodeOldAndNewFromRequest[P],
+	}
+}
+
+// UserAttributeOldAndNewFromRequest gets the old and new UserAttribute objects, respectively, from the webhook request.
+// If the request is a Delete operation, then the new object is the zero value for UserAttribute.
+// Similarly, if the request is a Create operation, then the old object is the zero value for UserAttribute.
+func UserAttributeOldAndNewFromRequest(request *admissionv1.AdmissionRequest) (*v3.UserAttribute, *v3.UserAttribute, error) {
+	if request == nil {
+		return nil, nil, fmt.Errorf("nil request")
+	}
+
+	object := &v3.UserAttribute{}
+	oldObject := &v3.UserAttribute{}
+
+	if request.Operation != admissionv1.Delete {
+		err := json.Unmarshal(request.Object.Raw, object)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+		}
+	}
+
+	if request.Operation == admissionv1.Create {
+		return oldObject, object, nil
+	}
+
+	err := json.Unmarshal(request.OldObject.Raw, oldObject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal request oldObject: %w", err)
+	}
+
+	return oldObject, object, nil
+}
+
+// UserAttributeFromRequest returns a UserAttribute object from the webhook request.
+// If the operation is a Delete operation, then the old object is returned.
+// Otherwise, the new object is returned.
+func UserAttributeFromRequest(request *admissionv1.AdmissionRequest) (*v3.UserAttribute, error) {
+	if request == nil {
+		return nil, fmt.Errorf("nil request")
+	}
+
+	object := &v3.UserAttribute{}
+	raw := request.Object.Raw
+
+	if request.Operation == admissionv1.Delete {
+		raw = request.OldObject.Raw
+	}
+
+	err := json.Unmarshal(raw, object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request object: %w", err)
+	}
+
+	return object, nil
+}
+
+// NewUserAttributePartialValidator returns a TypedValidator for the userattributes resource, with a ClusterScope webhook,
+// decoding the objects of requests as partial views of type P, e.g. for objects which may hold values UserAttribute can't
+// decode. Callers set its callbacks.
+func NewUserAttributePartialValidator[P any]() *admission.TypedValidator[*P] {
+	return &admission.TypedValidator[*P]{
+		Resource: schema.GroupVersionResource{
+			Group:    "management.cattle.io",
+			Version:  "v3",
+			Resource: "userattributes",
+		},
+		Scope:  admissionregistrationv1.ClusterScope,
+		Decode: admission.DecodeOldAndNewFromRequest[P],
+	}
+}
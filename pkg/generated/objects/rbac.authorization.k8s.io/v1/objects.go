@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/rancher/webhook/pkg/admission"
 	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // RoleOldAndNewFromRequest gets the old and new Role objects, respectively, from the webhook request.
@@ -167,6 +170,20 @@ func ClusterRoleFromRequest(request *admissionv1.AdmissionRequest) (*v1.ClusterR
 	return object, nil
 }
 
+// NewClusterRoleValidator returns a TypedValidator for the clusterroles resource, with a ClusterScope webhook,
+// decoding the objects of requests with ClusterRoleOldAndNewFromRequest. Callers set its callbacks.
+func NewClusterRoleValidator() *admission.TypedValidator[*v1.ClusterRole] {
+	return &admission.TypedValidator[*v1.ClusterRole]{
+		Resource: schema.GroupVersionResource{
+			Group:    "rbac.authorization.k8s.io",
+			Version:  "v1",
+			Resource: "clusterroles",
+		},
+		Scope:  admissionregistrationv1.ClusterScope,
+		Decode: ClusterRoleOldAndNewFromRequest,
+	}
+}
+
 // ClusterRoleBindingOldAndNewFromRequest gets the old and new ClusterRoleBinding objects, respectively, from the webhook request.
 // If the request is a Delete operation, then the new object is the zero value for ClusterRoleBinding.
 // Similarly, if the request is a Create operation, then the old object is the zero value for ClusterRoleBinding.
@@ -8,15 +8,39 @@ import (
 
 	"github.com/gorilla/mux"
 	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/tools/cache"
 )
 
-var errNotReady = fmt.Errorf("not ready")
+var (
+	errNotReady  = fmt.Errorf("not ready")
+	errNotSynced = fmt.Errorf("cache not synced")
+)
 
 // RegisterHealthCheckers adds the healthz endpoint to the webhook.
 func RegisterHealthCheckers(router *mux.Router, checkers ...healthz.HealthChecker) {
 	healthz.InstallHandler(&muxWrapper{router}, checkers...)
 }
 
+// RegisterReadinessCheckers adds the readyz endpoint to the webhook.
+func RegisterReadinessCheckers(router *mux.Router, checkers ...healthz.HealthChecker) {
+	healthz.InstallReadyzHandler(&muxWrapper{router}, checkers...)
+}
+
+// RegisterLivenessCheckers adds the livez endpoint to the webhook.
+func RegisterLivenessCheckers(router *mux.Router, checkers ...healthz.HealthChecker) {
+	healthz.InstallLivezHandler(&muxWrapper{router}, checkers...)
+}
+
+// NewInformerSyncChecker returns a HealthChecker that reports an error until the given informer has synced.
+func NewInformerSyncChecker(name string, informer cache.SharedIndexInformer) healthz.HealthChecker {
+	return healthz.NamedCheck(name, func(_ *http.Request) error {
+		if !informer.HasSynced() {
+			return errNotSynced
+		}
+		return nil
+	})
+}
+
 // NewErrorChecker returns a new error checker initialized with a "not ready" error
 func NewErrorChecker(name string) *ErrorChecker {
 	return &ErrorChecker{
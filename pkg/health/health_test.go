@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+)
+
+func TestReadinessCheckers(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(fcache.NewFakeControllerSource(), &corev1.Secret{}, 0, cache.Indexers{})
+	configApplied := NewErrorChecker("Config Applied")
+	configApplied.Store(nil)
+
+	router := mux.NewRouter()
+	RegisterReadinessCheckers(router, configApplied, NewInformerSyncChecker("cache-sync-secrets", informer))
+	RegisterLivenessCheckers(router)
+
+	code, body := get(router, "/readyz?verbose")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "[+]Config Applied ok")
+	assert.Contains(t, body, "[-]cache-sync-secrets failed")
+
+	// liveness does not depend on the caches
+	code, _ = get(router, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go informer.Run(ctx.Done())
+	require.Eventually(t, informer.HasSynced, 5*time.Second, 10*time.Millisecond)
+
+	code, body = get(router, "/readyz?verbose")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "[+]cache-sync-secrets ok")
+}
+
+func get(handler http.Handler, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code, recorder.Body.String()
+}
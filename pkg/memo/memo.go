@@ -0,0 +1,227 @@
+// Package memo memoizes values computed from the objects of informer caches, and invalidates them when these objects change.
+package memo
+
+import (
+	"container/list"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultMaxEntries is the default number of values held by a Memo.
+const DefaultMaxEntries = 10000
+
+// Dependency identifies an object a memoized value was computed from, e.g. {Kind: "RoleTemplate", Name: "cluster-owner"}.
+type Dependency struct {
+	Kind string
+	Name string
+}
+
+// Memo holds values by key, along with the dependencies they were computed from. Changing a dependency only removes
+// the values which depend on it, found through a reverse index. Once the Memo holds maxEntries values, storing a value
+// removes the least recently used one.
+//
+// Values computed while one of their dependencies changed are not stored, so that they are not held after the
+// invalidation which should have removed them: callers read the Generation before computing a value and pass it to Store.
+type Memo[V any] struct {
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+	// dependents holds the keys of the values depending on each dependency.
+	dependents map[Dependency]sets.Set[string]
+	generation uint64
+	// invalidated holds the generation of the last invalidation of each dependency. It is bounded by maxEntries: once
+	// full, it is cleared and storedSince is raised to the current generation.
+	invalidated map[Dependency]uint64
+	// storedSince is the earliest generation whose values can be stored.
+	storedSince uint64
+	// onInvalidate holds the functions registered with OnInvalidate.
+	onInvalidate []func(Dependency)
+}
+
+type entry[V any] struct {
+	key          string
+	value        V
+	dependencies []Dependency
+}
+
+// New returns an empty Memo holding up to maxEntries values, or DefaultMaxEntries if maxEntries is not positive.
+func New[V any](maxEntries int) *Memo[V] {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Memo[V]{
+		maxEntries:  maxEntries,
+		entries:     map[string]*list.Element{},
+		recent:      list.New(),
+		dependents:  map[Dependency]sets.Set[string]{},
+		invalidated: map[Dependency]uint64{},
+	}
+}
+
+// Get returns the value held for the key, if any.
+func (m *Memo[V]) Get(key string) (V, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	m.recent.MoveToFront(element)
+	return element.Value.(*entry[V]).value, true
+}
+
+// Generation returns the generation to pass to Store for the values computed from now on.
+func (m *Memo[V]) Generation() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.generation
+}
+
+// Store holds the value computed from the given dependencies for the key, unless one of the dependencies was
+// invalidated since generation was read. It returns whether the value was stored.
+func (m *Memo[V]) Store(key string, value V, dependencies []Dependency, generation uint64) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if generation < m.storedSince {
+		return false
+	}
+	for _, dependency := range dependencies {
+		if m.invalidated[dependency] > generation {
+			return false
+		}
+	}
+	m.remove(key)
+	m.entries[key] = m.recent.PushFront(&entry[V]{key: key, value: value, dependencies: dependencies})
+	for _, dependency := range dependencies {
+		if m.dependents[dependency] == nil {
+			m.dependents[dependency] = sets.New[string]()
+		}
+		m.dependents[dependency].Insert(key)
+	}
+	for m.recent.Len() > m.maxEntries {
+		m.remove(m.recent.Back().Value.(*entry[V]).key)
+	}
+	return true
+}
+
+// Invalidate removes the values depending on the given dependency, then calls the functions registered with
+// OnInvalidate.
+func (m *Memo[V]) Invalidate(dependency Dependency) {
+	for _, f := range m.invalidate(dependency) {
+		f(dependency)
+	}
+}
+
+// OnInvalidate registers a function called with each invalidated dependency, once the values depending on it were
+// removed. Values computed from the values of the Memo, e.g. held by another Memo, must be invalidated this way rather
+// than by event handlers of their own: the event handlers of an informer run in no fixed order, so a value computed
+// between the two invalidations could be computed from a stale value, and outlive both.
+func (m *Memo[V]) OnInvalidate(f func(Dependency)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.onInvalidate = append(m.onInvalidate, f)
+}
+
+// invalidate removes the values depending on the dependency and returns the functions to call.
+func (m *Memo[V]) invalidate(dependency Dependency) []func(Dependency) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.generation++
+	if len(m.invalidated) >= m.maxEntries {
+		m.invalidated = map[Dependency]uint64{}
+		m.storedSince = m.generation
+	}
+	m.invalidated[dependency] = m.generation
+	for key := range m.dependents[dependency] {
+		m.remove(key)
+	}
+	return m.onInvalidate
+}
+
+// Remove removes the value held for the key, if any.
+func (m *Memo[V]) Remove(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.remove(key)
+}
+
+// Len returns the number of values held.
+func (m *Memo[V]) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.recent.Len()
+}
+
+func (m *Memo[V]) remove(key string) {
+	element, ok := m.entries[key]
+	if !ok {
+		return
+	}
+	delete(m.entries, key)
+	m.recent.Remove(element)
+	for _, dependency := range element.Value.(*entry[V]).dependencies {
+		dependents := m.dependents[dependency]
+		dependents.Delete(key)
+		if dependents.Len() == 0 {
+			delete(m.dependents, dependency)
+		}
+	}
+}
+
+// EventHandler returns an informer event handler invalidating the dependencies returned by dependencies for the
+// objects which are added, deleted, or updated to a new resourceVersion. Updates invalidate the dependencies of both
+// the old and the new object, since they may differ.
+func (m *Memo[V]) EventHandler(dependencies func(obj any) []Dependency) cache.ResourceEventHandler {
+	invalidate := func(obj any) {
+		for _, dependency := range dependencies(obj) {
+			m.Invalidate(dependency)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: invalidate,
+		UpdateFunc: func(oldObj, newObj any) {
+			if sameResourceVersion(oldObj, newObj) {
+				// periodic resyncs do not change the object
+				return
+			}
+			invalidate(oldObj)
+			invalidate(newObj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			invalidate(obj)
+		},
+	}
+}
+
+// ByName returns a function returning the Dependency of the given kind named after an object, for EventHandler.
+func ByName(kind string) func(obj any) []Dependency {
+	return func(obj any) []Dependency {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil
+		}
+		return []Dependency{{Kind: kind, Name: accessor.GetName()}}
+	}
+}
+
+func sameResourceVersion(oldObj, newObj any) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
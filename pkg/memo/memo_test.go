@@ -0,0 +1,141 @@
+package memo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	readTemplate  = Dependency{Kind: "RoleTemplate", Name: "read"}
+	writeTemplate = Dependency{Kind: "RoleTemplate", Name: "write"}
+)
+
+func TestMemoInvalidate(t *testing.T) {
+	t.Parallel()
+	memo := New[string](0)
+	assert.True(t, memo.Store("a", "read", []Dependency{readTemplate}, memo.Generation()))
+	assert.True(t, memo.Store("b", "read-write", []Dependency{readTemplate, writeTemplate}, memo.Generation()))
+	assert.True(t, memo.Store("c", "write", []Dependency{writeTemplate}, memo.Generation()))
+
+	value, ok := memo.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "read", value)
+
+	// only the values depending on the invalidated dependency are removed
+	memo.Invalidate(readTemplate)
+	_, ok = memo.Get("a")
+	assert.False(t, ok)
+	_, ok = memo.Get("b")
+	assert.False(t, ok)
+	value, ok = memo.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "write", value)
+	assert.Equal(t, 1, memo.Len())
+
+	// unknown dependencies are ignored
+	memo.Invalidate(Dependency{Kind: "GlobalRole", Name: "admin"})
+	assert.Equal(t, 1, memo.Len())
+
+	memo.Remove("c")
+	assert.Equal(t, 0, memo.Len())
+	assert.Empty(t, memo.dependents)
+}
+
+func TestMemoStoreAfterInvalidation(t *testing.T) {
+	t.Parallel()
+	memo := New[string](0)
+	generation := memo.Generation()
+
+	// a value computed while one of its dependencies changed is not stored
+	memo.Invalidate(readTemplate)
+	assert.False(t, memo.Store("a", "read", []Dependency{readTemplate}, generation))
+	_, ok := memo.Get("a")
+	assert.False(t, ok)
+
+	// values whose dependencies did not change are stored
+	assert.True(t, memo.Store("b", "write", []Dependency{writeTemplate}, generation))
+	assert.True(t, memo.Store("a", "read", []Dependency{readTemplate}, memo.Generation()))
+}
+
+func TestMemoOnInvalidate(t *testing.T) {
+	t.Parallel()
+	memo := New[string](0)
+	dependent := New[string](0)
+	memo.OnInvalidate(dependent.Invalidate)
+	var invalidated []Dependency
+	memo.OnInvalidate(func(dependency Dependency) {
+		// the values depending on the dependency are removed before the functions are called
+		_, ok := memo.Get("a")
+		assert.False(t, ok)
+		invalidated = append(invalidated, dependency)
+	})
+	assert.True(t, memo.Store("a", "read", []Dependency{readTemplate}, memo.Generation()))
+	assert.True(t, dependent.Store("b", "read", []Dependency{readTemplate}, dependent.Generation()))
+
+	memo.Invalidate(readTemplate)
+	assert.Equal(t, []Dependency{readTemplate}, invalidated)
+	assert.Equal(t, 0, dependent.Len())
+}
+
+func TestMemoMaxEntries(t *testing.T) {
+	t.Parallel()
+	memo := New[string](2)
+	assert.True(t, memo.Store("a", "a", []Dependency{readTemplate}, memo.Generation()))
+	assert.True(t, memo.Store("b", "b", []Dependency{readTemplate}, memo.Generation()))
+	// reading a makes b the least recently used value
+	_, ok := memo.Get("a")
+	assert.True(t, ok)
+	assert.True(t, memo.Store("c", "c", []Dependency{writeTemplate}, memo.Generation()))
+
+	assert.Equal(t, 2, memo.Len())
+	_, ok = memo.Get("b")
+	assert.False(t, ok)
+	_, ok = memo.Get("a")
+	assert.True(t, ok)
+	_, ok = memo.Get("c")
+	assert.True(t, ok)
+	assert.Len(t, memo.dependents[readTemplate], 1)
+
+	// invalidations are tracked up to the maximum number of entries, after which older generations can not be stored
+	generation := memo.Generation()
+	memo.Invalidate(Dependency{Kind: "GlobalRole", Name: "a"})
+	memo.Invalidate(Dependency{Kind: "GlobalRole", Name: "b"})
+	memo.Invalidate(Dependency{Kind: "GlobalRole", Name: "c"})
+	assert.LessOrEqual(t, len(memo.invalidated), 2)
+	assert.False(t, memo.Store("d", "d", []Dependency{writeTemplate}, generation))
+	assert.True(t, memo.Store("d", "d", []Dependency{writeTemplate}, memo.Generation()))
+}
+
+func TestMemoEventHandler(t *testing.T) {
+	t.Parallel()
+	memo := New[string](0)
+	handler := memo.EventHandler(ByName("ConfigMap"))
+	configMap := func(name, resourceVersion string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: resourceVersion}}
+	}
+	dependency := Dependency{Kind: "ConfigMap", Name: "a"}
+	store := func() {
+		t.Helper()
+		assert.True(t, memo.Store("key", "value", []Dependency{dependency}, memo.Generation()))
+	}
+
+	store()
+	handler.OnAdd(configMap("b", "1"), false)
+	assert.Equal(t, 1, memo.Len(), "other objects do not invalidate the value")
+	handler.OnAdd(configMap("a", "1"), false)
+	assert.Equal(t, 0, memo.Len())
+
+	store()
+	handler.OnUpdate(configMap("a", "1"), configMap("a", "1"))
+	assert.Equal(t, 1, memo.Len(), "resyncs do not invalidate the value")
+	handler.OnUpdate(configMap("a", "1"), configMap("a", "2"))
+	assert.Equal(t, 0, memo.Len())
+
+	store()
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "a", Obj: configMap("a", "2")})
+	assert.Equal(t, 0, memo.Len())
+}
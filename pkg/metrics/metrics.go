@@ -0,0 +1,76 @@
+// Package metrics holds the prometheus metrics exposed by the webhook.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rancher_webhook"
+
+// Result is the outcome of an admission decision.
+type Result string
+
+const (
+	// ResultAllowed is recorded when the request was allowed.
+	ResultAllowed Result = "allowed"
+	// ResultDenied is recorded when the request was denied.
+	ResultDenied Result = "denied"
+	// ResultError is recorded when the request could not be evaluated.
+	ResultError Result = "error"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	admitterDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admitter_decisions_total",
+		Help:      "Number of admission decisions made by each admitter.",
+	}, []string{"gvr", "operation", "admitter", "result"})
+
+	admitterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admitter_duration_seconds",
+		Help:      "Time taken by each admitter to evaluate a request.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"gvr", "operation", "admitter"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admission_request_duration_seconds",
+		Help:      "Time taken to respond to an AdmissionReview, including decoding and every admitter.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"webhook", "gvr", "operation", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		admitterDecisions,
+		admitterDuration,
+		requestDuration,
+	)
+}
+
+// Handler returns the http.Handler serving the webhook metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RecordAdmitter records the result and duration of a single admitter evaluating a request.
+func RecordAdmitter(gvr, operation, admitter string, result Result, duration time.Duration) {
+	admitterDecisions.WithLabelValues(gvr, operation, admitter, string(result)).Inc()
+	admitterDuration.WithLabelValues(gvr, operation, admitter).Observe(duration.Seconds())
+}
+
+// RecordRequest records the result and duration of an entire AdmissionReview for a webhook.
+// webhook should be either "validating" or "mutating".
+func RecordRequest(webhook, gvr, operation string, result Result, duration time.Duration) {
+	requestDuration.WithLabelValues(webhook, gvr, operation, string(result)).Observe(duration.Seconds())
+}
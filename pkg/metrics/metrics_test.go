@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAdmitter(t *testing.T) {
+	const gvr = "roletemplates.management.cattle.io"
+	counter := admitterDecisions.WithLabelValues(gvr, "CREATE", "roletemplate.admitter", string(ResultDenied))
+	before := testutil.ToFloat64(counter)
+
+	RecordAdmitter(gvr, "CREATE", "roletemplate.admitter", ResultDenied, 25*time.Millisecond)
+	RecordAdmitter(gvr, "CREATE", "roletemplate.admitter", ResultDenied, 50*time.Millisecond)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(counter))
+	assert.Equal(t, 0.0, testutil.ToFloat64(admitterDecisions.WithLabelValues(gvr, "CREATE", "roletemplate.admitter", string(ResultError))))
+}
+
+func TestHandler(t *testing.T) {
+	RecordAdmitter("features.management.cattle.io", "UPDATE", "feature.admitter", ResultAllowed, time.Millisecond)
+	RecordRequest("validating", "features.management.cattle.io", "UPDATE", ResultAllowed, time.Millisecond)
+
+	response := httptest.NewRecorder()
+	Handler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, response.Code)
+
+	body := response.Body.String()
+	for _, name := range []string{
+		"rancher_webhook_admitter_decisions_total",
+		"rancher_webhook_admitter_duration_seconds_bucket",
+		"rancher_webhook_admission_request_duration_seconds_bucket",
+		"go_goroutines",
+	} {
+		assert.True(t, strings.Contains(body, name), "expected metric %s to be exposed", name)
+	}
+}
@@ -0,0 +1,211 @@
+// Package permissions serves the effective Rancher permissions of users, as resolved by the rule resolvers used in the
+// escalation checks of the webhook.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rancher/webhook/pkg/resolvers"
+	"github.com/sirupsen/logrus"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	authenticationv1 "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/kubernetes/pkg/registry/rbac/validation"
+)
+
+const (
+	// ViewPermissionsVerb is the verb callers need on a user, in the users.management.cattle.io resource, to get its
+	// permissions.
+	ViewPermissionsVerb = "view-permissions"
+	// ScopeCluster is the scope of the rules granted in a whole cluster.
+	ScopeCluster = "cluster"
+	// ScopeProject is the scope of the rules granted in a project.
+	ScopeProject = "project"
+)
+
+var usersGVR = schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "users"}
+
+// Response is the body returned by the permissions endpoint.
+type Response struct {
+	User    string   `json:"user"`
+	Groups  []string `json:"groups,omitempty"`
+	Cluster string   `json:"cluster"`
+	Project string   `json:"project,omitempty"`
+	Rules   []Rule   `json:"rules"`
+	// Errors holds the errors met while resolving the rules, in which case Rules may be incomplete.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Rule is a rule granted to the user, along with where it comes from.
+type Rule struct {
+	rbacv1.PolicyRule
+	// Scope is either ScopeCluster or ScopeProject.
+	Scope string `json:"scope"`
+	// Source describes the binding granting the rule and the role template or role holding it, e.g.
+	// "ClusterRoleTemplateBinding c-abc/crtb-xyz, RoleTemplate cluster-owner".
+	Source string `json:"source"`
+}
+
+// Handler serves the effective permissions of a user in a cluster or a project. The user and the scope are given as
+// query parameters: user, group (repeated for each group of the user), and either cluster, e.g. c-abc, or project,
+// e.g. c-abc:p-xyz.
+//
+// Callers authenticate with a bearer token, which is reviewed with a TokenReview, and must have the
+// ViewPermissionsVerb verb on the requested user.
+type Handler struct {
+	clusterResolver validation.AuthorizationRuleResolver
+	projectResolver validation.AuthorizationRuleResolver
+	tokenReview     authenticationv1.TokenReviewInterface
+	sar             authorizationv1.SubjectAccessReviewInterface
+}
+
+// NewHandler returns a Handler combining the rules granted through RBAC, ClusterRoleTemplateBindings,
+// ProjectRoleTemplateBindings and the inherited cluster roles of GlobalRoleBindings. Callers are authenticated with
+// tokenReview and authorized with sar.
+func NewHandler(defaultResolver validation.AuthorizationRuleResolver, crtbResolver *resolvers.CRTBRuleResolver,
+	prtbResolver *resolvers.PRTBRuleResolver, grbResolvers *resolvers.GRBRuleResolvers,
+	tokenReview authenticationv1.TokenReviewInterface, sar authorizationv1.SubjectAccessReviewInterface) *Handler {
+	return &Handler{
+		clusterResolver: resolvers.NewAggregateRuleResolver(defaultResolver, crtbResolver, grbResolvers.ICRResolver),
+		projectResolver: resolvers.NewAggregateRuleResolver(defaultResolver, prtbResolver),
+		tokenReview:     tokenReview,
+		sar:             sar,
+	}
+}
+
+// ServeHTTP writes the Response for the user and scope of the request.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	response := Response{
+		User:    query.Get("user"),
+		Groups:  query["group"],
+		Cluster: query.Get("cluster"),
+		Project: query.Get("project"),
+		Rules:   []Rule{},
+	}
+	if response.User == "" {
+		http.Error(w, "the user parameter is required", http.StatusBadRequest)
+		return
+	}
+	var projectNamespace string
+	switch {
+	case response.Cluster != "" && response.Project != "":
+		http.Error(w, "only one of the cluster and project parameters can be set", http.StatusBadRequest)
+		return
+	case response.Project != "":
+		var ok bool
+		response.Cluster, projectNamespace, ok = strings.Cut(response.Project, ":")
+		if !ok || response.Cluster == "" || projectNamespace == "" {
+			http.Error(w, fmt.Sprintf("invalid project '%s': must be of the form <cluster>:<project>", response.Project), http.StatusBadRequest)
+			return
+		}
+	case response.Cluster == "":
+		http.Error(w, "one of the cluster and project parameters is required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.authorized(w, r, response.User) {
+		return
+	}
+
+	userInfo := &user.DefaultInfo{Name: response.User, Groups: response.Groups}
+	h.clusterResolver.VisitRulesFor(userInfo, response.Cluster, response.visitor(ScopeCluster))
+	if projectNamespace != "" {
+		h.projectResolver.VisitRulesFor(userInfo, projectNamespace, response.visitor(ScopeProject))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logrus.Warnf("failed to encode permissions response: %v", err)
+	}
+}
+
+// authorized returns whether the caller of the request may get the permissions of the given user, and otherwise
+// writes the error response.
+func (h *Handler) authorized(w http.ResponseWriter, r *http.Request, username string) bool {
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	extra := make(map[string]authzv1.ExtraValue, len(caller.Extra))
+	for key, values := range caller.Extra {
+		extra[key] = authzv1.ExtraValue(values)
+	}
+	review, err := h.sar.Create(r.Context(), &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Verb:     ViewPermissionsVerb,
+				Group:    usersGVR.Group,
+				Version:  usersGVR.Version,
+				Resource: usersGVR.Resource,
+				Name:     username,
+			},
+			User:   caller.Username,
+			Groups: caller.Groups,
+			Extra:  extra,
+			UID:    caller.UID,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		logrus.Errorf("failed to authorize %s to get the permissions of %s: %v", caller.Username, username, err)
+		http.Error(w, "failed to authorize the request", http.StatusInternalServerError)
+		return false
+	}
+	if !review.Status.Allowed {
+		http.Error(w, fmt.Sprintf("%s is not allowed to %s on user %s", caller.Username, ViewPermissionsVerb, username), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authenticate returns the caller of the request as reviewed from its bearer token, and otherwise writes the error
+// response.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (authnv1.UserInfo, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+		return authnv1.UserInfo{}, false
+	}
+	review, err := h.tokenReview.Create(r.Context(), &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		logrus.Errorf("failed to review the token of a permissions request: %v", err)
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return authnv1.UserInfo{}, false
+	}
+	if !review.Status.Authenticated {
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return authnv1.UserInfo{}, false
+	}
+	return review.Status.User, true
+}
+
+// visitor returns a rule visitor adding the visited rules and errors to the response.
+func (r *Response) visitor(scope string) func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool {
+	return func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool {
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+		}
+		if rule != nil {
+			result := Rule{PolicyRule: *rule, Scope: scope}
+			if source != nil {
+				result.Source = source.String()
+			}
+			r.Rules = append(r.Rules, result)
+		}
+		return true
+	}
+}
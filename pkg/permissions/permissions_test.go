@@ -0,0 +1,250 @@
+package permissions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/resolvers"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	authnfake "k8s.io/client-go/kubernetes/typed/authentication/v1/fake"
+	k8fake "k8s.io/client-go/kubernetes/typed/authorization/v1/fake"
+	k8testing "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/registry/rbac/validation"
+)
+
+var (
+	readPods     = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}
+	createPods   = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}}
+	readProjects = rbacv1.PolicyRule{APIGroups: []string{"management.cattle.io"}, Resources: []string{"projects"}, Verbs: []string{"get"}}
+)
+
+func TestServeHTTP(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantRules []Rule
+	}{
+		{
+			name:  "cluster rules are attributed to their binding and template",
+			query: "user=u-1&cluster=c-1",
+			wantRules: []Rule{
+				{PolicyRule: readProjects, Scope: ScopeCluster, Source: "ClusterRoleTemplateBinding c-1/crtb-1, RoleTemplate cluster-member"},
+				{PolicyRule: readPods, Scope: ScopeCluster, Source: "ClusterRoleTemplateBinding c-1/crtb-1, RoleTemplate pod-reader"},
+			},
+		},
+		{
+			name:  "project rules are added to the rules of the cluster",
+			query: "user=u-1&project=c-1:p-1",
+			wantRules: []Rule{
+				{PolicyRule: readProjects, Scope: ScopeCluster, Source: "ClusterRoleTemplateBinding c-1/crtb-1, RoleTemplate cluster-member"},
+				{PolicyRule: readPods, Scope: ScopeCluster, Source: "ClusterRoleTemplateBinding c-1/crtb-1, RoleTemplate pod-reader"},
+				{PolicyRule: createPods, Scope: ScopeProject, Source: "ProjectRoleTemplateBinding p-1/prtb-1, RoleTemplate pod-creator"},
+			},
+		},
+		{
+			name:      "users without bindings have no rules",
+			query:     "user=u-2&cluster=c-1",
+			wantRules: []Rule{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, newRequest(http.MethodGet, test.query, "auditor"))
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			var response Response
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Empty(t, response.Errors)
+			assert.Equal(t, test.wantRules, response.Rules)
+		})
+	}
+}
+
+func TestServeHTTPInvalidRequests(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		wantCode int
+	}{
+		{name: "missing user", method: http.MethodGet, query: "cluster=c-1", wantCode: http.StatusBadRequest},
+		{name: "missing scope", method: http.MethodGet, query: "user=u-1", wantCode: http.StatusBadRequest},
+		{name: "cluster and project", method: http.MethodGet, query: "user=u-1&cluster=c-1&project=c-1:p-1", wantCode: http.StatusBadRequest},
+		{name: "project without cluster", method: http.MethodGet, query: "user=u-1&project=p-1", wantCode: http.StatusBadRequest},
+		{name: "post", method: http.MethodPost, query: "user=u-1&cluster=c-1", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, newRequest(test.method, test.query, "auditor"))
+			assert.Equal(t, test.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestServeHTTPAuthorization(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		caller   string
+		noToken  bool
+		wantCode int
+	}{
+		{name: "caller allowed for every user", query: "user=u-1&cluster=c-1", caller: "auditor", wantCode: http.StatusOK},
+		{name: "caller allowed for the user", query: "user=u-1&cluster=c-1", caller: "u-1-reader", wantCode: http.StatusOK},
+		{name: "caller not allowed for the user", query: "user=u-2&cluster=c-1", caller: "u-1-reader", wantCode: http.StatusForbidden},
+		{name: "caller allowed through its groups", query: "user=u-2&cluster=c-1", caller: "member-of-auditors", wantCode: http.StatusOK},
+		{name: "caller without token", query: "user=u-1&cluster=c-1", noToken: true, wantCode: http.StatusUnauthorized},
+		{name: "caller with invalid token", query: "user=u-1&cluster=c-1", caller: "unauthenticated", wantCode: http.StatusUnauthorized},
+		{name: "failed token review", query: "user=u-1&cluster=c-1", caller: "review-error", wantCode: http.StatusInternalServerError},
+		{name: "failed authorization", query: "user=u-1&cluster=c-1", caller: "error", wantCode: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := newRequest(http.MethodGet, test.query, test.caller)
+			if test.noToken {
+				request.Header.Del("Authorization")
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			assert.Equal(t, test.wantCode, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+// newRequest returns a request to the permissions endpoint made with the bearer token of the given caller.
+func newRequest(method, query, caller string) *http.Request {
+	request := httptest.NewRequest(method, "/v1/permissions?"+query, nil)
+	request.Header.Set("Authorization", "Bearer token-"+caller)
+	return request
+}
+
+// newTestHandler returns a Handler whose TokenReviews authenticate the token-<caller> tokens as the caller, with the
+// member-of-auditors caller in the auditors group, and whose SubjectAccessReviews allow the auditor user and the
+// auditors group to get the permissions of every user, and the u-1-reader user to get the permissions of u-1.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+
+	roleTemplates := []*apisv3.RoleTemplate{
+		{
+			ObjectMeta:        metav1.ObjectMeta{Name: "cluster-member"},
+			Rules:             []rbacv1.PolicyRule{readProjects},
+			RoleTemplateNames: []string{"pod-reader"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-reader"},
+			Rules:      []rbacv1.PolicyRule{readPods},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-creator"},
+			Rules:      []rbacv1.PolicyRule{createPods},
+		},
+	}
+	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.RoleTemplate](ctrl)
+	for _, roleTemplate := range roleTemplates {
+		roleTemplateCache.EXPECT().Get(roleTemplate.Name).Return(roleTemplate, nil).AnyTimes()
+	}
+	clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+	roleTemplateResolver := auth.NewRoleTemplateResolver(roleTemplateCache, clusterRoleCache)
+
+	crtb := &apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "crtb-1", Namespace: "c-1"},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "cluster-member",
+	}
+	crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+	crtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+	crtbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).DoAndReturn(func(_, key string) ([]*apisv3.ClusterRoleTemplateBinding, error) {
+		if key == resolvers.GetUserKey(crtb.UserName, crtb.Namespace) {
+			return []*apisv3.ClusterRoleTemplateBinding{crtb}, nil
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	prtb := &apisv3.ProjectRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "prtb-1", Namespace: "p-1"},
+		ProjectName:      "c-1:p-1",
+		UserName:         "u-1",
+		RoleTemplateName: "pod-creator",
+	}
+	prtbCache := fake.NewMockCacheInterface[*apisv3.ProjectRoleTemplateBinding](ctrl)
+	prtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+	prtbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).DoAndReturn(func(_, key string) ([]*apisv3.ProjectRoleTemplateBinding, error) {
+		if key == resolvers.GetUserKey(prtb.UserName, prtb.Namespace) {
+			return []*apisv3.ProjectRoleTemplateBinding{prtb}, nil
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	grbCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRoleBinding](ctrl)
+	grbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+	grbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	globalRoleCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRole](ctrl)
+
+	k8Fake := &k8testing.Fake{}
+	k8Fake.AddReactor("create", "tokenreviews", func(action k8testing.Action) (bool, runtime.Object, error) {
+		review := action.(k8testing.CreateActionImpl).GetObject().(*authenticationv1.TokenReview)
+		caller, ok := strings.CutPrefix(review.Spec.Token, "token-")
+		switch {
+		case caller == "review-error":
+			return true, nil, errors.New("unexpected error")
+		case !ok || caller == "unauthenticated":
+			return true, review, nil
+		}
+		review.Status.Authenticated = true
+		review.Status.User = authenticationv1.UserInfo{Username: caller}
+		if caller == "member-of-auditors" {
+			review.Status.User.Groups = []string{"auditors"}
+		}
+		return true, review, nil
+	})
+	k8Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (bool, runtime.Object, error) {
+		review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+		spec := review.Spec
+		if spec.User == "error" {
+			return true, nil, errors.New("unexpected error")
+		}
+		attributes := spec.ResourceAttributes
+		if attributes.Verb != ViewPermissionsVerb || attributes.Group != "management.cattle.io" || attributes.Resource != "users" {
+			return true, review, nil
+		}
+		review.Status.Allowed = spec.User == "auditor" || slices.Contains(spec.Groups, "auditors") ||
+			(spec.User == "u-1-reader" && attributes.Name == "u-1")
+		return true, review, nil
+	})
+
+	defaultResolver, _ := validation.NewTestRuleResolver(nil, nil, nil, nil)
+	return NewHandler(
+		defaultResolver,
+		resolvers.NewCRTBRuleResolver(crtbCache, roleTemplateResolver),
+		resolvers.NewPRTBRuleResolver(prtbCache, roleTemplateResolver),
+		resolvers.NewGRBRuleResolvers(grbCache, auth.NewGlobalRoleResolver(roleTemplateResolver, globalRoleCache)),
+		&authnfake.FakeTokenReviews{Fake: &authnfake.FakeAuthenticationV1{Fake: k8Fake}},
+		&k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}},
+	)
+}
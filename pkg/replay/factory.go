@@ -0,0 +1,129 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/wrangler/v3/pkg/schemes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/watch"
+	restfake "k8s.io/client-go/rest/fake"
+	k8scache "k8s.io/client-go/tools/cache"
+)
+
+// errOffline is returned by every client call made by a handler, since replays never reach an apiserver.
+var errOffline = errors.New("replay does not connect to an apiserver")
+
+// fixtureFactory is a controller.SharedControllerFactory whose controllers are never started. The caches of its
+// controllers are filled from fixtures and their clients always fail with errOffline.
+type fixtureFactory struct {
+	mutex       sync.Mutex
+	controllers map[schema.GroupVersionKind]*fixtureController
+	resources   map[schema.GroupVersionResource]schema.GroupVersionKind
+}
+
+func newFixtureFactory() *fixtureFactory {
+	return &fixtureFactory{
+		controllers: map[schema.GroupVersionKind]*fixtureController{},
+		resources:   map[schema.GroupVersionResource]schema.GroupVersionKind{},
+	}
+}
+
+// ForObject returns the controller for the kind of the given object.
+func (f *fixtureFactory) ForObject(obj runtime.Object) (controller.SharedController, error) {
+	gvks, _, err := schemes.All.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	return f.ForKind(gvks[0])
+}
+
+// ForKind returns the controller for the given kind. Only kinds previously requested through ForResourceKind are known.
+func (f *fixtureFactory) ForKind(gvk schema.GroupVersionKind) (controller.SharedController, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if c, ok := f.controllers[gvk]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("no controller registered for %s", gvk)
+}
+
+// ForResource returns the controller for the given resource.
+func (f *fixtureFactory) ForResource(gvr schema.GroupVersionResource, namespaced bool) controller.SharedController {
+	f.mutex.Lock()
+	gvk, ok := f.resources[gvr]
+	f.mutex.Unlock()
+	if !ok {
+		gvk = gvr.GroupVersion().WithKind(gvr.Resource)
+	}
+	return f.ForResourceKind(gvr, gvk.Kind, namespaced)
+}
+
+// ForResourceKind returns the controller for the given resource, creating it if needed.
+func (f *fixtureFactory) ForResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool) controller.SharedController {
+	gvk := gvr.GroupVersion().WithKind(kind)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if c, ok := f.controllers[gvk]; ok {
+		return c
+	}
+	c := &fixtureController{
+		informer: k8scache.NewSharedIndexInformer(&k8scache.ListWatch{
+			ListFunc:  func(_ metav1.ListOptions) (runtime.Object, error) { return nil, errOffline },
+			WatchFunc: func(_ metav1.ListOptions) (watch.Interface, error) { return nil, errOffline },
+		}, &unstructured.Unstructured{}, 0, k8scache.Indexers{k8scache.NamespaceIndex: k8scache.MetaNamespaceIndexFunc}),
+		client: client.NewClient(gvr, kind, namespaced, &restfake.RESTClient{
+			Err:                  errOffline,
+			NegotiatedSerializer: serializer.NewCodecFactory(schemes.All).WithoutConversion(),
+		}, time.Minute),
+	}
+	f.controllers[gvk] = c
+	f.resources[gvr] = gvk
+	return c
+}
+
+// SharedCacheFactory is not supported since the controllers are never started.
+func (f *fixtureFactory) SharedCacheFactory() cache.SharedCacheFactory {
+	return nil
+}
+
+// Start is a no-op since the caches are filled from fixtures.
+func (f *fixtureFactory) Start(_ context.Context, _ int) error {
+	return nil
+}
+
+// add adds the object to the cache of the controller for the given kind. It returns false if no handler uses this kind.
+func (f *fixtureFactory) add(gvk schema.GroupVersionKind, obj runtime.Object) (bool, error) {
+	f.mutex.Lock()
+	c, ok := f.controllers[gvk]
+	f.mutex.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, c.informer.GetIndexer().Add(obj)
+}
+
+// fixtureController is a controller.SharedController that never runs its handlers.
+type fixtureController struct {
+	informer k8scache.SharedIndexInformer
+	client   *client.Client
+}
+
+func (c *fixtureController) Enqueue(_, _ string)                       {}
+func (c *fixtureController) EnqueueAfter(_, _ string, _ time.Duration) {}
+func (c *fixtureController) EnqueueKey(_ string)                       {}
+func (c *fixtureController) Informer() k8scache.SharedIndexInformer    { return c.informer }
+func (c *fixtureController) Start(_ context.Context, _ int) error      { return nil }
+func (c *fixtureController) Client() *client.Client                    { return c.client }
+func (c *fixtureController) RegisterHandler(_ context.Context, _ string, _ controller.SharedControllerHandler) {
+}
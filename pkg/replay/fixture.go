@@ -0,0 +1,62 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rancher/wrangler/v3/pkg/schemes"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// loadFixtures adds the objects of the given YAML or JSON stream to the caches of the factory. The stream holds any
+// number of documents, each being a single object or a List of objects.
+func loadFixtures(factory *fixtureFactory, reader io.Reader) error {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		var obj unstructured.Unstructured
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode fixture: %w", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.IsList() {
+			err = obj.EachListItem(func(item runtime.Object) error {
+				return addFixture(factory, item.(*unstructured.Unstructured))
+			})
+		} else {
+			err = addFixture(factory, &obj)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addFixture converts the object to its typed representation and adds it to the matching cache.
+func addFixture(factory *fixtureFactory, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	typed, err := schemes.All.New(gvk)
+	if err != nil {
+		return fmt.Errorf("unsupported fixture %s %s: %w", gvk, obj.GetName(), err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+		return fmt.Errorf("failed to convert fixture %s %s: %w", gvk, obj.GetName(), err)
+	}
+	used, err := factory.add(gvk, typed)
+	if err != nil {
+		return fmt.Errorf("failed to add fixture %s %s: %w", gvk, obj.GetName(), err)
+	}
+	if !used {
+		logrus.Warnf("Ignoring fixture %s %s: no handler uses this kind", gvk, obj.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// Package replay runs captured AdmissionReviews through the webhook handlers without an apiserver.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/clients"
+	"github.com/rancher/webhook/pkg/server"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	validating = "validating"
+	mutating   = "mutating"
+)
+
+// Result is the decision of a single webhook on a replayed AdmissionReview.
+type Result struct {
+	// Type is either "mutating" or "validating".
+	Type     string
+	Webhook  string
+	Allowed  bool
+	Message  string
+	Warnings []string
+	Patch    []byte
+	Err      error
+}
+
+// Replayer runs AdmissionReviews through the same handlers as the webhook server.
+type Replayer struct {
+	validators []admission.ValidatingAdmissionHandler
+	mutators   []admission.MutatingAdmissionHandler
+}
+
+// New returns a Replayer whose caches are filled with the objects read from fixtures, which may be nil.
+// SubjectAccessReviews made by the handlers are answered from the RBAC objects of the fixtures.
+func New(fixtures io.Reader, mcmEnabled bool) (*Replayer, error) {
+	factory := newFixtureFactory()
+	k8s := k8sfake.NewSimpleClientset()
+	replayClients, err := clients.NewFromControllerFactory(factory, k8s, mcmEnabled)
+	if err != nil {
+		return nil, err
+	}
+	k8s.PrependReactor("create", "subjectaccessreviews", sarReactor(auth.RBACRestGetter{
+		Roles:               replayClients.RBAC.Role().Cache(),
+		RoleBindings:        replayClients.RBAC.RoleBinding().Cache(),
+		ClusterRoles:        replayClients.RBAC.ClusterRole().Cache(),
+		ClusterRoleBindings: replayClients.RBAC.ClusterRoleBinding().Cache(),
+	}))
+
+	validators, err := server.Validation(replayClients)
+	if err != nil {
+		return nil, err
+	}
+	mutators, err := server.Mutation(replayClients)
+	if err != nil {
+		return nil, err
+	}
+
+	// fixtures are loaded once all handlers have registered their cache indexers
+	if fixtures != nil {
+		if err := loadFixtures(factory, fixtures); err != nil {
+			return nil, err
+		}
+	}
+	return &Replayer{validators: validators, mutators: mutators}, nil
+}
+
+// Replay runs the review through the mutating webhooks, then through the validating webhooks, matching the order used
+// by the apiserver. Patches returned by the mutating webhooks are applied to the object seen by the next webhooks.
+func (r *Replayer) Replay(review *admissionv1.AdmissionReview) ([]Result, error) {
+	if review.Request == nil {
+		return nil, fmt.Errorf("review has no request")
+	}
+	review = review.DeepCopy()
+	var results []Result
+	for _, handler := range r.mutators {
+		if !handles(handler, review.Request) {
+			continue
+		}
+		result := run(mutating, handler, admission.NewMutatingHandlerFunc(handler), review)
+		if len(result.Patch) != 0 && review.Request.Object.Raw != nil {
+			patched, err := applyPatch(review.Request.Object.Raw, result.Patch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply patch of %s: %w", result.Webhook, err)
+			}
+			review.Request.Object.Raw = patched
+		}
+		results = append(results, result)
+	}
+	for _, handler := range r.validators {
+		if !handles(handler, review.Request) {
+			continue
+		}
+		results = append(results, run(validating, handler, admission.NewValidatingHandlerFunc(handler), review))
+	}
+	return results, nil
+}
+
+// ReplayFiles replays every AdmissionReview found in the given paths and prints the results to out. Directories are
+// read non-recursively and only their .json files are replayed.
+func (r *Replayer) ReplayFiles(paths []string, out io.Writer) error {
+	files, err := reviewFiles(paths)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.Unmarshal(data, &review); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		results, err := r.Replay(&review)
+		if err != nil {
+			return fmt.Errorf("failed to replay %s: %w", file, err)
+		}
+		printResults(out, file, review.Request, results)
+	}
+	return nil
+}
+
+// run calls the http handler of a webhook with the review, the same way the apiserver would.
+func run(webhookType string, handler admission.WebhookHandler, handlerFunc http.HandlerFunc, review *admissionv1.AdmissionReview) (result Result) {
+	result = Result{Type: webhookType, Webhook: admission.CreateWebhookName(handler, "")}
+	defer func() {
+		// handlers needing more than the cached fixtures, such as dynamic clients, can not be replayed
+		if recovered := recover(); recovered != nil {
+			result.Err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	recorder := httptest.NewRecorder()
+	handlerFunc(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	var response admissionv1.AdmissionReview
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Response == nil {
+		result.Err = fmt.Errorf("unexpected response (%d): %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))
+		return result
+	}
+	if response.Response.Result != nil {
+		result.Message = response.Response.Result.Message
+	}
+	if recorder.Code != http.StatusOK {
+		result.Err = fmt.Errorf("%s", result.Message)
+		return result
+	}
+	result.Allowed = response.Response.Allowed
+	result.Warnings = response.Response.Warnings
+	result.Patch = response.Response.Patch
+	return result
+}
+
+// handles returns true if the handler reviews the resource and operation of the request.
+func handles(handler admission.WebhookHandler, request *admissionv1.AdmissionRequest) bool {
+	gvr := handler.GVR()
+	if gvr.Group != request.Resource.Group || (gvr.Resource != "*" && gvr.Resource != request.Resource.Resource) {
+		return false
+	}
+	for _, operation := range handler.Operations() {
+		if operation == admissionregistrationv1.OperationAll || string(operation) == string(request.Operation) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyPatch(object, patch []byte) ([]byte, error) {
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	return decoded.Apply(object)
+}
+
+// reviewFiles expands the directories in paths to the .json files they contain.
+func reviewFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var dirFiles []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+				dirFiles = append(dirFiles, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+func printResults(out io.Writer, file string, request *admissionv1.AdmissionRequest, results []Result) {
+	resource := request.Resource.Resource
+	if request.Resource.Group != "" {
+		resource += "." + request.Resource.Group
+	}
+	name := request.Name
+	if request.Namespace != "" {
+		name = request.Namespace + "/" + name
+	}
+	fmt.Fprintf(out, "%s: %s %s %s by %s\n", file, request.Operation, resource, name, request.UserInfo.Username)
+	if len(results) == 0 {
+		fmt.Fprintln(out, "  no webhook handles this resource")
+	}
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			fmt.Fprintf(out, "  %s %s: error: %v\n", result.Type, result.Webhook, result.Err)
+		case result.Allowed:
+			fmt.Fprintf(out, "  %s %s: allowed\n", result.Type, result.Webhook)
+		default:
+			fmt.Fprintf(out, "  %s %s: denied: %s\n", result.Type, result.Webhook, result.Message)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(out, "    warning: %s\n", warning)
+		}
+		if len(result.Patch) != 0 {
+			fmt.Fprintf(out, "    patch: %s\n", result.Patch)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const fixtures = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: read-pods
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRoleBinding
+  metadata:
+    name: read-pods-u-test
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: ClusterRole
+    name: read-pods
+  subjects:
+  - apiGroup: rbac.authorization.k8s.io
+    kind: User
+    name: u-test
+- apiVersion: management.cattle.io/v3
+  kind: RoleTemplate
+  metadata:
+    name: pod-reader
+  context: cluster
+  rules:
+  - apiGroups: [""]
+    resources: ["pods"]
+    verbs: ["get"]
+`
+
+func TestReplayRoleTemplate(t *testing.T) {
+	replayer, err := New(strings.NewReader(fixtures), true)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		rules       []rbacv1.PolicyRule
+		wantAllowed bool
+	}{
+		{
+			name:        "rules held by the user are allowed",
+			rules:       []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			wantAllowed: true,
+		},
+		{
+			name:        "escalation is denied",
+			rules:       []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+			wantAllowed: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roleTemplate := &v3.RoleTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "new-rt"},
+				Context:    "cluster",
+				Rules:      test.rules,
+			}
+			results, err := replayer.Replay(newReview(t, "management.cattle.io", "roletemplates", roleTemplate))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.Equal(t, validating, results[0].Type)
+			assert.Equal(t, "rancher.cattle.io.roletemplates.management.cattle.io", results[0].Webhook)
+			require.NoError(t, results[0].Err)
+			assert.Equal(t, test.wantAllowed, results[0].Allowed, results[0].Message)
+		})
+	}
+}
+
+func TestReplayImmutableFields(t *testing.T) {
+	replayer, err := New(strings.NewReader(fixtures), true)
+	require.NoError(t, err)
+
+	clusterRole := func(owner string) *rbacv1.ClusterRole {
+		return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+			Name:   "gr-role",
+			Labels: map[string]string{"authz.management.cattle.io/gr-owner": owner},
+		}}
+	}
+	review := newReview(t, "rbac.authorization.k8s.io", "clusterroles", clusterRole("new-owner"))
+	review.Request.Operation = admissionv1.Update
+	oldRaw, err := json.Marshal(clusterRole("owner"))
+	require.NoError(t, err)
+	review.Request.OldObject = runtime.RawExtension{Raw: oldRaw}
+
+	results, err := replayer.Replay(review)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	assert.False(t, results[0].Allowed)
+	assert.Equal(t, `metadata.labels[authz.management.cattle.io/gr-owner]: Forbidden: field is immutable once set`, results[0].Message)
+}
+
+func TestReplayFiles(t *testing.T) {
+	replayer, err := New(strings.NewReader(fixtures), true)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cc-abc", Namespace: "cattle-global-data"},
+		Type:       "provisioning.cattle.io/cloud-credential",
+	}
+	data, err := json.Marshal(newReview(t, "", "secrets", secret))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.json"), data, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("not a review"), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, replayer.ReplayFiles([]string{dir}, &out))
+
+	output := out.String()
+	assert.Contains(t, output, "secret.json: CREATE secrets cattle-global-data/cc-abc by u-test")
+	assert.Contains(t, output, "mutating rancher.cattle.io.secrets: allowed")
+	assert.Contains(t, output, `patch: [{"op":"add","path":"/metadata/annotations"`)
+	// the secret validator only handles updates and deletes
+	assert.NotContains(t, output, "validating")
+}
+
+func TestLoadFixturesUnsupportedKind(t *testing.T) {
+	_, err := New(strings.NewReader("apiVersion: example.com/v1\nkind: Unknown\nmetadata:\n  name: test\n"), true)
+	assert.Error(t, err)
+}
+
+func newReview(t *testing.T, group, resource string, obj runtime.Object) *admissionv1.AdmissionReview {
+	t.Helper()
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+	accessor := obj.(metav1.Object)
+	return &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "1",
+			Resource:  metav1.GroupVersionResource{Group: group, Resource: resource},
+			Name:      accessor.GetName(),
+			Namespace: accessor.GetNamespace(),
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "u-test"},
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
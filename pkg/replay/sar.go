@@ -0,0 +1,74 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rancher/webhook/pkg/auth"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/plugin/pkg/auth/authorizer/rbac"
+)
+
+// sarReactor returns a reactor answering SubjectAccessReviews with the RBAC authorizer of the kube-apiserver, evaluated
+// against the Roles, ClusterRoles and bindings of the fixtures.
+func sarReactor(getter auth.RBACRestGetter) k8stesting.ReactionFunc {
+	rbacAuthorizer := rbac.New(getter, getter, getter, getter)
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		createAction, ok := action.(k8stesting.CreateAction)
+		if !ok {
+			return false, nil, nil
+		}
+		review, ok := createAction.GetObject().(*authorizationv1.SubjectAccessReview)
+		if !ok {
+			return false, nil, nil
+		}
+		review = review.DeepCopy()
+		if slices.Contains(review.Spec.Groups, user.SystemPrivilegedGroup) {
+			review.Status.Allowed = true
+			review.Status.Reason = fmt.Sprintf("user is in the %s group", user.SystemPrivilegedGroup)
+			return true, review, nil
+		}
+		decision, reason, err := rbacAuthorizer.Authorize(context.Background(), attributesFromSpec(review.Spec))
+		if err != nil {
+			review.Status.EvaluationError = err.Error()
+		}
+		review.Status.Allowed = decision == authorizer.DecisionAllow
+		review.Status.Reason = reason
+		return true, review, nil
+	}
+}
+
+// attributesFromSpec returns the authorizer attributes of a SubjectAccessReview.
+func attributesFromSpec(spec authorizationv1.SubjectAccessReviewSpec) authorizer.AttributesRecord {
+	extra := map[string][]string{}
+	for key, value := range spec.Extra {
+		extra[key] = value
+	}
+	attributes := authorizer.AttributesRecord{
+		User: &user.DefaultInfo{
+			Name:   spec.User,
+			UID:    spec.UID,
+			Groups: spec.Groups,
+			Extra:  extra,
+		},
+	}
+	if resource := spec.ResourceAttributes; resource != nil {
+		attributes.ResourceRequest = true
+		attributes.Verb = resource.Verb
+		attributes.Namespace = resource.Namespace
+		attributes.APIGroup = resource.Group
+		attributes.APIVersion = resource.Version
+		attributes.Resource = resource.Resource
+		attributes.Subresource = resource.Subresource
+		attributes.Name = resource.Name
+	} else if nonResource := spec.NonResourceAttributes; nonResource != nil {
+		attributes.Verb = nonResource.Verb
+		attributes.Path = nonResource.Path
+	}
+	return attributes
+}
@@ -2,12 +2,14 @@ package resolvers
 
 import (
 	"fmt"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/auth"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -18,6 +20,8 @@ const (
 type CRTBRuleResolver struct {
 	ClusterRoleTemplateBindings v3.ClusterRoleTemplateBindingCache
 	RoleTemplateResolver        *auth.RoleTemplateResolver
+	// index is nil unless EnableRuleIndex was called.
+	index *ruleIndex
 }
 
 // NewCRTBRuleResolver returns a new resolver for resolving rules given through ClusterRoleTemplateBindings.
@@ -49,34 +53,51 @@ func (c *CRTBRuleResolver) RulesFor(user user.Info, namespace string) ([]rbacv1.
 // VisitRulesFor invokes visitor() with each rule that applies to a given user in a given namespace, and each error encountered resolving those rules.
 // If visitor() returns false, visiting is short-circuited.
 func (c *CRTBRuleResolver) VisitRulesFor(user user.Info, namespace string, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) {
-	// for each group check if there are any CRTBs that match subject and namespace using the indexer.
-	// For each returned binding get a list of it's rules with the RoleTemplateResolver and call visit for each rule.
-	for _, group := range user.GetGroups() {
-		crtbs, err := c.ClusterRoleTemplateBindings.GetByIndex(crtbSubjectIndex, GetGroupKey(group, namespace))
-		if err != nil {
-			visitor(nil, nil, err)
-			continue
+	// for each group and for the user, check if there are any CRTBs that match the subject and namespace using the
+	// indexer, and visit the rules of their role templates.
+	for _, key := range subjectKeys(user, namespace) {
+		resolve := func(dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+			return c.visitSubjectRules(key, dependencies, visitor)
 		}
-		for _, crtb := range crtbs {
-			rtRules, err := c.RoleTemplateResolver.RulesFromTemplateName(crtb.RoleTemplateName)
-			if !visitRules(nil, rtRules, err, visitor) {
-				return
-			}
+		if !c.index.visit(key, "", resolve, visitor) {
+			return
 		}
 	}
+}
+
+// EnableRuleIndex indexes the rules granted to subjects, which are then resolved once until the CRTBs of the subject
+// or the role templates they reference change. bindings must be the informer of the CRTB cache of the resolver.
+func (c *CRTBRuleResolver) EnableRuleIndex(bindings cache.SharedIndexInformer, options RuleIndexOptions) error {
+	index, err := newRuleIndex(bindings, crtbBySubject, c.RoleTemplateResolver, options)
+	if err != nil {
+		return err
+	}
+	c.index = index
+	return nil
+}
 
-	// gather all CRTBs that match this userName and namespace and resolve there rules.
-	crtbs, err := c.ClusterRoleTemplateBindings.GetByIndex(crtbSubjectIndex, GetUserKey(user.GetName(), namespace))
+// visitSubjectRules visits the rules of the CRTBs indexed with the subject key. It returns false if visiting was
+// short-circuited.
+func (c *CRTBRuleResolver) visitSubjectRules(key string, dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+	crtbs, err := c.ClusterRoleTemplateBindings.GetByIndex(crtbSubjectIndex, key)
 	if err != nil {
 		visitor(nil, nil, err)
-		return
+		return true
 	}
+	now := time.Now()
 	for _, crtb := range crtbs {
-		rtRules, err := c.RoleTemplateResolver.RulesFromTemplateName(crtb.RoleTemplateName)
-		if !visitRules(nil, rtRules, err, visitor) {
-			return
+		if !dependencies.bindingActive(crtb, now) {
+			continue
+		}
+		if !visitRoleTemplateRules(c.RoleTemplateResolver, crtbSource(crtb), crtb.RoleTemplateName, dependencies, visitor) {
+			return false
 		}
 	}
+	return true
+}
+
+func crtbSource(crtb *apisv3.ClusterRoleTemplateBinding) RuleSource {
+	return RuleSource{Kind: "ClusterRoleTemplateBinding", Namespace: crtb.Namespace, Name: crtb.Name}
 }
 
 func crtbBySubject(crtb *apisv3.ClusterRoleTemplateBinding) ([]string, error) {
@@ -2,12 +2,14 @@ package resolvers
 
 import (
 	"fmt"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/auth"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -35,6 +37,10 @@ type GRBRuleResolver struct {
 	gbrCache     v3.GlobalRoleBindingCache
 	grResolver   *auth.GlobalRoleResolver
 	ruleResolver func(namespace string, gr *apisv3.GlobalRole, grResolver *auth.GlobalRoleResolver) ([]rbacv1.PolicyRule, error)
+	// roleTemplateNames returns the names of the role templates the rules of ruleResolver are resolved from, if any.
+	roleTemplateNames func(gr *apisv3.GlobalRole, grResolver *auth.GlobalRoleResolver) []string
+	// index is nil unless EnableRuleIndex was called.
+	index *ruleIndex
 }
 
 // NewGRBRuleResolvers returns resolvers for resolving rules given through GlobalRoleBindings
@@ -55,6 +61,9 @@ func NewGRBRuleResolvers(grbCache v3.GlobalRoleBindingCache, grResolver *auth.Gl
 			}
 			return rules, err
 		},
+		roleTemplateNames: func(gr *apisv3.GlobalRole, grResolver *auth.GlobalRoleResolver) []string {
+			return grResolver.ClusterRoleTemplateNames(gr)
+		},
 	}
 	fleetWorkspaceResourceRulesResolver := &GRBRuleResolver{
 		gbrCache:   grbCache,
@@ -78,6 +87,20 @@ func NewGRBRuleResolvers(grbCache v3.GlobalRoleBindingCache, grResolver *auth.Gl
 	}
 }
 
+// EnableRuleIndex indexes the rules granted to subjects by each resolver, which are then resolved once until the
+// GlobalRoleBindings of the subject, or the global roles and role templates they reference, change. bindings must be
+// the informer of the GlobalRoleBinding cache of the resolvers.
+func (g *GRBRuleResolvers) EnableRuleIndex(bindings cache.SharedIndexInformer, options RuleIndexOptions) error {
+	for _, resolver := range []*GRBRuleResolver{g.ICRResolver, g.FWRulesResolver, g.FWVerbsResolver} {
+		index, err := newRuleIndex(bindings, grbBySubject, resolver.grResolver.RoleTemplateResolver(), options)
+		if err != nil {
+			return err
+		}
+		resolver.index = index
+	}
+	return nil
+}
+
 // GetRoleReferenceRules is used to find which rules are granted by a rolebinding/clusterRoleBinding. Since we don't
 // use these primitives to refer to the globalRoles, this function returns an empty slice.
 func (g *GRBRuleResolver) GetRoleReferenceRules(rbacv1.RoleRef, string) ([]rbacv1.PolicyRule, error) {
@@ -102,38 +125,53 @@ func (g *GRBRuleResolver) VisitRulesFor(user user.Info, namespace string, visito
 // visitRulesForWithRuleResolver invokes visitor() with each rule that applies to a given user in a given namespace, and each error encountered resolving those rules.
 // If visitor() returns false, visiting is short-circuited. This will return different rules for the "local" namespace.
 func (g *GRBRuleResolver) visitRulesForWithRuleResolver(user user.Info, namespace string, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool, ruleResolver func(namespace string, gr *apisv3.GlobalRole, grResolver *auth.GlobalRoleResolver) ([]rbacv1.PolicyRule, error)) {
-	var grbs []*apisv3.GlobalRoleBinding
-	// gather all grbs that apply to this user through group or user assignment
-	for _, group := range user.GetGroups() {
-		groupGrbs, err := g.gbrCache.GetByIndex(grbSubjectIndex, GetGroupKey(group, ""))
-		if err != nil {
-			visitor(nil, nil, err)
-			continue
+	// rules only differ between the local cluster and the other clusters
+	scope := ""
+	if namespace == localCluster {
+		scope = localCluster
+	}
+	// visit all grbs that apply to this user through group or user assignment
+	for _, key := range subjectKeys(user, "") {
+		resolve := func(dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+			return g.visitSubjectRules(key, namespace, ruleResolver, dependencies, visitor)
+		}
+		if !g.index.visit(key, scope, resolve, visitor) {
+			return
 		}
-		grbs = append(grbs, groupGrbs...)
 	}
-	userGrbs, err := g.gbrCache.GetByIndex(grbSubjectIndex, GetUserKey(user.GetName(), ""))
-	// don't return here - we may have gotten bindings from the group lookup to evaluate
+}
+
+// visitSubjectRules visits the rules of the GlobalRoleBindings indexed with the subject key. It returns false if
+// visiting was short-circuited.
+func (g *GRBRuleResolver) visitSubjectRules(key, namespace string, ruleResolver func(namespace string, gr *apisv3.GlobalRole, grResolver *auth.GlobalRoleResolver) ([]rbacv1.PolicyRule, error), dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+	grbs, err := g.gbrCache.GetByIndex(grbSubjectIndex, key)
 	if err != nil {
 		visitor(nil, nil, err)
-	} else {
-		grbs = append(grbs, userGrbs...)
+		return true
 	}
+	now := time.Now()
 	for _, grb := range grbs {
+		if !dependencies.bindingActive(grb, now) {
+			continue
+		}
+		dependencies.globalRoles.Insert(grb.GlobalRoleName)
 		globalRole, err := g.grResolver.GlobalRoleCache().Get(grb.GlobalRoleName)
 		if err != nil {
 			visitor(nil, nil, err)
 			continue
 		}
-		var rules []rbacv1.PolicyRule
-		var ruleError error
-
-		rules, ruleError = ruleResolver(namespace, globalRole, g.grResolver)
+		// resolving the role templates is only needed to invalidate the index
+		if g.index != nil && g.roleTemplateNames != nil {
+			dependencies.roleTemplates.Insert(g.roleTemplateNames(globalRole, g.grResolver)...)
+		}
+		rules, ruleError := ruleResolver(namespace, globalRole, g.grResolver)
 
-		if !visitRules(nil, rules, ruleError, visitor) {
-			return
+		source := &RuleSource{Kind: "GlobalRoleBinding", Name: grb.Name, GlobalRole: grb.GlobalRoleName}
+		if !visitRules(source, rules, ruleError, visitor) {
+			return false
 		}
 	}
+	return true
 }
 
 // grbBySubject indexes a GRB using the subject as the key.
@@ -3,12 +3,14 @@ package resolvers
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/auth"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -19,6 +21,8 @@ const (
 type PRTBRuleResolver struct {
 	ProjectRoleTemplateBindings v3.ProjectRoleTemplateBindingCache
 	RoleTemplateResolver        *auth.RoleTemplateResolver
+	// index is nil unless EnableRuleIndex was called.
+	index *ruleIndex
 }
 
 // NewPRTBRuleResolver will create a new PRTBRuleResolver.
@@ -50,34 +54,51 @@ func (p *PRTBRuleResolver) RulesFor(user user.Info, namespace string) ([]rbacv1.
 // VisitRulesFor invokes visitor() with each rule that applies to a given user in a given namespace, and each error encountered resolving those rules.
 // If visitor() returns false, visiting is short-circuited.
 func (p *PRTBRuleResolver) VisitRulesFor(user user.Info, namespace string, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) {
-	// for each group check if there are any PRTBs that match subject and namespace using the indexer.
-	// For each returned binding get a list of it's rules with the RoleTemplateResolver and call visit for each rule.
-	for _, group := range user.GetGroups() {
-		prtbs, err := p.ProjectRoleTemplateBindings.GetByIndex(prtbSubjectIndex, GetGroupKey(group, namespace))
-		if err != nil {
-			visitor(nil, nil, err)
-			continue
+	// for each group and for the user, check if there are any PRTBs that match the subject and namespace using the
+	// indexer, and visit the rules of their role templates.
+	for _, key := range subjectKeys(user, namespace) {
+		resolve := func(dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+			return p.visitSubjectRules(key, dependencies, visitor)
 		}
-		for _, prtb := range prtbs {
-			rtRules, err := p.RoleTemplateResolver.RulesFromTemplateName(prtb.RoleTemplateName)
-			if !visitRules(nil, rtRules, err, visitor) {
-				return
-			}
+		if !p.index.visit(key, "", resolve, visitor) {
+			return
 		}
 	}
+}
+
+// EnableRuleIndex indexes the rules granted to subjects, which are then resolved once until the PRTBs of the subject
+// or the role templates they reference change. bindings must be the informer of the PRTB cache of the resolver.
+func (p *PRTBRuleResolver) EnableRuleIndex(bindings cache.SharedIndexInformer, options RuleIndexOptions) error {
+	index, err := newRuleIndex(bindings, prtbBySubject, p.RoleTemplateResolver, options)
+	if err != nil {
+		return err
+	}
+	p.index = index
+	return nil
+}
 
-	// gather all PRTBs that match this userName and namespace and resolve there rules.
-	prtbs, err := p.ProjectRoleTemplateBindings.GetByIndex(prtbSubjectIndex, GetUserKey(user.GetName(), namespace))
+// visitSubjectRules visits the rules of the PRTBs indexed with the subject key. It returns false if visiting was
+// short-circuited.
+func (p *PRTBRuleResolver) visitSubjectRules(key string, dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+	prtbs, err := p.ProjectRoleTemplateBindings.GetByIndex(prtbSubjectIndex, key)
 	if err != nil {
 		visitor(nil, nil, err)
-		return
+		return true
 	}
+	now := time.Now()
 	for _, prtb := range prtbs {
-		rtRules, err := p.RoleTemplateResolver.RulesFromTemplateName(prtb.RoleTemplateName)
-		if !visitRules(nil, rtRules, err, visitor) {
-			return
+		if !dependencies.bindingActive(prtb, now) {
+			continue
+		}
+		if !visitRoleTemplateRules(p.RoleTemplateResolver, prtbSource(prtb), prtb.RoleTemplateName, dependencies, visitor) {
+			return false
 		}
 	}
+	return true
+}
+
+func prtbSource(prtb *apisv3.ProjectRoleTemplateBinding) RuleSource {
+	return RuleSource{Kind: "ProjectRoleTemplateBinding", Namespace: prtb.Namespace, Name: prtb.Name}
 }
 
 func prtbBySubject(prtb *apisv3.ProjectRoleTemplateBinding) ([]string, error) {
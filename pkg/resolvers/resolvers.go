@@ -4,7 +4,9 @@ package resolvers
 import (
 	"fmt"
 
+	"github.com/rancher/webhook/pkg/auth"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
 )
 
 // ruleAccumulator based off kubernetes struct
@@ -54,6 +56,78 @@ func visitRules(source fmt.Stringer, rules []rbacv1.PolicyRule, err error, visit
 	return true
 }
 
+// RuleSource describes where a rule visited by the resolvers comes from: the binding granting it, and the role template
+// or global role holding it.
+type RuleSource struct {
+	// Kind is the kind of the binding, e.g. ClusterRoleTemplateBinding.
+	Kind      string
+	Namespace string
+	Name      string
+	// RoleTemplate is the role template holding the rule. It is either the template referenced by the binding, or one
+	// inherited by it.
+	RoleTemplate string
+	// GlobalRole is the global role referenced by a GlobalRoleBinding.
+	GlobalRole string
+}
+
+// String returns a description of the source, e.g.
+// ClusterRoleTemplateBinding c-abc/crtb-xyz, RoleTemplate cluster-owner.
+func (s *RuleSource) String() string {
+	name := s.Name
+	if s.Namespace != "" {
+		name = s.Namespace + "/" + name
+	}
+	description := s.Kind + " " + name
+	if s.GlobalRole != "" {
+		description += ", GlobalRole " + s.GlobalRole
+	}
+	if s.RoleTemplate != "" {
+		description += ", RoleTemplate " + s.RoleTemplate
+	}
+	return description
+}
+
+// visitRoleTemplateRules calls visitor with the rules of the role template referenced by a binding, with a source naming
+// the binding and the template holding each rule. Rules are only visited if all the templates could be resolved. The
+// names of the templates are added to dependencies.
+func visitRoleTemplateRules(resolver *auth.RoleTemplateResolver, binding RuleSource, roleTemplateName string, dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+	type templateRules struct {
+		name  string
+		rules []rbacv1.PolicyRule
+	}
+	var templates []templateRules
+	dependencies.roleTemplates.Insert(roleTemplateName)
+	roleTemplate, err := resolver.RoleTemplateCache().Get(roleTemplateName)
+	if err != nil {
+		return visitor(nil, nil, fmt.Errorf("failed to get RoleTemplate '%s': %w", roleTemplateName, err))
+	}
+	err = resolver.VisitRulesFromTemplate(roleTemplate, func(templateName string, rules []rbacv1.PolicyRule) {
+		templates = append(templates, templateRules{name: templateName, rules: rules})
+		dependencies.roleTemplates.Insert(templateName)
+	})
+	if err != nil {
+		return visitor(nil, nil, err)
+	}
+	for _, template := range templates {
+		source := binding
+		source.RoleTemplate = template.name
+		if !visitRules(&source, template.rules, nil, visitor) {
+			return false
+		}
+	}
+	return true
+}
+
+// subjectKeys returns the keys of the binding cache indexers for the groups and the name of the user in the namespace,
+// in the order their rules are visited.
+func subjectKeys(user user.Info, namespace string) []string {
+	keys := make([]string, 0, len(user.GetGroups())+1)
+	for _, group := range user.GetGroups() {
+		keys = append(keys, GetGroupKey(group, namespace))
+	}
+	return append(keys, GetUserKey(user.GetName(), namespace))
+}
+
 // GetUserKey creates a indexer key based on the userName, and namespace of an object.
 func GetUserKey(userName, namespace string) string {
 	return fmt.Sprintf("user:%s-%s", userName, namespace)
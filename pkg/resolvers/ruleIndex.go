@@ -0,0 +1,261 @@
+package resolvers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/memo"
+	"github.com/sirupsen/logrus"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// RuleIndexOptions configures the rule indexes of the resolvers.
+type RuleIndexOptions struct {
+	// RoleTemplates, ClusterRoles and GlobalRoles are the informers whose events invalidate the indexed rules which
+	// were resolved from the changed objects. ClusterRoles are watched because they back external RoleTemplates.
+	// RoleTemplates and ClusterRoles are not watched by the indexes of resolvers whose auth.RoleTemplateResolver
+	// memoizes rules: the indexes are invalidated by the resolver instead, after its memoized rules.
+	RoleTemplates cache.SharedIndexInformer
+	ClusterRoles  cache.SharedIndexInformer
+	GlobalRoles   cache.SharedIndexInformer
+	// MaxEntries is the number of entries held by each index, memo.DefaultMaxEntries if not positive. The least
+	// recently used entries are removed first.
+	MaxEntries int
+	// SelfCheck compares the indexed rules with the rules resolved from the bindings on each lookup. Inconsistencies are
+	// logged, and the resolved rules are returned instead. This is meant for debugging, since it defeats the index.
+	SelfCheck bool
+}
+
+// ruleDependencies are the names of the objects the rules of an index entry were resolved from.
+type ruleDependencies struct {
+	roleTemplates sets.Set[string]
+	globalRoles   sets.Set[string]
+	// expiresAt is the earliest expiration of the bindings the rules were resolved from, or zero if none expires. No
+	// informer event is sent when a binding expires, so the entry is resolved again after that time.
+	expiresAt time.Time
+}
+
+func newRuleDependencies() *ruleDependencies {
+	return &ruleDependencies{roleTemplates: sets.New[string](), globalRoles: sets.New[string]()}
+}
+
+// bindingActive returns false if the binding expired, in which case it grants nothing. Otherwise, the expiration of the
+// binding is recorded.
+func (d *ruleDependencies) bindingActive(binding metav1.Object, now time.Time) bool {
+	if auth.BindingExpired(binding, now) {
+		return false
+	}
+	if expiresAt, expires, _ := auth.BindingExpiration(binding); expires && (d.expiresAt.IsZero() || expiresAt.Before(d.expiresAt)) {
+		d.expiresAt = expiresAt
+	}
+	return true
+}
+
+// expired returns true if a binding the rules of the entry were resolved from expired at the given time.
+func (e *ruleIndexEntry) expired(now time.Time) bool {
+	return !e.dependencies.expiresAt.IsZero() && !now.Before(e.dependencies.expiresAt)
+}
+
+// indexedRule is a rule and its source.
+type indexedRule struct {
+	source fmt.Stringer
+	rule   rbacv1.PolicyRule
+}
+
+// ruleIndexEntry holds the rules granted to a subject in a scope.
+type ruleIndexEntry struct {
+	rules        []indexedRule
+	dependencies *ruleDependencies
+}
+
+// subjectResolver visits the rules granted to the subject of an index key, the slow way, and records the objects they
+// were resolved from in dependencies. It returns false if visiting was short-circuited.
+type subjectResolver func(dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool
+
+const (
+	subjectKind      = "Subject"
+	roleTemplateKind = "RoleTemplate"
+	globalRoleKind   = "GlobalRole"
+)
+
+// ruleIndex holds the rules granted to subjects, keyed by the subject keys of the binding cache indexers, e.g.
+// user:u-abc-c-xyz, and by a scope for the resolvers which return different rules for different namespaces. Entries are
+// filled on the first lookup of a subject, and are removed by informer event handlers when the bindings of the subject,
+// or the role templates and global roles their rules were resolved from, change, so that the next lookup resolves them
+// again. Only the entries depending on a changed object are removed, and the least recently used entries are removed
+// once the index holds RuleIndexOptions.MaxEntries entries.
+type ruleIndex struct {
+	selfCheck bool
+	entries   *memo.Memo[*ruleIndexEntry]
+}
+
+// newRuleIndex returns a ruleIndex invalidated by the events of the bindings informer, whose objects are mapped to
+// subject keys by bySubject, and by the events of the informers of the options. If roleTemplates memoizes rules, the
+// index is invalidated by roleTemplates when role templates change, instead of by the RoleTemplates and ClusterRoles
+// informers, whose handlers would run in no fixed order with those of roleTemplates.
+func newRuleIndex[T any](bindings cache.SharedIndexInformer, bySubject func(T) ([]string, error), roleTemplates *auth.RoleTemplateResolver,
+	options RuleIndexOptions) (*ruleIndex, error) {
+	index := &ruleIndex{
+		selfCheck: options.SelfCheck,
+		entries:   memo.New[*ruleIndexEntry](options.MaxEntries),
+	}
+	if roleTemplates != nil && roleTemplates.OnRulesChanged(func(name string) {
+		index.entries.Invalidate(memo.Dependency{Kind: roleTemplateKind, Name: name})
+	}) {
+		options.RoleTemplates, options.ClusterRoles = nil, nil
+	}
+	handlers := []struct {
+		kind         string
+		informer     cache.SharedIndexInformer
+		dependencies func(obj any) []memo.Dependency
+	}{
+		{
+			kind:     "binding",
+			informer: bindings,
+			dependencies: func(obj any) []memo.Dependency {
+				binding, ok := obj.(T)
+				if !ok {
+					return nil
+				}
+				keys, _ := bySubject(binding)
+				dependencies := make([]memo.Dependency, 0, len(keys))
+				for _, key := range keys {
+					dependencies = append(dependencies, memo.Dependency{Kind: subjectKind, Name: key})
+				}
+				return dependencies
+			},
+		},
+		{
+			kind:         "RoleTemplate",
+			informer:     options.RoleTemplates,
+			dependencies: memo.ByName(roleTemplateKind),
+		},
+		{
+			// external RoleTemplates are backed by the ClusterRole of the same name
+			kind:         "ClusterRole",
+			informer:     options.ClusterRoles,
+			dependencies: memo.ByName(roleTemplateKind),
+		},
+		{
+			kind:         "GlobalRole",
+			informer:     options.GlobalRoles,
+			dependencies: memo.ByName(globalRoleKind),
+		},
+	}
+	for _, handler := range handlers {
+		if handler.informer == nil {
+			continue
+		}
+		if _, err := handler.informer.AddEventHandler(index.entries.EventHandler(handler.dependencies)); err != nil {
+			return nil, fmt.Errorf("failed to add %s event handler: %w", handler.kind, err)
+		}
+	}
+	return index, nil
+}
+
+// visit calls visitor with the rules granted to the subject in the scope. The rules are resolved with resolve, and
+// indexed, unless they are already indexed. Rules whose resolution failed or was short-circuited are not indexed.
+// If index is nil, the rules are always resolved.
+func (i *ruleIndex) visit(subject, scope string, resolve subjectResolver, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+	if i == nil {
+		return resolve(newRuleDependencies(), visitor)
+	}
+	key := entryKey(subject, scope)
+	if entry := i.get(subject, scope); entry != nil {
+		if entry.expired(time.Now()) {
+			i.entries.Remove(key)
+			return i.visit(subject, scope, resolve, visitor)
+		}
+		if i.selfCheck {
+			if err := i.check(subject, scope, entry, resolve); err != nil {
+				logrus.Warnf("Rule index is inconsistent, resolving the rules of %s again: %v", subject, err)
+				i.entries.Remove(key)
+				return i.visit(subject, scope, resolve, visitor)
+			}
+		}
+		for j := range entry.rules {
+			if !visitor(entry.rules[j].source, &entry.rules[j].rule, nil) {
+				return false
+			}
+		}
+		return true
+	}
+
+	generation := i.entries.Generation()
+	entry := &ruleIndexEntry{dependencies: newRuleDependencies()}
+	failed := false
+	completed := resolve(entry.dependencies, func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool {
+		if err != nil {
+			failed = true
+		}
+		if rule != nil {
+			entry.rules = append(entry.rules, indexedRule{source: source, rule: *rule})
+		}
+		return visitor(source, rule, err)
+	})
+	if completed && !failed {
+		i.store(subject, scope, entry, generation)
+	}
+	return completed
+}
+
+// check returns an error if the rules of the entry differ from the rules resolved with resolve.
+func (i *ruleIndex) check(subject, scope string, entry *ruleIndexEntry, resolve subjectResolver) error {
+	var resolved []indexedRule
+	resolve(newRuleDependencies(), func(source fmt.Stringer, rule *rbacv1.PolicyRule, _ error) bool {
+		if rule != nil {
+			resolved = append(resolved, indexedRule{source: source, rule: *rule})
+		}
+		return true
+	})
+	indexedRules, resolvedRules := describeIndexedRules(entry.rules), describeIndexedRules(resolved)
+	missing := sets.List(sets.New(resolvedRules...).Difference(sets.New(indexedRules...)))
+	extra := sets.List(sets.New(indexedRules...).Difference(sets.New(resolvedRules...)))
+	if len(missing) == 0 && len(extra) == 0 && len(indexedRules) == len(resolvedRules) {
+		return nil
+	}
+	return fmt.Errorf("indexed %d rules for %s in scope %q but resolved %d, missing: [%s], extra: [%s]", len(indexedRules),
+		subject, scope, len(resolvedRules), strings.Join(missing, "; "), strings.Join(extra, "; "))
+}
+
+// describeIndexedRules returns sorted descriptions of the rules and their sources.
+func describeIndexedRules(rules []indexedRule) []string {
+	descriptions := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		description := rule.rule.String()
+		if rule.source != nil {
+			description = rule.source.String() + ": " + description
+		}
+		descriptions = append(descriptions, description)
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+func (i *ruleIndex) get(subject, scope string) *ruleIndexEntry {
+	entry, _ := i.entries.Get(entryKey(subject, scope))
+	return entry
+}
+
+// store indexes the entry, unless one of the objects it depends on changed since generation was read.
+func (i *ruleIndex) store(subject, scope string, entry *ruleIndexEntry, generation uint64) {
+	dependencies := []memo.Dependency{{Kind: subjectKind, Name: subject}}
+	for _, name := range sets.List(entry.dependencies.roleTemplates) {
+		dependencies = append(dependencies, memo.Dependency{Kind: roleTemplateKind, Name: name})
+	}
+	for _, name := range sets.List(entry.dependencies.globalRoles) {
+		dependencies = append(dependencies, memo.Dependency{Kind: globalRoleKind, Name: name})
+	}
+	i.entries.Store(entryKey(subject, scope), entry, dependencies, generation)
+}
+
+// entryKey returns the key of the entry of the subject in the scope.
+func entryKey(subject, scope string) string {
+	return subject + "\x00" + scope
+}
@@ -0,0 +1,355 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+)
+
+var (
+	indexGetPods  = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	indexListPods = rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}}
+)
+
+// indexState holds running informers fed by fake sources, and resolvers whose caches read from the informers.
+type indexState struct {
+	roleTemplates *fcache.FakeControllerSource
+	globalRoles   *fcache.FakeControllerSource
+	crtbs         *fcache.FakeControllerSource
+	grbs          *fcache.FakeControllerSource
+	informers     []cache.SharedIndexInformer
+	crtbResolver  *CRTBRuleResolver
+	grbResolvers  *GRBRuleResolvers
+	// crtbIndexLookups counts the lookups of CRTBs by subject.
+	crtbIndexLookups atomic.Int32
+}
+
+func TestRuleIndexCRTB(t *testing.T) {
+	state := newIndexState(t, false)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods}})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "member"}, RoleTemplateNames: []string{"read"}})
+	crtb := &apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "crtb-1", Namespace: "c-1"},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "member",
+	}
+	state.crtbs.Add(crtb)
+	state.start(t)
+	userInfo := &user.DefaultInfo{Name: "u-1"}
+
+	rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+	lookups := state.crtbIndexLookups.Load()
+
+	// indexed rules are not resolved again
+	rules, err = state.crtbResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+	assert.Equal(t, lookups, state.crtbIndexLookups.Load())
+	state.assertConsistent(t, GetUserKey("u-1", "c-1"))
+
+	// changing an inherited role template updates the rules
+	state.roleTemplates.Modify(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods, indexListPods}})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Equal(c, []rbacv1.PolicyRule{indexGetPods, indexListPods}, rules)
+	}, time.Second, 10*time.Millisecond)
+	state.assertConsistent(t, GetUserKey("u-1", "c-1"))
+
+	// deleting the binding removes the rules
+	state.crtbs.Delete(crtb)
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Empty(c, rules)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRuleIndexGRB(t *testing.T) {
+	state := newIndexState(t, false)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods}})
+	state.globalRoles.Add(&apisv3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "gr-1"}, InheritedClusterRoles: []string{"read"}})
+	state.grbs.Add(&apisv3.GlobalRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "grb-1"}, UserName: "u-1", GlobalRoleName: "gr-1"})
+	state.start(t)
+	userInfo := &user.DefaultInfo{Name: "u-1"}
+
+	rules, err := state.grbResolvers.ICRResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+	// the local cluster is indexed separately
+	rules, err = state.grbResolvers.ICRResolver.RulesFor(userInfo, localCluster)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	// changing a role template inherited by the global role updates the rules
+	state.roleTemplates.Modify(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexListPods}})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.grbResolvers.ICRResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Equal(c, []rbacv1.PolicyRule{indexListPods}, rules)
+	}, time.Second, 10*time.Millisecond)
+
+	// changing the global role updates the rules
+	state.globalRoles.Modify(&apisv3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "gr-1"}})
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.grbResolvers.ICRResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Empty(c, rules)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRuleIndexExpiration(t *testing.T) {
+	state := newIndexState(t, false)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods}})
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "list"}, Rules: []rbacv1.PolicyRule{indexListPods}})
+	state.crtbs.Add(&apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "crtb-1",
+			Namespace:   "c-1",
+			Annotations: map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(2 * time.Second).Format(time.RFC3339)},
+		},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "read",
+	})
+	state.crtbs.Add(&apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "crtb-2",
+			Namespace:   "c-1",
+			Annotations: map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "list",
+	})
+	state.start(t)
+	userInfo := &user.DefaultInfo{Name: "u-1"}
+
+	// expired bindings grant nothing
+	rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+
+	// indexed rules are resolved again once a binding expires, without any informer event
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Empty(c, rules)
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestRuleIndexSelfCheck(t *testing.T) {
+	state := newIndexState(t, true)
+	state.roleTemplates.Add(&apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods}})
+	state.crtbs.Add(&apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "crtb-1", Namespace: "c-1"},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "read",
+	})
+	state.start(t)
+
+	// simulate an entry which was not invalidated
+	index := state.crtbResolver.index
+	index.store(GetUserKey("u-1", "c-1"), "", &ruleIndexEntry{
+		rules:        []indexedRule{{rule: indexListPods}},
+		dependencies: newRuleDependencies(),
+	}, index.entries.Generation())
+	require.Error(t, state.check(GetUserKey("u-1", "c-1")))
+
+	rules, err := state.crtbResolver.RulesFor(&user.DefaultInfo{Name: "u-1"}, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+	state.assertConsistent(t, GetUserKey("u-1", "c-1"))
+}
+
+func TestRuleIndexMemoizedRoleTemplates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	state := newIndexState(t, false)
+	// the memoized resolver is fed by its own informers, so that the invalidation of the memoized role templates can be
+	// delayed until after the RoleTemplate events of the index state were handled.
+	memoRoleTemplates := fcache.NewFakeControllerSource()
+	memoRoleTemplateInformer := cache.NewSharedIndexInformer(memoRoleTemplates, &apisv3.RoleTemplate{}, 0, cache.Indexers{})
+	clusterRoleInformer := cache.NewSharedIndexInformer(fcache.NewFakeControllerSource(), &rbacv1.ClusterRole{}, 0, cache.Indexers{})
+	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.RoleTemplate](ctrl)
+	roleTemplateCache.EXPECT().Get(gomock.Any()).DoAndReturn(informerGet[*apisv3.RoleTemplate](memoRoleTemplateInformer)).AnyTimes()
+	roleTemplateController := fake.NewMockNonNamespacedControllerInterface[*apisv3.RoleTemplate, *apisv3.RoleTemplateList](ctrl)
+	roleTemplateController.EXPECT().Cache().Return(roleTemplateCache).AnyTimes()
+	roleTemplateController.EXPECT().Informer().Return(memoRoleTemplateInformer).AnyTimes()
+	clusterRoleController := fake.NewMockNonNamespacedControllerInterface[*rbacv1.ClusterRole, *rbacv1.ClusterRoleList](ctrl)
+	clusterRoleController.EXPECT().Cache().Return(fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)).AnyTimes()
+	clusterRoleController.EXPECT().Informer().Return(clusterRoleInformer).AnyTimes()
+	roleTemplateResolver, err := auth.NewMemoizedRoleTemplateResolver(roleTemplateController, clusterRoleController)
+	require.NoError(t, err)
+	state.crtbResolver.RoleTemplateResolver = roleTemplateResolver
+	bindings := state.informers[2]
+	require.NoError(t, state.crtbResolver.EnableRuleIndex(bindings, RuleIndexOptions{RoleTemplates: state.informers[0]}))
+	state.informers = append(state.informers, memoRoleTemplateInformer, clusterRoleInformer)
+
+	read := &apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "read"}, Rules: []rbacv1.PolicyRule{indexGetPods}}
+	member := &apisv3.RoleTemplate{ObjectMeta: metav1.ObjectMeta{Name: "member"}, RoleTemplateNames: []string{"read"}}
+	for _, source := range []*fcache.FakeControllerSource{state.roleTemplates, memoRoleTemplates} {
+		source.Add(read.DeepCopy())
+		source.Add(member.DeepCopy())
+	}
+	state.crtbs.Add(&apisv3.ClusterRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "crtb-1", Namespace: "c-1"},
+		ClusterName:      "c-1",
+		UserName:         "u-1",
+		RoleTemplateName: "member",
+	})
+	state.start(t)
+	userInfo := &user.DefaultInfo{Name: "u-1"}
+
+	rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+
+	// The RoleTemplate events reach the handlers of the index first. Rules resolved meanwhile come from the memoized
+	// role templates, which are still stale.
+	read.Rules = []rbacv1.PolicyRule{indexListPods}
+	state.roleTemplates.Modify(read.DeepCopy())
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		obj, exists, err := state.informers[0].GetIndexer().GetByKey("read")
+		assert.NoError(c, err)
+		assert.True(c, exists)
+		assert.Equal(c, read.Rules, obj.(*apisv3.RoleTemplate).Rules)
+	}, time.Second, 10*time.Millisecond)
+	rules, err = state.crtbResolver.RulesFor(userInfo, "c-1")
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.PolicyRule{indexGetPods}, rules)
+
+	// Once the memoized role templates are invalidated, the index doesn't keep the stale rules.
+	memoRoleTemplates.Modify(read.DeepCopy())
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		rules, err := state.crtbResolver.RulesFor(userInfo, "c-1")
+		assert.NoError(c, err)
+		assert.Equal(c, []rbacv1.PolicyRule{indexListPods}, rules)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func newIndexState(t *testing.T, selfCheck bool) *indexState {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	state := &indexState{
+		roleTemplates: fcache.NewFakeControllerSource(),
+		globalRoles:   fcache.NewFakeControllerSource(),
+		crtbs:         fcache.NewFakeControllerSource(),
+		grbs:          fcache.NewFakeControllerSource(),
+	}
+	roleTemplateInformer := cache.NewSharedIndexInformer(state.roleTemplates, &apisv3.RoleTemplate{}, 0, cache.Indexers{})
+	globalRoleInformer := cache.NewSharedIndexInformer(state.globalRoles, &apisv3.GlobalRole{}, 0, cache.Indexers{})
+	crtbInformer := cache.NewSharedIndexInformer(state.crtbs, &apisv3.ClusterRoleTemplateBinding{}, 0, cache.Indexers{})
+	grbInformer := cache.NewSharedIndexInformer(state.grbs, &apisv3.GlobalRoleBinding{}, 0, cache.Indexers{})
+
+	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.RoleTemplate](ctrl)
+	roleTemplateCache.EXPECT().Get(gomock.Any()).DoAndReturn(informerGet[*apisv3.RoleTemplate](roleTemplateInformer)).AnyTimes()
+	globalRoleCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRole](ctrl)
+	globalRoleCache.EXPECT().Get(gomock.Any()).DoAndReturn(informerGet[*apisv3.GlobalRole](globalRoleInformer)).AnyTimes()
+
+	crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+	crtbCache.EXPECT().AddIndexer(crtbSubjectIndex, gomock.Any()).Do(func(name string, indexer func(*apisv3.ClusterRoleTemplateBinding) ([]string, error)) {
+		require.NoError(t, crtbInformer.AddIndexers(cache.Indexers{name: func(obj any) ([]string, error) {
+			return indexer(obj.(*apisv3.ClusterRoleTemplateBinding))
+		}}))
+	})
+	crtbCache.EXPECT().GetByIndex(crtbSubjectIndex, gomock.Any()).DoAndReturn(func(name, key string) ([]*apisv3.ClusterRoleTemplateBinding, error) {
+		state.crtbIndexLookups.Add(1)
+		return informerByIndex[*apisv3.ClusterRoleTemplateBinding](crtbInformer, name, key)
+	}).AnyTimes()
+	grbCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRoleBinding](ctrl)
+	grbCache.EXPECT().AddIndexer(grbSubjectIndex, gomock.Any()).Do(func(name string, indexer func(*apisv3.GlobalRoleBinding) ([]string, error)) {
+		require.NoError(t, grbInformer.AddIndexers(cache.Indexers{name: func(obj any) ([]string, error) {
+			return indexer(obj.(*apisv3.GlobalRoleBinding))
+		}}))
+	})
+	grbCache.EXPECT().GetByIndex(grbSubjectIndex, gomock.Any()).DoAndReturn(func(name, key string) ([]*apisv3.GlobalRoleBinding, error) {
+		return informerByIndex[*apisv3.GlobalRoleBinding](grbInformer, name, key)
+	}).AnyTimes()
+
+	roleTemplateResolver := auth.NewRoleTemplateResolver(roleTemplateCache, nil)
+	state.crtbResolver = NewCRTBRuleResolver(crtbCache, roleTemplateResolver)
+	state.grbResolvers = NewGRBRuleResolvers(grbCache, auth.NewGlobalRoleResolver(roleTemplateResolver, globalRoleCache))
+
+	options := RuleIndexOptions{RoleTemplates: roleTemplateInformer, GlobalRoles: globalRoleInformer, SelfCheck: selfCheck}
+	require.NoError(t, state.crtbResolver.EnableRuleIndex(crtbInformer, options))
+	require.NoError(t, state.grbResolvers.EnableRuleIndex(grbInformer, options))
+
+	state.informers = []cache.SharedIndexInformer{roleTemplateInformer, globalRoleInformer, crtbInformer, grbInformer}
+	return state
+}
+
+// start runs the informers until the test ends and waits for their caches to sync.
+func (s *indexState) start(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	var synced []cache.InformerSynced
+	for _, informer := range s.informers {
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+	require.True(t, cache.WaitForCacheSync(ctx.Done(), synced...))
+}
+
+// check compares the indexed CRTB rules of the subject with the rules resolved from the bindings.
+func (s *indexState) check(subject string) error {
+	entry := s.crtbResolver.index.get(subject, "")
+	if entry == nil {
+		return fmt.Errorf("%s is not indexed", subject)
+	}
+	return s.crtbResolver.index.check(subject, "", entry, func(dependencies *ruleDependencies, visitor func(source fmt.Stringer, rule *rbacv1.PolicyRule, err error) bool) bool {
+		return s.crtbResolver.visitSubjectRules(subject, dependencies, visitor)
+	})
+}
+
+func (s *indexState) assertConsistent(t *testing.T, subject string) {
+	t.Helper()
+	assert.NoError(t, s.check(subject))
+}
+
+// informerGet returns a cache Get function reading from the informer.
+func informerGet[T runtime.Object](informer cache.SharedIndexInformer) func(name string) (T, error) {
+	return func(name string) (T, error) {
+		var result T
+		obj, exists, err := informer.GetIndexer().GetByKey(name)
+		if err != nil {
+			return result, err
+		}
+		if !exists {
+			return result, errNotFound
+		}
+		return obj.(T), nil
+	}
+}
+
+// informerByIndex lists the objects of the informer with the given index key.
+func informerByIndex[T runtime.Object](informer cache.SharedIndexInformer, indexName, key string) ([]T, error) {
+	objs, err := informer.GetIndexer().ByIndex(indexName, key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, obj.(T))
+	}
+	return result, nil
+}
@@ -0,0 +1,357 @@
+package resolvers
+
+import (
+	"fmt"
+	"time"
+
+	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
+	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	userPrincipalIndex = "management.cattle.io/user-by-principal"
+	// crtbUnscopedSubjectIndex and prtbUnscopedSubjectIndex index bindings by their subject alone, in every scope.
+	crtbUnscopedSubjectIndex = "management.cattle.io/crtb-by-unscoped-subject"
+	prtbUnscopedSubjectIndex = "management.cattle.io/prtb-by-unscoped-subject"
+)
+
+// DutySubject is the subject of a binding checked against the separation of duties policy.
+type DutySubject struct {
+	// UserName is the ID of a user, e.g. u-abc.
+	UserName string
+	// UserPrincipalName is the principal of a user, e.g. openldap_user://uid=alice. It identifies the user of bindings
+	// created before Rancher sets their UserName.
+	UserPrincipalName string
+	// GroupName is the principal of a group, e.g. openldap_group://cn=admins.
+	GroupName string
+}
+
+// BindingDutySubject returns the subject of a binding to the given user or user principal, or else to the first
+// non-empty group.
+func BindingDutySubject(userName, userPrincipalName string, groupNames ...string) DutySubject {
+	if userName != "" || userPrincipalName != "" {
+		return DutySubject{UserName: userName, UserPrincipalName: userPrincipalName}
+	}
+	for _, group := range groupNames {
+		if group != "" {
+			return DutySubject{GroupName: group}
+		}
+	}
+	return DutySubject{}
+}
+
+// String returns the kind and the name of the subject, e.g. user u-abc.
+func (s DutySubject) String() string {
+	switch {
+	case s.UserName != "":
+		return "user " + s.UserName
+	case s.UserPrincipalName != "":
+		return "user " + s.UserPrincipalName
+	default:
+		return "group " + s.GroupName
+	}
+}
+
+// DutyScope is where a binding grants its role: a cluster for ClusterRoleTemplateBindings, a project and its cluster
+// for ProjectRoleTemplateBindings, and every cluster for GlobalRoleBindings, whose scope is empty.
+type DutyScope struct {
+	ClusterName string
+	// ProjectName is the name of the project in the namespace of its cluster, e.g. p-xyz.
+	ProjectName string
+}
+
+// heldRole is a role held by a subject, and the binding granting it.
+type heldRole struct {
+	role   auth.DutyRole
+	source *RuleSource
+}
+
+// SeparationOfDuties checks the roles granted by new bindings against auth.CurrentSeparationOfDutiesPolicy. The roles
+// already held by the subject of a binding are looked up with the subject indexes of the binding caches.
+type SeparationOfDuties struct {
+	crtbs          v3.ClusterRoleTemplateBindingCache
+	prtbs          v3.ProjectRoleTemplateBindingCache
+	grbs           v3.GlobalRoleBindingCache
+	globalRoles    v3.GlobalRoleCache
+	projects       v3.ProjectCache
+	users          v3.UserCache
+	userAttributes v3.UserAttributeCache
+}
+
+// NewSeparationOfDuties returns a SeparationOfDuties checker. The binding caches must be the caches of the CRTB, PRTB
+// and GRB rule resolvers, which add the subject indexes. The checker adds the indexes of the subjects of CRTBs and PRTBs
+// in every scope, to check GlobalRoleBindings. users resolves the user principals of bindings to users, and
+// userAttributes holds the groups of users. Both can be nil, in which case subjects only identified by a user principal
+// hold no role, and only the bindings of the subject itself are checked.
+func NewSeparationOfDuties(crtbs v3.ClusterRoleTemplateBindingCache, prtbs v3.ProjectRoleTemplateBindingCache,
+	grbs v3.GlobalRoleBindingCache, globalRoles v3.GlobalRoleCache, projects v3.ProjectCache, users v3.UserCache,
+	userAttributes v3.UserAttributeCache) *SeparationOfDuties {
+	crtbs.AddIndexer(crtbUnscopedSubjectIndex, crtbByUnscopedSubject)
+	prtbs.AddIndexer(prtbUnscopedSubjectIndex, prtbByUnscopedSubject)
+	if users != nil {
+		users.AddIndexer(userPrincipalIndex, usersByPrincipal)
+	}
+	return &SeparationOfDuties{
+		crtbs:          crtbs,
+		prtbs:          prtbs,
+		grbs:           grbs,
+		globalRoles:    globalRoles,
+		projects:       projects,
+		users:          users,
+		userAttributes: userAttributes,
+	}
+}
+
+// usersByPrincipal returns the principals of the user, to look users up by principal.
+func usersByPrincipal(user *apisv3.User) ([]string, error) {
+	return user.PrincipalIDs, nil
+}
+
+// crtbByUnscopedSubject returns the subject key of the CRTB without its cluster.
+func crtbByUnscopedSubject(crtb *apisv3.ClusterRoleTemplateBinding) ([]string, error) {
+	return unscopedSubjectKeys(crtb.UserName, crtb.GroupName, crtb.GroupPrincipalName), nil
+}
+
+// prtbByUnscopedSubject returns the subject key of the PRTB without its project.
+func prtbByUnscopedSubject(prtb *apisv3.ProjectRoleTemplateBinding) ([]string, error) {
+	return unscopedSubjectKeys(prtb.UserName, prtb.GroupName, prtb.GroupPrincipalName), nil
+}
+
+// unscopedSubjectKeys returns the key of the user of a binding, or else of its first non-empty group, with an empty
+// namespace.
+func unscopedSubjectKeys(userName string, groupNames ...string) []string {
+	if userName != "" {
+		return []string{GetUserKey(userName, "")}
+	}
+	for _, group := range groupNames {
+		if group != "" {
+			return []string{GetGroupKey(group, "")}
+		}
+	}
+	return nil
+}
+
+// Check returns a message describing a conflict between the role granted to the subject by a new binding and the roles
+// the subject, or the groups it is known to belong to, already holds in the scope. It returns an empty string if there
+// is no conflict.
+func (s *SeparationOfDuties) Check(subject DutySubject, scope DutyScope, role auth.DutyRole) (string, error) {
+	conflicts := auth.CurrentSeparationOfDutiesPolicy().ConflictsOf(role)
+	if len(conflicts) == 0 {
+		return "", nil
+	}
+	// role templates are only held in a scope, so they are not looked up unless they can conflict
+	withRoleTemplates := false
+	for _, conflict := range conflicts {
+		if len(conflict.RoleTemplates) > 0 {
+			withRoleTemplates = true
+		}
+	}
+	held, err := s.heldRoles(subject, scope, withRoleTemplates)
+	if err != nil {
+		return "", err
+	}
+	for _, conflict := range conflicts {
+		for _, other := range held {
+			if other.role != role && conflict.Has(other.role) {
+				return fmt.Sprintf("%s would hold %s and %s, granted by %s, which the separation of duties conflict %q forbids",
+					subject, role, other.role, other.source, conflict.Name), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// heldRoles returns the roles held in the scope by the subject and the groups it belongs to, through bindings which are
+// neither expired nor deleting.
+func (s *SeparationOfDuties) heldRoles(subject DutySubject, scope DutyScope, withRoleTemplates bool) ([]heldRole, error) {
+	subjects, err := s.subjects(subject)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := func(binding metav1.Object) bool {
+		return binding.GetDeletionTimestamp() == nil && !auth.BindingExpired(binding, now)
+	}
+
+	var held []heldRole
+	// global roles are held in every scope
+	for _, key := range subjects.keys("") {
+		grbs, err := s.grbs.GetByIndex(grbSubjectIndex, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GlobalRoleBindings of %s: %w", subject, err)
+		}
+		for _, grb := range grbs {
+			if !active(grb) {
+				continue
+			}
+			source := &RuleSource{Kind: "GlobalRoleBinding", Name: grb.Name}
+			held = append(held, heldRole{role: auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: grb.GlobalRoleName}, source: source})
+			if !withRoleTemplates {
+				continue
+			}
+			globalRole, err := s.globalRoles.Get(grb.GlobalRoleName)
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get GlobalRole %s: %w", grb.GlobalRoleName, err)
+			}
+			// the role templates inherited by a global role are bound in every cluster
+			for _, name := range globalRole.InheritedClusterRoles {
+				held = append(held, heldRole{
+					role:   auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: name},
+					source: &RuleSource{Kind: "GlobalRoleBinding", Name: grb.Name, GlobalRole: grb.GlobalRoleName},
+				})
+			}
+		}
+	}
+	if !withRoleTemplates {
+		return held, nil
+	}
+
+	crtbs, err := s.clusterRoleTemplateBindings(subjects, scope)
+	if err != nil {
+		return nil, err
+	}
+	for _, crtb := range crtbs {
+		if active(crtb) {
+			source := crtbSource(crtb)
+			held = append(held, heldRole{role: auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: crtb.RoleTemplateName}, source: &source})
+		}
+	}
+	prtbs, err := s.projectRoleTemplateBindings(subjects, scope)
+	if err != nil {
+		return nil, err
+	}
+	for _, prtb := range prtbs {
+		if active(prtb) {
+			source := prtbSource(prtb)
+			held = append(held, heldRole{role: auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: prtb.RoleTemplateName}, source: &source})
+		}
+	}
+	return held, nil
+}
+
+// clusterRoleTemplateBindings returns the CRTBs of the subjects granting a role in the scope. CRTBs grant their role in
+// their cluster and in every project of the cluster. The CRTBs of every cluster are returned for an empty scope.
+func (s *SeparationOfDuties) clusterRoleTemplateBindings(subjects dutySubjects, scope DutyScope) ([]*apisv3.ClusterRoleTemplateBinding, error) {
+	index := crtbSubjectIndex
+	if scope.ClusterName == "" {
+		index = crtbUnscopedSubjectIndex
+	}
+	var crtbs []*apisv3.ClusterRoleTemplateBinding
+	for _, key := range subjects.keys(scope.ClusterName) {
+		indexed, err := s.crtbs.GetByIndex(index, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ClusterRoleTemplateBindings with key %s: %w", key, err)
+		}
+		crtbs = append(crtbs, indexed...)
+	}
+	return crtbs, nil
+}
+
+// projectRoleTemplateBindings returns the PRTBs of the subjects granting a role in the scope, which are the PRTBs of the
+// project of the scope, or of every project of the cluster of the scope. The PRTBs of every project are returned for an
+// empty scope.
+func (s *SeparationOfDuties) projectRoleTemplateBindings(subjects dutySubjects, scope DutyScope) ([]*apisv3.ProjectRoleTemplateBinding, error) {
+	if scope.ClusterName == "" {
+		return s.prtbsByIndex(prtbUnscopedSubjectIndex, subjects.keys(""))
+	}
+	projectNames := []string{scope.ProjectName}
+	if scope.ProjectName == "" {
+		projects, err := s.projects.List(scope.ClusterName, labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list projects of cluster %s: %w", scope.ClusterName, err)
+		}
+		projectNames = make([]string, 0, len(projects))
+		for _, project := range projects {
+			projectNames = append(projectNames, project.Name)
+		}
+	}
+	var keys []string
+	for _, projectName := range projectNames {
+		keys = append(keys, subjects.keys(projectName)...)
+	}
+	return s.prtbsByIndex(prtbSubjectIndex, keys)
+}
+
+// prtbsByIndex returns the PRTBs indexed with the keys in the index.
+func (s *SeparationOfDuties) prtbsByIndex(index string, keys []string) ([]*apisv3.ProjectRoleTemplateBinding, error) {
+	var prtbs []*apisv3.ProjectRoleTemplateBinding
+	for _, key := range keys {
+		indexed, err := s.prtbs.GetByIndex(index, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ProjectRoleTemplateBindings with key %s: %w", key, err)
+		}
+		prtbs = append(prtbs, indexed...)
+	}
+	return prtbs, nil
+}
+
+// dutySubjects are a subject and the groups it is known to belong to.
+type dutySubjects struct {
+	userName string
+	groups   sets.Set[string]
+}
+
+// subjects returns the subject and the groups of the user attributes of a user subject.
+func (s *SeparationOfDuties) subjects(subject DutySubject) (dutySubjects, error) {
+	userName, err := s.userName(subject)
+	if err != nil {
+		return dutySubjects{}, err
+	}
+	subjects := dutySubjects{userName: userName, groups: sets.New[string]()}
+	if subject.GroupName != "" {
+		subjects.groups.Insert(subject.GroupName)
+	}
+	if userName == "" || s.userAttributes == nil {
+		return subjects, nil
+	}
+	attributes, err := s.userAttributes.Get(userName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return subjects, nil
+		}
+		return subjects, fmt.Errorf("failed to get the groups of user %s: %w", userName, err)
+	}
+	for _, principals := range attributes.GroupPrincipals {
+		for _, principal := range principals.Items {
+			subjects.groups.Insert(principal.Name)
+		}
+	}
+	return subjects, nil
+}
+
+// userName returns the name of the user of the subject, looking the user up by principal when the subject only has a
+// user principal. It returns an empty string if no user has the principal yet, which is the case until Rancher creates
+// the user of a principal which never logged in.
+func (s *SeparationOfDuties) userName(subject DutySubject) (string, error) {
+	if subject.UserName != "" || subject.UserPrincipalName == "" || s.users == nil {
+		return subject.UserName, nil
+	}
+	users, err := s.users.GetByIndex(userPrincipalIndex, subject.UserPrincipalName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the user of principal %s: %w", subject.UserPrincipalName, err)
+	}
+	if len(users) == 0 {
+		return "", nil
+	}
+	return users[0].Name, nil
+}
+
+// keys returns the subject index keys of the subjects in the namespace.
+func (s dutySubjects) keys(namespace string) []string {
+	keys := make([]string, 0, s.groups.Len()+1)
+	if s.userName != "" {
+		keys = append(keys, GetUserKey(s.userName, namespace))
+	}
+	for _, group := range sets.List(s.groups) {
+		keys = append(keys, GetGroupKey(group, namespace))
+	}
+	return keys
+}
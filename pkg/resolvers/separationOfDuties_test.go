@@ -0,0 +1,206 @@
+package resolvers
+
+import (
+	"testing"
+	"time"
+
+	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// indexedCache returns lookups by index key and a list of the objects, as served by a cache with the subject indexer.
+func indexedCache[T any](objects []T, bySubject func(T) ([]string, error)) (func(string, string) ([]T, error), func(string, any) ([]T, error)) {
+	index := map[string][]T{}
+	for _, object := range objects {
+		keys, _ := bySubject(object)
+		for _, key := range keys {
+			index[key] = append(index[key], object)
+		}
+	}
+	getByIndex := func(_, key string) ([]T, error) { return index[key], nil }
+	list := func(string, any) ([]T, error) { return objects, nil }
+	return getByIndex, list
+}
+
+func TestSeparationOfDuties(t *testing.T) {
+	policy := auth.SeparationOfDutiesPolicy{
+		Conflicts: []auth.DutyConflict{
+			{Name: "owner-auditor", RoleTemplates: []string{"cluster-owner", "auditor"}, GlobalRoles: []string{"global-auditor"}},
+		},
+	}
+	auth.SetSeparationOfDutiesPolicy(&policy)
+	defer auth.SetSeparationOfDutiesPolicy(nil)
+
+	crtbs := []*apisv3.ClusterRoleTemplateBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "crtb-owner", Namespace: "c-1"}, ClusterName: "c-1", UserName: "u-owner", RoleTemplateName: "cluster-owner"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "crtb-group", Namespace: "c-1"}, ClusterName: "c-1", GroupPrincipalName: "local://owners", RoleTemplateName: "cluster-owner"},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "crtb-expired", Namespace: "c-1", Annotations: map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(-time.Hour).Format(time.RFC3339)}},
+			ClusterName: "c-1", UserName: "u-expired", RoleTemplateName: "cluster-owner",
+		},
+	}
+	prtbs := []*apisv3.ProjectRoleTemplateBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "prtb-auditor", Namespace: "p-1"}, ProjectName: "c-1:p-1", UserName: "u-project", RoleTemplateName: "auditor"},
+	}
+	grbs := []*apisv3.GlobalRoleBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "grb-auditor"}, UserName: "u-global", GlobalRoleName: "global-auditor"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "grb-inherited"}, UserName: "u-inherited", GlobalRoleName: "inherits-owner"},
+	}
+
+	ctrl := gomock.NewController(t)
+	crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+	crtbCache.EXPECT().AddIndexer(crtbUnscopedSubjectIndex, gomock.Any())
+	crtbGetByIndex, _ := indexedCache(crtbs, crtbBySubject)
+	crtbCache.EXPECT().GetByIndex(crtbSubjectIndex, gomock.Any()).DoAndReturn(crtbGetByIndex).AnyTimes()
+	crtbGetByUnscopedIndex, _ := indexedCache(crtbs, crtbByUnscopedSubject)
+	crtbCache.EXPECT().GetByIndex(crtbUnscopedSubjectIndex, gomock.Any()).DoAndReturn(crtbGetByUnscopedIndex).AnyTimes()
+	prtbCache := fake.NewMockCacheInterface[*apisv3.ProjectRoleTemplateBinding](ctrl)
+	prtbCache.EXPECT().AddIndexer(prtbUnscopedSubjectIndex, gomock.Any())
+	prtbGetByIndex, _ := indexedCache(prtbs, prtbBySubject)
+	prtbCache.EXPECT().GetByIndex(prtbSubjectIndex, gomock.Any()).DoAndReturn(prtbGetByIndex).AnyTimes()
+	prtbGetByUnscopedIndex, _ := indexedCache(prtbs, prtbByUnscopedSubject)
+	prtbCache.EXPECT().GetByIndex(prtbUnscopedSubjectIndex, gomock.Any()).DoAndReturn(prtbGetByUnscopedIndex).AnyTimes()
+	grbCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRoleBinding](ctrl)
+	grbGetByIndex, _ := indexedCache(grbs, grbBySubject)
+	grbCache.EXPECT().GetByIndex(grbSubjectIndex, gomock.Any()).DoAndReturn(grbGetByIndex).AnyTimes()
+	grCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRole](ctrl)
+	grCache.EXPECT().Get("global-auditor").Return(&apisv3.GlobalRole{ObjectMeta: metav1.ObjectMeta{Name: "global-auditor"}}, nil).AnyTimes()
+	grCache.EXPECT().Get("inherits-owner").Return(&apisv3.GlobalRole{
+		ObjectMeta:            metav1.ObjectMeta{Name: "inherits-owner"},
+		InheritedClusterRoles: []string{"cluster-owner"},
+	}, nil).AnyTimes()
+	projectCache := fake.NewMockCacheInterface[*apisv3.Project](ctrl)
+	projectCache.EXPECT().List("c-1", gomock.Any()).Return([]*apisv3.Project{{ObjectMeta: metav1.ObjectMeta{Name: "p-1", Namespace: "c-1"}}}, nil).AnyTimes()
+	projectCache.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	userAttributeCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.UserAttribute](ctrl)
+	userAttributeCache.EXPECT().Get("u-member").Return(&apisv3.UserAttribute{
+		GroupPrincipals: map[string]apisv3.Principals{
+			"local": {Items: []apisv3.Principal{{ObjectMeta: metav1.ObjectMeta{Name: "local://owners"}}}},
+		},
+	}, nil).AnyTimes()
+	userAttributeCache.EXPECT().Get(gomock.Any()).Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "")).AnyTimes()
+
+	userCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.User](ctrl)
+	userCache.EXPECT().AddIndexer(userPrincipalIndex, gomock.Any())
+	userGetByIndex, _ := indexedCache([]*apisv3.User{
+		{ObjectMeta: metav1.ObjectMeta{Name: "u-owner"}, PrincipalIDs: []string{"openldap_user://uid=owner", "local://u-owner"}},
+	}, usersByPrincipal)
+	userCache.EXPECT().GetByIndex(userPrincipalIndex, gomock.Any()).DoAndReturn(userGetByIndex).AnyTimes()
+
+	checker := NewSeparationOfDuties(crtbCache, prtbCache, grbCache, grCache, projectCache, userCache, userAttributeCache)
+	auditor := auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: "auditor"}
+	owner := auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: "cluster-owner"}
+	tests := []struct {
+		name    string
+		subject DutySubject
+		scope   DutyScope
+		role    auth.DutyRole
+		want    string
+	}{
+		{
+			name:    "auditor in the cluster of an owner",
+			subject: DutySubject{UserName: "u-owner"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    auditor,
+			want:    `user u-owner would hold RoleTemplate auditor and RoleTemplate cluster-owner, granted by ClusterRoleTemplateBinding c-1/crtb-owner, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor in a project of the cluster of an owner",
+			subject: DutySubject{UserName: "u-owner"},
+			scope:   DutyScope{ClusterName: "c-1", ProjectName: "p-2"},
+			role:    auditor,
+			want:    `user u-owner would hold RoleTemplate auditor and RoleTemplate cluster-owner, granted by ClusterRoleTemplateBinding c-1/crtb-owner, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor in another cluster",
+			subject: DutySubject{UserName: "u-owner"},
+			scope:   DutyScope{ClusterName: "c-2"},
+			role:    auditor,
+		},
+		{
+			name:    "the same role twice",
+			subject: DutySubject{UserName: "u-owner"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    owner,
+		},
+		{
+			name:    "role outside of the policy",
+			subject: DutySubject{UserName: "u-owner"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: "project-member"},
+		},
+		{
+			name:    "owner of the cluster of a project auditor",
+			subject: DutySubject{UserName: "u-project"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    owner,
+			want:    `user u-project would hold RoleTemplate cluster-owner and RoleTemplate auditor, granted by ProjectRoleTemplateBinding p-1/prtb-auditor, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor through the group of a user",
+			subject: DutySubject{UserName: "u-member"},
+			scope:   DutyScope{ClusterName: "c-1", ProjectName: "p-1"},
+			role:    auditor,
+			want:    `user u-member would hold RoleTemplate auditor and RoleTemplate cluster-owner, granted by ClusterRoleTemplateBinding c-1/crtb-group, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "expired bindings are ignored",
+			subject: DutySubject{UserName: "u-expired"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    auditor,
+		},
+		{
+			name:    "owner of a global auditor",
+			subject: DutySubject{UserName: "u-global"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    owner,
+			want:    `user u-global would hold RoleTemplate cluster-owner and GlobalRole global-auditor, granted by GlobalRoleBinding grb-auditor, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor of a user inheriting owner from a global role",
+			subject: DutySubject{UserName: "u-inherited"},
+			scope:   DutyScope{ClusterName: "c-3"},
+			role:    auditor,
+			want:    `user u-inherited would hold RoleTemplate auditor and RoleTemplate cluster-owner, granted by GlobalRoleBinding grb-inherited, GlobalRole inherits-owner, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "global auditor of a project auditor",
+			subject: DutySubject{UserName: "u-project"},
+			role:    auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: "global-auditor"},
+			want:    `user u-project would hold GlobalRole global-auditor and RoleTemplate auditor, granted by ProjectRoleTemplateBinding p-1/prtb-auditor, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor given to the principal of an owner",
+			subject: DutySubject{UserPrincipalName: "openldap_user://uid=owner"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    auditor,
+			want:    `user openldap_user://uid=owner would hold RoleTemplate auditor and RoleTemplate cluster-owner, granted by ClusterRoleTemplateBinding c-1/crtb-owner, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+		{
+			name:    "auditor given to a principal without user",
+			subject: DutySubject{UserPrincipalName: "openldap_user://uid=new"},
+			scope:   DutyScope{ClusterName: "c-1"},
+			role:    auditor,
+		},
+		{
+			name:    "global auditor of a group owner",
+			subject: DutySubject{GroupName: "local://owners"},
+			role:    auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: "global-auditor"},
+			want:    `group local://owners would hold GlobalRole global-auditor and RoleTemplate cluster-owner, granted by ClusterRoleTemplateBinding c-1/crtb-group, which the separation of duties conflict "owner-auditor" forbids`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflict, err := checker.Check(test.subject, test.scope, test.role)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, conflict)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"errors"
+
 	"github.com/rancher/webhook/pkg/admission"
 	"github.com/rancher/webhook/pkg/auth"
 	"github.com/sirupsen/logrus"
@@ -101,6 +103,8 @@ func (c *CachedVerbChecker) IsRulesAllowed(rules []v1.PolicyRule, resolver valid
 }
 
 // HasVerb returns if the request has the overrideVerb. Only checks the request the first time called, after that it returns the cached value.
+// The SubjectAccessReview honors the deadline of the request; once it has expired, HasVerb returns false and the
+// webhook reports the request as timed out.
 func (c *CachedVerbChecker) HasVerb() bool {
 	var err error
 	if c.hasVerbBeenChecked {
@@ -109,6 +113,8 @@ func (c *CachedVerbChecker) HasVerb() bool {
 	c.hasVerb, err = auth.RequestUserHasVerb(c.request, c.gvr, c.sar, c.overrideVerb, c.name, "")
 	if err != nil {
 		logrus.Errorf("Failed to check for the verb %s on %s: %v", c.overrideVerb, c.gvr.Resource, err)
+		// once the deadline of the request has expired, later checks would fail as well
+		c.hasVerbBeenChecked = errors.Is(err, admission.ErrTimedOut)
 		return false
 	}
 	c.hasVerbBeenChecked = true
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// ValidateBindingExpiration validates the expiration annotation of a binding. oldBinding is nil on create. New
+// expirations must be in the future and within the maximum binding TTL. Postponing or removing the expiration of a
+// binding requires the extend-expiration verb on the binding. It returns a denial response, or nil if the expiration
+// is valid.
+func ValidateBindingExpiration(request *admission.Request, gvr schema.GroupVersionResource, sar authorizationv1.SubjectAccessReviewInterface,
+	oldBinding, newBinding metav1.Object, fieldPath *field.Path) (*admissionv1.AdmissionResponse, error) {
+	annotationPath := fieldPath.Child("metadata", "annotations").Key(auth.ExpiresAtAnnotation)
+	newValue, newHasValue := newBinding.GetAnnotations()[auth.ExpiresAtAnnotation]
+	if oldBinding != nil {
+		oldValue, oldHasValue := oldBinding.GetAnnotations()[auth.ExpiresAtAnnotation]
+		if oldValue == newValue && oldHasValue == newHasValue {
+			return nil, nil
+		}
+	}
+
+	newExpiresAt, newExpires, err := auth.BindingExpiration(newBinding)
+	if err != nil {
+		return admission.ResponseBadRequest(field.Invalid(annotationPath, newValue, "must be an RFC3339 time").Error()), nil
+	}
+	if newExpires {
+		current := time.Now()
+		if !newExpiresAt.After(current) {
+			return admission.ResponseBadRequest(field.Invalid(annotationPath, newValue, "must be in the future").Error()), nil
+		}
+		if maxTTL := auth.CurrentMaxBindingTTL(); newExpiresAt.After(current.Add(maxTTL)) {
+			return admission.ResponseBadRequest(field.Invalid(annotationPath, newValue,
+				fmt.Sprintf("must be at most %s in the future", maxTTL)).Error()), nil
+		}
+	}
+	if oldBinding == nil {
+		return nil, nil
+	}
+
+	// an invalid old expiration is handled as already expired, so any change to it postpones it
+	oldExpiresAt, oldExpires, _ := auth.BindingExpiration(oldBinding)
+	if !oldExpires || (newExpires && !newExpiresAt.After(oldExpiresAt)) {
+		return nil, nil
+	}
+	allowed, err := auth.RequestUserHasVerb(request, gvr, sar, auth.ExtendExpirationVerb, newBinding.GetName(), newBinding.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if user can extend the expiration of binding %s: %w", newBinding.GetName(), err)
+	}
+	if !allowed {
+		return admission.ResponseFailedEscalation(fmt.Sprintf("user %s is not allowed to postpone or remove the expiration of binding %s without the %s verb",
+			request.Principal(), newBinding.GetName(), auth.ExtendExpirationVerb)), nil
+	}
+	return nil, nil
+}
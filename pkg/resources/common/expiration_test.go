@@ -0,0 +1,152 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	k8fake "k8s.io/client-go/kubernetes/typed/authorization/v1/fake"
+	k8testing "k8s.io/client-go/testing"
+)
+
+func TestValidateBindingExpiration(t *testing.T) {
+	t.Parallel()
+	gvr := schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "clusterroletemplatebindings"}
+	inADay := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	inTwoDays := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	binding := func(expiresAt string) metav1.Object {
+		meta := &metav1.ObjectMeta{Name: "binding", Namespace: "c-123"}
+		if expiresAt != "" {
+			meta.Annotations = map[string]string{auth.ExpiresAtAnnotation: expiresAt}
+		}
+		return meta
+	}
+
+	tests := []struct {
+		name       string
+		oldBinding metav1.Object
+		newBinding metav1.Object
+		hasVerb    bool
+		wantCode   int32
+		wantSAR    bool
+	}{
+		{
+			name:       "create without expiration",
+			newBinding: binding(""),
+		},
+		{
+			name:       "create with expiration",
+			newBinding: binding(inADay),
+		},
+		{
+			name:       "create with invalid expiration",
+			newBinding: binding("tomorrow"),
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "create with past expiration",
+			newBinding: binding(time.Now().Add(-time.Hour).Format(time.RFC3339)),
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "create with expiration beyond the max TTL",
+			newBinding: binding(time.Now().Add(auth.DefaultMaxBindingTTL + time.Hour).Format(time.RFC3339)),
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "update without changing the expiration",
+			oldBinding: binding(inADay),
+			newBinding: binding(inADay),
+		},
+		{
+			name:       "update adding an expiration",
+			oldBinding: binding(""),
+			newBinding: binding(inADay),
+		},
+		{
+			name:       "update shortening the expiration",
+			oldBinding: binding(inTwoDays),
+			newBinding: binding(inADay),
+		},
+		{
+			name:       "update postponing the expiration without the verb",
+			oldBinding: binding(inADay),
+			newBinding: binding(inTwoDays),
+			wantCode:   http.StatusForbidden,
+			wantSAR:    true,
+		},
+		{
+			name:       "update postponing the expiration with the verb",
+			oldBinding: binding(inADay),
+			newBinding: binding(inTwoDays),
+			hasVerb:    true,
+			wantSAR:    true,
+		},
+		{
+			name:       "update removing the expiration without the verb",
+			oldBinding: binding(inADay),
+			newBinding: binding(""),
+			wantCode:   http.StatusForbidden,
+			wantSAR:    true,
+		},
+		{
+			name:       "update removing the expiration with the verb",
+			oldBinding: binding(inADay),
+			newBinding: binding(""),
+			hasVerb:    true,
+			wantSAR:    true,
+		},
+		{
+			name:       "update fixing an invalid expiration without the verb",
+			oldBinding: binding("tomorrow"),
+			newBinding: binding(inADay),
+			wantCode:   http.StatusForbidden,
+			wantSAR:    true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			sarCalled := false
+			k8Fake := &k8testing.Fake{}
+			fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+			fakeSAR.Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (bool, runtime.Object, error) {
+				sarCalled = true
+				review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+				assert.Equal(t, auth.ExtendExpirationVerb, review.Spec.ResourceAttributes.Verb)
+				assert.Equal(t, "binding", review.Spec.ResourceAttributes.Name)
+				assert.Equal(t, "c-123", review.Spec.ResourceAttributes.Namespace)
+				review.Status.Allowed = test.hasVerb
+				return true, review, nil
+			})
+			request := &admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					UserInfo: authenticationv1.UserInfo{Username: "u-abc"},
+				},
+			}
+
+			response, err := ValidateBindingExpiration(request, gvr, fakeSAR, test.oldBinding, test.newBinding, field.NewPath("binding"))
+			require.NoError(t, err)
+			assert.Equal(t, test.wantSAR, sarCalled)
+			if test.wantCode == 0 {
+				assert.Nil(t, response)
+				return
+			}
+			require.NotNil(t, response)
+			assert.False(t, response.Allowed)
+			assert.Equal(t, test.wantCode, response.Result.Code)
+		})
+	}
+}
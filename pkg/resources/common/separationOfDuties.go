@@ -0,0 +1,29 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/resolvers"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// CheckSeparationOfDuties returns a denial response if the role granted by a new binding conflicts with a role its
+// subject already holds in the scope, according to auth.CurrentSeparationOfDutiesPolicy. It returns nil if there is no
+// conflict, or if checker is nil.
+func CheckSeparationOfDuties(checker *resolvers.SeparationOfDuties, subject resolvers.DutySubject, scope resolvers.DutyScope,
+	role auth.DutyRole, fieldPath *field.Path) (*admissionv1.AdmissionResponse, error) {
+	if checker == nil {
+		return nil, nil
+	}
+	conflict, err := checker.Check(subject, scope, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check separation of duties: %w", err)
+	}
+	if conflict == "" {
+		return nil, nil
+	}
+	return admission.ResponseBadRequest(field.Forbidden(fieldPath, conflict).Error()), nil
+}
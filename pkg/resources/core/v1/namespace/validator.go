@@ -92,3 +92,9 @@ func (v *Validator) ValidatingWebhook(clientConfig admissionv1.WebhookClientConf
 func (v *Validator) Admitters() []admission.Admitter {
 	return []admission.Admitter{&v.psaAdmitter, &v.projectNamespaceAdmitter}
 }
+
+// CollectAllFailures returns true so that a namespace violating both the PSA label and the project checks is denied
+// with both failures at once.
+func (v *Validator) CollectAllFailures() bool {
+	return true
+}
@@ -3,6 +3,7 @@ package namespace
 import (
 	"testing"
 
+	"github.com/rancher/webhook/pkg/admission"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -48,6 +49,13 @@ func TestAdmitters(t *testing.T) {
 	assert.True(t, hasProjectNamespaceAdmitter, "admitters did not contain a projectNamespaceAdmitter")
 }
 
+func TestCollectAllFailures(t *testing.T) {
+	var validator admission.ValidatingAdmissionHandler = NewValidator(nil)
+	collecting, ok := validator.(admission.CollectingAdmissionHandler)
+	assert.True(t, ok, "namespace validator is not a CollectingAdmissionHandler")
+	assert.True(t, collecting.CollectAllFailures())
+}
+
 func TestValidatingWebhook(t *testing.T) {
 	testURL := "test.cattle.io"
 	clientConfig := v1.WebhookClientConfig{
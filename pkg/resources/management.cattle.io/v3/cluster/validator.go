@@ -46,6 +46,14 @@ type Validator struct {
 	admitter admitter
 }
 
+// ImmutableFields returns the immutability rules of management clusters. The fleetWorkspaceName can't be unset once
+// set, since unsetting it would (likely unintentionally) delete the cluster, but moving the cluster to another
+// workspace is allowed, as checked by the admitter. Clusters being deleted have an empty fleetWorkspaceName, but
+// deletions are not updates.
+func (v *Validator) ImmutableFields() []admission.ImmutabilityRule {
+	return []admission.ImmutabilityRule{{Fields: []string{"spec.fleetWorkspaceName"}, AllowSet: true, AllowChange: true}}
+}
+
 // GVR returns the GroupVersionKind for this CRD.
 func (v *Validator) GVR() schema.GroupVersionResource {
 	return managementGVR
@@ -138,22 +146,7 @@ func toExtra(extra map[string]authenticationv1.ExtraValue) map[string]v1.ExtraVa
 
 // validateFleetPermissions validates whether the request maker has required permissions around FleetWorkspace.
 func (a *admitter) validateFleetPermissions(request *admission.Request, oldCluster, newCluster *apisv3.Cluster) (*admissionv1.AdmissionResponse, error) {
-	// Ensure that the FleetWorkspaceName field cannot be unset once it is set, as it would cause (likely unintentional)
-	// cluster deletion. Note that we're only enforcing this rule on UPDATE because Spec.FleetWorkspaceName will be
-	// empty on cluster deletion, which is fine.
-	fleetWorkspaceUnset := newCluster.Spec.FleetWorkspaceName == "" && oldCluster.Spec.FleetWorkspaceName != ""
-	if request.Operation == admissionv1.Update && fleetWorkspaceUnset {
-		return &admissionv1.AdmissionResponse{
-			Result: &metav1.Status{
-				Status:  "Failure",
-				Message: "once set, field FleetWorkspaceName cannot be made empty",
-				Reason:  metav1.StatusReasonInvalid,
-				Code:    http.StatusBadRequest,
-			},
-			Allowed: false,
-		}, nil
-	}
-
+	// Unsetting the FleetWorkspaceName is denied by the rules of ImmutableFields.
 	// If the FleetWorkspaceName is empty or unchanged, there's no need to make a SAR request.
 	if newCluster.Spec.FleetWorkspaceName == "" || oldCluster.Spec.FleetWorkspaceName == newCluster.Spec.FleetWorkspaceName {
 		return &admissionv1.AdmissionResponse{
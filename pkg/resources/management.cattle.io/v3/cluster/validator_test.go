@@ -113,7 +113,7 @@ func TestAdmit(t *testing.T) {
 			oldCluster:     v3.Cluster{Spec: v3.ClusterSpec{FleetWorkspaceName: "fleet-default"}},
 			operation:      admissionv1.Update,
 			expectAllowed:  false,
-			expectedReason: metav1.StatusReasonInvalid,
+			expectedReason: metav1.StatusReasonBadRequest,
 		},
 		{
 			name:          "UpdateWithNewFleetWorkspaceName",
@@ -325,10 +325,9 @@ func TestAdmit(t *testing.T) {
 			newClusterBytes, err := json.Marshal(tt.newCluster)
 			assert.NoError(t, err)
 
-			admitters := v.Admitters()
-			assert.Len(t, admitters, 1)
+			assert.Len(t, v.Admitters(), 1)
 
-			res, err := admitters[0].Admit(&admission.Request{
+			res, err := validate(v, &admission.Request{
 				AdmissionRequest: admissionv1.AdmissionRequest{
 					Object: runtime.RawExtension{
 						Raw: newClusterBytes,
@@ -350,3 +349,22 @@ func TestAdmit(t *testing.T) {
 		})
 	}
 }
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*admissionv1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
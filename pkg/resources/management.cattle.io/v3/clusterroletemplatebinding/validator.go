@@ -4,6 +4,7 @@ package clusterroletemplatebinding
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/admission"
@@ -11,11 +12,15 @@ import (
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	objectsv3 "github.com/rancher/webhook/pkg/generated/objects/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/resolvers"
+	"github.com/rancher/webhook/pkg/resources/common"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
 	k8validation "k8s.io/kubernetes/pkg/registry/rbac/validation"
 	"k8s.io/utils/trace"
 )
@@ -28,18 +33,26 @@ var gvr = schema.GroupVersionResource{
 
 const (
 	grbOwnerLabel = "authz.management.cattle.io/grb-owner"
+	// clusterOwnerRole is the role template making its subjects owners of the cluster.
+	clusterOwnerRole = "cluster-owner"
+	// deleteLastOwnerVerb allows deleting the last cluster-owner binding of a cluster.
+	deleteLastOwnerVerb = "delete-last-owner"
 )
 
 // NewValidator will create a newly allocated Validator.
 func NewValidator(crtb *resolvers.CRTBRuleResolver, defaultResolver k8validation.AuthorizationRuleResolver,
-	roleTemplateResolver *auth.RoleTemplateResolver, grbCache v3.GlobalRoleBindingCache, clusterCache v3.ClusterCache) *Validator {
+	roleTemplateResolver *auth.RoleTemplateResolver, grbCache v3.GlobalRoleBindingCache, clusterCache v3.ClusterCache,
+	sar authorizationv1.SubjectAccessReviewInterface, separationOfDuties *resolvers.SeparationOfDuties) *Validator {
 	resolver := resolvers.NewAggregateRuleResolver(defaultResolver, crtb)
 	return &Validator{
 		admitter: admitter{
+			crtbCache:            crtb.ClusterRoleTemplateBindings,
 			resolver:             resolver,
 			roleTemplateResolver: roleTemplateResolver,
 			grbCache:             grbCache,
 			clusterCache:         clusterCache,
+			sar:                  sar,
+			separationOfDuties:   separationOfDuties,
 		},
 	}
 }
@@ -49,6 +62,15 @@ type Validator struct {
 	admitter admitter
 }
 
+// ImmutableFields returns the immutability rules of CRTBs. The subject of the binding can only be completed, e.g. by
+// setting the userName of a binding created with a userPrincipalName.
+func (v *Validator) ImmutableFields() []admission.ImmutabilityRule {
+	return []admission.ImmutabilityRule{
+		{Fields: []string{"roleTemplateName", "clusterName"}, Labels: []string{grbOwnerLabel}},
+		{Fields: []string{"userName", "userPrincipalName", "groupName", "groupPrincipalName"}, AllowSet: true},
+	}
+}
+
 // GVR returns the GroupVersionKind for this CRD.
 func (v *Validator) GVR() schema.GroupVersionResource {
 	return gvr
@@ -56,7 +78,7 @@ func (v *Validator) GVR() schema.GroupVersionResource {
 
 // Operations returns list of operations handled by this validator.
 func (v *Validator) Operations() []admissionregistrationv1.OperationType {
-	return []admissionregistrationv1.OperationType{admissionregistrationv1.Update, admissionregistrationv1.Create}
+	return []admissionregistrationv1.OperationType{admissionregistrationv1.Update, admissionregistrationv1.Create, admissionregistrationv1.Delete}
 }
 
 // ValidatingWebhook returns the ValidatingWebhook used for this CRD.
@@ -70,10 +92,13 @@ func (v *Validator) Admitters() []admission.Admitter {
 }
 
 type admitter struct {
+	crtbCache            v3.ClusterRoleTemplateBindingCache
 	resolver             k8validation.AuthorizationRuleResolver
 	roleTemplateResolver *auth.RoleTemplateResolver
 	grbCache             v3.GlobalRoleBindingCache
 	clusterCache         v3.ClusterCache
+	sar                  authorizationv1.SubjectAccessReviewInterface
+	separationOfDuties   *resolvers.SeparationOfDuties
 }
 
 // Admit is the entrypoint for the validator. Admit will return an error if it unable to process the request.
@@ -84,11 +109,22 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 
 	fieldPath := field.NewPath("clusterroletemplatebinding")
 
+	if request.Operation == admissionv1.Delete {
+		return a.validateDelete(request, fieldPath)
+	}
+
+	// oldBinding stays nil on create
+	var oldBinding metav1.Object
+	checkDuties := request.Operation == admissionv1.Create
 	if request.Operation == admissionv1.Update {
 		oldCRTB, newCRTB, err := objectsv3.ClusterRoleTemplateBindingOldAndNewFromRequest(&request.AdmissionRequest)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode old and new CRTB from request: %w", err)
 		}
+		oldBinding = oldCRTB
+		// Rancher sets the userName of bindings created with a userPrincipalName later on, which can resolve their
+		// subject to a user holding conflicting roles
+		checkDuties = dutySubject(oldCRTB) != dutySubject(newCRTB)
 
 		if err := validateUpdateFields(oldCRTB, newCRTB, fieldPath); err != nil {
 			return admission.ResponseBadRequest(err.Error()), nil
@@ -110,6 +146,18 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		}
 	}
 
+	if checkDuties {
+		scope := resolvers.DutyScope{ClusterName: crtb.ClusterName}
+		role := auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: crtb.RoleTemplateName}
+		if response, err := common.CheckSeparationOfDuties(a.separationOfDuties, dutySubject(crtb), scope, role, fieldPath); response != nil || err != nil {
+			return response, err
+		}
+	}
+
+	if response, err := common.ValidateBindingExpiration(request, gvr, a.sar, oldBinding, crtb, fieldPath); response != nil || err != nil {
+		return response, err
+	}
+
 	roleTemplate, err := a.roleTemplateResolver.RoleTemplateCache().Get(crtb.RoleTemplateName)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -128,30 +176,66 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 	return response, nil
 }
 
-// validUpdateFields checks if the fields being changed are valid update fields.
+// validateDelete denies deleting the last cluster-owner binding of a cluster, which would leave the cluster without
+// owners, unless the cluster is being deleted or the user has the delete-last-owner verb on the binding.
+func (a *admitter) validateDelete(request *admission.Request, fieldPath *field.Path) (*admissionv1.AdmissionResponse, error) {
+	crtb, err := objectsv3.ClusterRoleTemplateBindingFromRequest(&request.AdmissionRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CRTB from request: %w", err)
+	}
+	now := time.Now()
+	// bindings which are already deleting or expired do not make anyone an owner
+	if crtb.RoleTemplateName != clusterOwnerRole || crtb.DeletionTimestamp != nil || auth.BindingExpired(crtb, now) {
+		return admission.ResponseAllowed(), nil
+	}
+
+	cluster, err := a.clusterCache.Get(crtb.ClusterName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.ResponseAllowed(), nil
+		}
+		return nil, fmt.Errorf("failed to get cluster %s: %w", crtb.ClusterName, err)
+	}
+	if cluster.DeletionTimestamp != nil {
+		return admission.ResponseAllowed(), nil
+	}
+
+	crtbs, err := a.crtbCache.List(crtb.Namespace, labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CRTBs in namespace %s: %w", crtb.Namespace, err)
+	}
+	for _, other := range crtbs {
+		if other.Name != crtb.Name && other.ClusterName == crtb.ClusterName && other.RoleTemplateName == clusterOwnerRole &&
+			other.DeletionTimestamp == nil && !auth.BindingExpired(other, now) {
+			return admission.ResponseAllowed(), nil
+		}
+	}
+
+	allowed, err := auth.RequestUserHasVerb(request, gvr, a.sar, deleteLastOwnerVerb, crtb.Name, crtb.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if user can delete the last owner of cluster %s: %w", crtb.ClusterName, err)
+	}
+	if allowed {
+		return admission.ResponseAllowed(), nil
+	}
+	fieldErr := field.Forbidden(fieldPath, fmt.Sprintf("binding %s is the last %s binding of cluster %s, deleting it requires the %s verb",
+		crtb.Name, clusterOwnerRole, crtb.ClusterName, deleteLastOwnerVerb))
+	return admission.ResponseBadRequest(fieldErr.Error()), nil
+}
+
+// dutySubject returns the subject of the CRTB checked against the separation of duties policy.
+func dutySubject(crtb *apisv3.ClusterRoleTemplateBinding) resolvers.DutySubject {
+	return resolvers.BindingDutySubject(crtb.UserName, crtb.UserPrincipalName, crtb.GroupPrincipalName, crtb.GroupName)
+}
+
+// validateUpdateFields checks that the binding still targets either a user or a group. The immutable fields are
+// checked by the rules of ImmutableFields.
 func validateUpdateFields(oldCRTB, newCRTB *apisv3.ClusterRoleTemplateBinding, fieldPath *field.Path) *field.Error {
-	const reason = "field is immutable"
-	switch {
-	case oldCRTB.RoleTemplateName != newCRTB.RoleTemplateName:
-		return field.Invalid(fieldPath.Child("roleTemplateName"), newCRTB.RoleTemplateName, reason)
-	case oldCRTB.ClusterName != newCRTB.ClusterName:
-		return field.Invalid(fieldPath.Child("clusterName"), newCRTB.ClusterName, reason)
-	case oldCRTB.UserName != newCRTB.UserName && oldCRTB.UserName != "":
-		return field.Invalid(fieldPath.Child("userName"), newCRTB.UserName, reason)
-	case oldCRTB.UserPrincipalName != newCRTB.UserPrincipalName && oldCRTB.UserPrincipalName != "":
-		return field.Invalid(fieldPath.Child("userPrincipalName"), newCRTB.UserPrincipalName, reason)
-	case oldCRTB.GroupName != newCRTB.GroupName && oldCRTB.GroupName != "":
-		return field.Invalid(fieldPath.Child("groupName"), newCRTB.GroupName, reason)
-	case oldCRTB.GroupPrincipalName != newCRTB.GroupPrincipalName && oldCRTB.GroupPrincipalName != "":
-		return field.Invalid(fieldPath.Child("groupPrincipalName"), newCRTB.GroupPrincipalName, reason)
-	case (newCRTB.GroupName != "" || oldCRTB.GroupPrincipalName != "") && (newCRTB.UserName != "" || oldCRTB.UserPrincipalName != ""):
+	if (newCRTB.GroupName != "" || oldCRTB.GroupPrincipalName != "") && (newCRTB.UserName != "" || oldCRTB.UserPrincipalName != "") {
 		return field.Forbidden(fieldPath,
 			"binding target must target either a user [userName]/[userPrincipalName] OR a group [groupName]/[groupPrincipalName]")
-	case (newCRTB.Labels[grbOwnerLabel] != oldCRTB.Labels[grbOwnerLabel]):
-		return field.Forbidden(fieldPath.Child("labels"), fmt.Sprintf("label %s is immutable after creation", grbOwnerLabel))
-	default:
-		return nil
 	}
+	return nil
 }
 
 // validateCreateFields checks if all required fields are present and valid.
@@ -19,11 +19,14 @@ import (
 	"go.uber.org/mock/gomock"
 	v1 "k8s.io/api/admission/v1"
 	v1authentication "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8fake "k8s.io/client-go/kubernetes/typed/authorization/v1/fake"
+	k8testing "k8s.io/client-go/testing"
 	"k8s.io/kubernetes/pkg/registry/rbac/validation"
 )
 
@@ -198,7 +201,7 @@ func (c *ClusterRoleTemplateBindingSuite) Test_PrivilegeEscalation() {
 	}, nil).AnyTimes()
 
 	crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, roleResolver)
-	validator := clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, nil, clusterCache)
+	validator := clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, nil, clusterCache, nil, nil)
 	type args struct {
 		oldCRTB  func() *apisv3.ClusterRoleTemplateBinding
 		newCRTB  func() *apisv3.ClusterRoleTemplateBinding
@@ -342,7 +345,7 @@ func (c *ClusterRoleTemplateBindingSuite) Test_UpdateValidation() {
 	}, nil).AnyTimes()
 
 	crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, roleResolver)
-	validator := clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, nil, clusterCache)
+	validator := clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, nil, clusterCache, nil, nil)
 	type args struct {
 		oldCRTB  func() *apisv3.ClusterRoleTemplateBinding
 		newCRTB  func() *apisv3.ClusterRoleTemplateBinding
@@ -639,9 +642,7 @@ func (c *ClusterRoleTemplateBindingSuite) Test_UpdateValidation() {
 		c.Run(test.name, func() {
 			c.T().Parallel()
 			req := createCRTBRequest(c.T(), test.args.oldCRTB(), test.args.newCRTB(), test.args.username)
-			admitters := validator.Admitters()
-			assert.Len(c.T(), admitters, 1)
-			resp, err := admitters[0].Admit(req)
+			resp, err := validate(validator, req)
 			c.NoError(err, "Admit failed")
 			if resp.Allowed != test.allowed {
 				c.Failf("Response was incorrectly validated", "Wanted response.Allowed = '%v' got %v: result=%+v", test.allowed, resp.Allowed, resp.Result)
@@ -740,7 +741,7 @@ func (c *ClusterRoleTemplateBindingSuite) Test_Create() {
 		clusterCache.EXPECT().Get(nilCluster).Return(nil, nil).AnyTimes()
 
 		crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, roleResolver)
-		return clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, grbCache, clusterCache)
+		return clusterroletemplatebinding.NewValidator(crtbResolver, resolver, roleResolver, grbCache, clusterCache, nil, nil)
 	}
 	type args struct {
 		oldCRTB  func() *apisv3.ClusterRoleTemplateBinding
@@ -1134,3 +1135,199 @@ func newDefaultCRTB() *apisv3.ClusterRoleTemplateBinding {
 		RoleTemplateName: "admin-role",
 	}
 }
+
+func (c *ClusterRoleTemplateBindingSuite) Test_Delete() {
+	const (
+		ownerRole    = "cluster-owner"
+		deletingName = "c-deleting"
+	)
+	owner := func(name string) *apisv3.ClusterRoleTemplateBinding {
+		crtb := newDefaultCRTB()
+		crtb.Name = name
+		crtb.RoleTemplateName = ownerRole
+		return crtb
+	}
+	deletingOwner := owner("crtb-deleting")
+	deletingOwner.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	expiredOwner := owner("crtb-expired")
+	expiredOwner.Annotations = map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(-time.Hour).Format(time.RFC3339)}
+	inDeletingCluster := owner("crtb-deleting-cluster")
+	inDeletingCluster.ClusterName = deletingName
+
+	tests := []struct {
+		name    string
+		crtb    *apisv3.ClusterRoleTemplateBinding
+		others  []*apisv3.ClusterRoleTemplateBinding
+		hasVerb bool
+		allowed bool
+		wantSAR bool
+	}{
+		{
+			name:    "delete a binding which is not an owner",
+			crtb:    newDefaultCRTB(),
+			allowed: true,
+		},
+		{
+			name:    "delete an owner when another owner remains",
+			crtb:    owner("crtb-owner"),
+			others:  []*apisv3.ClusterRoleTemplateBinding{owner("crtb-owner"), owner("crtb-other-owner")},
+			allowed: true,
+		},
+		{
+			name:    "delete the last owner",
+			crtb:    owner("crtb-owner"),
+			others:  []*apisv3.ClusterRoleTemplateBinding{owner("crtb-owner"), deletingOwner, expiredOwner, newDefaultCRTB()},
+			wantSAR: true,
+		},
+		{
+			name:    "delete the last owner with the delete-last-owner verb",
+			crtb:    owner("crtb-owner"),
+			others:  []*apisv3.ClusterRoleTemplateBinding{owner("crtb-owner")},
+			hasVerb: true,
+			allowed: true,
+			wantSAR: true,
+		},
+		{
+			name:    "delete an expired owner",
+			crtb:    expiredOwner,
+			allowed: true,
+		},
+		{
+			name:    "delete the last owner of a deleting cluster",
+			crtb:    inDeletingCluster,
+			allowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func() {
+			ctrl := gomock.NewController(c.T())
+			crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+			crtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+			crtbCache.EXPECT().List(defaultClusterID, gomock.Any()).Return(test.others, nil).AnyTimes()
+			clusterCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.Cluster](ctrl)
+			clusterCache.EXPECT().Get(defaultClusterID).Return(&apisv3.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: defaultClusterID},
+			}, nil).AnyTimes()
+			clusterCache.EXPECT().Get(deletingName).Return(&apisv3.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: deletingName, DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+			}, nil).AnyTimes()
+
+			sarCalled := false
+			k8Fake := &k8testing.Fake{}
+			fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+			fakeSAR.Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (bool, runtime.Object, error) {
+				sarCalled = true
+				review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+				c.Equal("delete-last-owner", review.Spec.ResourceAttributes.Verb)
+				c.Equal(test.crtb.Name, review.Spec.ResourceAttributes.Name)
+				review.Status.Allowed = test.hasVerb
+				return true, review, nil
+			})
+
+			crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, nil)
+			validator := clusterroletemplatebinding.NewValidator(crtbResolver, nil, nil, nil, clusterCache, fakeSAR, nil)
+			req := createCRTBRequest(c.T(), test.crtb, test.crtb, "user1")
+			req.Operation = v1.Delete
+			admitters := validator.Admitters()
+			c.Len(admitters, 1)
+			resp, err := admitters[0].Admit(req)
+			c.NoError(err)
+			c.Equal(test.allowed, resp.Allowed, "result=%+v", resp.Result)
+			c.Equal(test.wantSAR, sarCalled)
+		})
+	}
+}
+
+func (c *ClusterRoleTemplateBindingSuite) Test_SeparationOfDutiesOnUpdate() {
+	policy := auth.SeparationOfDutiesPolicy{
+		Conflicts: []auth.DutyConflict{{Name: "owner-auditor", RoleTemplates: []string{"cluster-owner", "auditor"}}},
+	}
+	auth.SetSeparationOfDutiesPolicy(&policy)
+	defer auth.SetSeparationOfDutiesPolicy(nil)
+
+	ownerCRTB := newDefaultCRTB()
+	ownerCRTB.Name = "crtb-owner"
+	ownerCRTB.UserName = "u-owner"
+	ownerCRTB.RoleTemplateName = "cluster-owner"
+	// Rancher sets the userName of bindings created with a userPrincipalName
+	principalCRTB := newDefaultCRTB()
+	principalCRTB.UserName = ""
+	principalCRTB.UserPrincipalName = "openldap_user://uid=owner"
+	principalCRTB.RoleTemplateName = "auditor"
+	resolvedCRTB := principalCRTB.DeepCopy()
+	resolvedCRTB.UserName = "u-owner"
+	relabeledCRTB := resolvedCRTB.DeepCopy()
+	relabeledCRTB.Labels = map[string]string{"updated": "true"}
+
+	tests := []struct {
+		name    string
+		oldCRTB *apisv3.ClusterRoleTemplateBinding
+		newCRTB *apisv3.ClusterRoleTemplateBinding
+		allowed bool
+	}{
+		{
+			name:    "update resolving the subject to a user holding a conflicting role",
+			oldCRTB: principalCRTB,
+			newCRTB: resolvedCRTB,
+		},
+		{
+			name:    "update which does not change the subject",
+			oldCRTB: resolvedCRTB,
+			newCRTB: relabeledCRTB,
+			allowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func() {
+			ctrl := gomock.NewController(c.T())
+			crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+			crtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any()).Times(2)
+			crtbCache.EXPECT().GetByIndex(gomock.Any(), resolvers.GetUserKey("u-owner", defaultClusterID)).Return([]*apisv3.ClusterRoleTemplateBinding{ownerCRTB}, nil).AnyTimes()
+			crtbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+			prtbCache := fake.NewMockCacheInterface[*apisv3.ProjectRoleTemplateBinding](ctrl)
+			prtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+			prtbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+			grbCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.GlobalRoleBinding](ctrl)
+			grbCache.EXPECT().GetByIndex(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+			projectCache := fake.NewMockCacheInterface[*apisv3.Project](ctrl)
+			projectCache.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+			separationOfDuties := resolvers.NewSeparationOfDuties(crtbCache, prtbCache, grbCache, nil, projectCache, nil, nil)
+
+			roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*apisv3.RoleTemplate](ctrl)
+			roleTemplateCache.EXPECT().Get(gomock.Any()).Return(nil, apierrors.NewNotFound(schema.GroupResource{}, "")).AnyTimes()
+			roleResolver := auth.NewRoleTemplateResolver(roleTemplateCache, nil)
+
+			crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, nil)
+			validator := clusterroletemplatebinding.NewValidator(crtbResolver, nil, roleResolver, nil, nil, nil, separationOfDuties)
+			resp, err := validator.Admitters()[0].Admit(createCRTBRequest(c.T(), test.oldCRTB, test.newCRTB, "user1"))
+			c.NoError(err)
+			c.Equal(test.allowed, resp.Allowed, "result=%+v", resp.Result)
+			if !test.allowed && c.NotNil(resp.Result) {
+				c.Contains(resp.Result.Message, `separation of duties conflict "owner-auditor"`)
+			}
+		})
+	}
+}
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*v1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
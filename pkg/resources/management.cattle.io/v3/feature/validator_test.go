@@ -155,6 +155,8 @@ func TestRejectsBadRequest(t *testing.T) {
 		},
 	}
 
-	_, err := admitters[0].Admit(&req)
-	require.Error(t, err)
+	response, err := admitters[0].Admit(&req)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, metav1.StatusReasonBadRequest, response.Result.Reason)
 }
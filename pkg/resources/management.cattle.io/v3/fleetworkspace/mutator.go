@@ -110,7 +110,7 @@ func (m *Mutator) Admit(request *admission.Request) (*admissionv1.AdmissionRespo
 		}
 		err = auth.ConfirmNoEscalation(request, cr.Rules, namespace.Name, m.resolver)
 		if err != nil {
-			return admission.ResponseFailedEscalation(err.Error()), nil
+			return auth.FailedEscalationResponse(err.Error(), err), nil
 		}
 	}
 
@@ -8,6 +8,7 @@ import (
 	management "github.com/rancher/rancher/pkg/apis/management.cattle.io"
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
 	"github.com/rancher/wrangler/v3/pkg/generic/fake"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -78,11 +79,16 @@ func TestAdmit(t *testing.T) {
 			req:           req,
 			expectAllowed: false,
 			expectResultStatus: &metav1.Status{
-				Message: `user "test-user" (groups=[]) is attempting to grant RBAC permissions not currently held:
-{APIGroups:["management.cattle.io"], Resources:["fleetworkspaces"], ResourceNames:["test"], Verbs:["*"]}`,
-				Status: "Failure",
-				Reason: metav1.StatusReasonForbidden,
-				Code:   http.StatusForbidden,
+				Message: `user "test-user" is missing permissions in namespace "test": [*] on fleetworkspaces.management.cattle.io named test`,
+				Status:  "Failure",
+				Reason:  metav1.StatusReasonForbidden,
+				Code:    http.StatusForbidden,
+				Details: &metav1.StatusDetails{
+					Causes: []metav1.StatusCause{{
+						Type:    auth.MissingPermissionCause,
+						Message: `[*] on fleetworkspaces.management.cattle.io named test in namespace "test"`,
+					}},
+				},
 			},
 		},
 		"reject because namespace can't be fetched": {
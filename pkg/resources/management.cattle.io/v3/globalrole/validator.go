@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/admission"
@@ -14,6 +15,8 @@ import (
 	"github.com/rancher/webhook/pkg/resources/common"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -147,7 +150,6 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		return admission.ResponseBadRequest(returnError.Error()), nil
 	}
 
-	// Check for escalations in the rules
 	clusterRules, err := a.grResolver.ClusterRulesFromRole(newGR)
 	if err != nil {
 		return nil, fmt.Errorf("unable to resolve rules for new global role: %w", err)
@@ -155,6 +157,32 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 	fwResourceRules := a.grResolver.FleetWorkspacePermissionsResourceRulesFromRole(newGR)
 	fwWorkspaceVerbsRules := a.grResolver.FleetWorkspacePermissionsWorkspaceVerbsFromRole(newGR)
 
+	// dangerous rules are checked before the escalate verb, which bypasses the escalation checks below.
+	builder := admission.NewResponseBuilder()
+	if request.Operation == admissionv1.Create || rulesChanged(oldGR, newGR) {
+		var dangerousGrants auth.DangerousGrants
+		policy := auth.CurrentDangerousRulesPolicy()
+		// global rules apply to the local cluster, and the rules of inherited cluster roles to every downstream cluster
+		dangerousGrants = append(dangerousGrants, policy.Check(globalRules, true)...)
+		dangerousGrants = append(dangerousGrants, policy.Check(clusterRules, true)...)
+		dangerousGrants = append(dangerousGrants, policy.Check(fwWorkspaceVerbsRules, true)...)
+		dangerousGrants = append(dangerousGrants, policy.Check(fwResourceRules, false)...)
+		for _, rules := range newGR.NamespacedRules {
+			dangerousGrants = append(dangerousGrants, policy.Check(rules, false)...)
+		}
+		if denied := dangerousGrants.Denied(); len(denied) > 0 {
+			return admission.ResponseFailedEscalation(strings.Join(denied.Messages("GlobalRole", newGR.Name), "; ")), nil
+		}
+		builder.AddWarnings(dangerousGrants.Messages("GlobalRole", newGR.Name)...)
+	}
+
+	response, err := a.checkEscalation(request, newGR, globalRules, clusterRules, fwResourceRules, fwWorkspaceVerbsRules)
+	return builder.Respond(response), err
+}
+
+// checkEscalation verifies that the user has the escalate verb, or holds all the rules of the GlobalRole.
+func (a *admitter) checkEscalation(request *admission.Request, newGR *v3.GlobalRole, globalRules, clusterRules, fwResourceRules, fwWorkspaceVerbsRules []rbacv1.PolicyRule) (*admissionv1.AdmissionResponse, error) {
+	var returnError error
 	escalateChecker := common.NewCachedVerbChecker(request, newGR.Name, a.sar, gvr, escalateVerb)
 	returnError = errors.Join(returnError, escalateChecker.IsRulesAllowed(clusterRules, a.grbResolvers.ICRResolver, ""))
 	if escalateChecker.HasVerb() {
@@ -179,12 +207,20 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		}
 	}
 	if returnError != nil {
-		return admission.ResponseFailedEscalation(fmt.Sprintf("errors due to escalation: %v", returnError)), nil
+		return auth.FailedEscalationResponse(fmt.Sprintf("errors due to escalation: %v", returnError), returnError), nil
 	}
 
 	return admission.ResponseAllowed(), nil
 }
 
+// rulesChanged returns true if the rules granted by the GlobalRole, directly or through inherited roles, changed.
+func rulesChanged(oldRole, newRole *v3.GlobalRole) bool {
+	return !equality.Semantic.DeepEqual(oldRole.Rules, newRole.Rules) ||
+		!equality.Semantic.DeepEqual(oldRole.NamespacedRules, newRole.NamespacedRules) ||
+		!equality.Semantic.DeepEqual(oldRole.InheritedClusterRoles, newRole.InheritedClusterRoles) ||
+		!equality.Semantic.DeepEqual(oldRole.InheritedFleetWorkspacePermissions, newRole.InheritedFleetWorkspacePermissions)
+}
+
 // validateDelete checks if a global role can be deleted and returns the appropriate response.
 func validateDelete(oldRole *v3.GlobalRole, fldPath *field.Path) (*admissionv1.AdmissionResponse, error) {
 	if oldRole.Builtin {
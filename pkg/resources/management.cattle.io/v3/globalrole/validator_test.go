@@ -6,6 +6,7 @@ import (
 	"time"
 
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/auth"
 	"github.com/rancher/webhook/pkg/resources/management.cattle.io/v3/globalrole"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1078,6 +1079,87 @@ func TestAdmit(t *testing.T) {
 	}
 }
 
+// TestAdmitDangerousRules is not parallel, since it changes the dangerous rules policy of the package.
+func TestAdmitDangerousRules(t *testing.T) {
+	defer auth.SetDangerousRulesPolicy(nil)
+	readSecrets := v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}
+	denyPolicy := auth.DefaultDangerousRulesPolicy
+	denyPolicy.Action = auth.DangerousRuleDeny
+
+	tests := []struct {
+		name         string
+		policy       *auth.DangerousRulesPolicy
+		newGR        func() *v3.GlobalRole
+		wantAllowed  bool
+		wantWarnings []string
+	}{
+		{
+			name: "all resources with escalate",
+			newGR: func() *v3.GlobalRole {
+				gr := newDefaultGR()
+				gr.Rules = adminCR.Rules
+				return gr
+			},
+			wantAllowed: true,
+			wantWarnings: []string{
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "all-resources"`,
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "escalate-or-bind"`,
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "impersonate"`,
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "cluster-wide-secrets"`,
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "nodes-proxy"`,
+				`GlobalRole gr-new grants [*] on *.*, which matches the dangerous rule "serviceaccount-tokens"`,
+			},
+		},
+		{
+			name: "global secrets",
+			newGR: func() *v3.GlobalRole {
+				gr := newDefaultGR()
+				gr.Rules = []v1.PolicyRule{readSecrets}
+				return gr
+			},
+			wantAllowed:  true,
+			wantWarnings: []string{`GlobalRole gr-new grants [get] on secrets, which matches the dangerous rule "cluster-wide-secrets"`},
+		},
+		{
+			name: "namespaced secrets",
+			newGR: func() *v3.GlobalRole {
+				gr := newDefaultGR()
+				gr.NamespacedRules = map[string][]v1.PolicyRule{"ns-1": {readSecrets}}
+				return gr
+			},
+			wantAllowed: true,
+		},
+		{
+			name:   "denied with escalate",
+			policy: &denyPolicy,
+			newGR: func() *v3.GlobalRole {
+				gr := newDefaultGR()
+				gr.Rules = []v1.PolicyRule{readSecrets}
+				return gr
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth.SetDangerousRulesPolicy(test.policy)
+			state := newDefaultState(t)
+			setSarResponse(true, nil, testUser, newDefaultGR().Name, state.sarMock)
+			grResolver := state.createBaseGRResolver()
+			grbResolvers := state.createBaseGRBResolvers(grResolver)
+			admitters := globalrole.NewValidator(state.resolver, grbResolvers, state.sarMock, grResolver).Admitters()
+
+			req := createGRRequest(t, testCase{args: args{username: testUser, newGR: test.newGR}})
+			response, err := admitters[0].Admit(req)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantAllowed, response.Allowed)
+			assert.Equal(t, test.wantWarnings, response.Warnings)
+			if !test.wantAllowed {
+				assert.Equal(t, `GlobalRole gr-new grants [get] on secrets, which matches the dangerous rule "cluster-wide-secrets"`, response.Result.Message)
+			}
+		})
+	}
+}
+
 func Test_UnexpectedErrors(t *testing.T) {
 	t.Parallel()
 	resolver, _ := validation.NewTestRuleResolver(nil, nil, nil, nil)
@@ -15,6 +15,7 @@ import (
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
@@ -39,13 +40,15 @@ const bindVerb = "bind"
 
 // NewValidator returns a new validator for GlobalRoleBindings.
 func NewValidator(resolver rbacvalidation.AuthorizationRuleResolver, grbResolvers *resolvers.GRBRuleResolvers,
-	sar authorizationv1.SubjectAccessReviewInterface, grResolver *auth.GlobalRoleResolver) *Validator {
+	sar authorizationv1.SubjectAccessReviewInterface, grResolver *auth.GlobalRoleResolver,
+	separationOfDuties *resolvers.SeparationOfDuties) *Validator {
 	return &Validator{
 		admitter: admitter{
-			resolver:     resolver,
-			grbResolvers: grbResolvers,
-			sar:          sar,
-			grResolver:   grResolver,
+			resolver:           resolver,
+			grbResolvers:       grbResolvers,
+			sar:                sar,
+			grResolver:         grResolver,
+			separationOfDuties: separationOfDuties,
 		},
 	}
 }
@@ -55,6 +58,12 @@ type Validator struct {
 	admitter admitter
 }
 
+// ImmutableFields returns the immutability rules of GRBs. Like the other checks, they are skipped when the GRB is
+// being deleted.
+func (v *Validator) ImmutableFields() []admission.ImmutabilityRule {
+	return []admission.ImmutabilityRule{{Fields: []string{"userName", "groupPrincipalName", "globalRoleName"}, SkipDeleting: true}}
+}
+
 // GVR returns the GroupVersionKind for this CRD.
 func (v *Validator) GVR() schema.GroupVersionResource {
 	return gvr
@@ -76,10 +85,11 @@ func (v *Validator) Admitters() []admission.Admitter {
 }
 
 type admitter struct {
-	resolver     rbacvalidation.AuthorizationRuleResolver
-	grbResolvers *resolvers.GRBRuleResolvers
-	grResolver   *auth.GlobalRoleResolver
-	sar          authorizationv1.SubjectAccessReviewInterface
+	resolver           rbacvalidation.AuthorizationRuleResolver
+	grbResolvers       *resolvers.GRBRuleResolvers
+	grResolver         *auth.GlobalRoleResolver
+	sar                authorizationv1.SubjectAccessReviewInterface
+	separationOfDuties *resolvers.SeparationOfDuties
 }
 
 // Admit handles the webhook admission request sent to this webhook.
@@ -110,7 +120,7 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 
 	switch request.Operation {
 	case admissionv1.Update:
-		err = validateUpdateFields(oldGRB, newGRB, fldPath)
+		// the immutable fields are checked by the rules of ImmutableFields
 	case admissionv1.Create:
 		err = a.validateCreate(newGRB, globalRole, fldPath)
 	default:
@@ -124,6 +134,23 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		return nil, err
 	}
 
+	// oldBinding stays nil on create
+	var oldBinding metav1.Object
+	if request.Operation == admissionv1.Update {
+		oldBinding = oldGRB
+	}
+	if response, err := common.ValidateBindingExpiration(request, gvr, a.sar, oldBinding, newGRB, fldPath); response != nil || err != nil {
+		return response, err
+	}
+
+	if request.Operation == admissionv1.Create {
+		subject := resolvers.BindingDutySubject(newGRB.UserName, "", newGRB.GroupPrincipalName)
+		role := auth.DutyRole{Kind: auth.GlobalRoleDutyKind, Name: newGRB.GlobalRoleName}
+		if response, err := common.CheckSeparationOfDuties(a.separationOfDuties, subject, resolvers.DutyScope{}, role, fldPath); response != nil || err != nil {
+			return response, err
+		}
+	}
+
 	fwResourceRules := a.grResolver.FleetWorkspacePermissionsResourceRulesFromRole(globalRole)
 	fwWorkspaceVerbsRules := a.grResolver.FleetWorkspacePermissionsWorkspaceVerbsFromRole(globalRole)
 	globalRules := a.grResolver.GlobalRulesFromRole(globalRole)
@@ -164,28 +191,12 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		}
 	}
 	if returnError != nil {
-		return admission.ResponseFailedEscalation(fmt.Sprintf("errors due to escalation: %v", returnError)), nil
+		return auth.FailedEscalationResponse(fmt.Sprintf("errors due to escalation: %v", returnError), returnError), nil
 	}
 
 	return admission.ResponseAllowed(), nil
 }
 
-// validUpdateFields checks if the fields being changed are valid update fields.
-func validateUpdateFields(oldBinding, newBinding *v3.GlobalRoleBinding, fldPath *field.Path) error {
-	var err error
-	const immutable = "field is immutable"
-	switch {
-	case newBinding.UserName != oldBinding.UserName:
-		err = field.Invalid(fldPath.Child("userName"), newBinding.UserName, immutable)
-	case newBinding.GroupPrincipalName != oldBinding.GroupPrincipalName:
-		err = field.Invalid(fldPath.Child("groupPrincipalName"), newBinding.GroupPrincipalName, immutable)
-	case newBinding.GlobalRoleName != oldBinding.GlobalRoleName:
-		err = field.Invalid(fldPath.Child("globalRoleName"), newBinding.GlobalRoleName, immutable)
-	}
-
-	return err
-}
-
 // validateCreateFields checks if all required fields are present and valid.
 func (a *admitter) validateCreate(newBinding *v3.GlobalRoleBinding, globalRole *v3.GlobalRole, fldPath *field.Path) error {
 	switch {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/webhook/pkg/admission"
 	"github.com/rancher/webhook/pkg/auth"
 	"github.com/rancher/webhook/pkg/resolvers"
 	"github.com/rancher/webhook/pkg/resources/management.cattle.io/v3/globalrolebinding"
@@ -803,6 +804,66 @@ func TestAdmit(t *testing.T) {
 			},
 			allowed: true,
 		},
+		{
+			name: "create with an expiration",
+			args: args{
+				username: restrictedAdminUser,
+				newGRB: func() *v3.GlobalRoleBinding {
+					return &v3.GlobalRoleBinding{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test-grb",
+							Annotations: map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(time.Hour).Format(time.RFC3339)},
+						},
+						UserName:       testUser,
+						GlobalRoleName: fwGR.Name,
+					}
+				},
+				stateSetup: func(ts testState) {
+					ts.grCacheMock.EXPECT().Get(fwGR.Name).Return(&fwGR, nil)
+				},
+			},
+			allowed: true,
+		},
+		{
+			name: "create with an expiration beyond the max TTL",
+			args: args{
+				username: restrictedAdminUser,
+				newGRB: func() *v3.GlobalRoleBinding {
+					return &v3.GlobalRoleBinding{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test-grb",
+							Annotations: map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(auth.DefaultMaxBindingTTL + time.Hour).Format(time.RFC3339)},
+						},
+						UserName:       testUser,
+						GlobalRoleName: fwGR.Name,
+					}
+				},
+				stateSetup: func(ts testState) {
+					ts.grCacheMock.EXPECT().Get(fwGR.Name).Return(&fwGR, nil)
+				},
+			},
+			allowed: false,
+		},
+		{
+			name: "create with an invalid expiration",
+			args: args{
+				username: restrictedAdminUser,
+				newGRB: func() *v3.GlobalRoleBinding {
+					return &v3.GlobalRoleBinding{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test-grb",
+							Annotations: map[string]string{auth.ExpiresAtAnnotation: "next week"},
+						},
+						UserName:       testUser,
+						GlobalRoleName: fwGR.Name,
+					}
+				},
+				stateSetup: func(ts testState) {
+					ts.grCacheMock.EXPECT().Get(fwGR.Name).Return(&fwGR, nil)
+				},
+			},
+			allowed: false,
+		},
 	}
 
 	for _, test := range tests {
@@ -815,12 +876,12 @@ func TestAdmit(t *testing.T) {
 			}
 			grResolver := auth.NewGlobalRoleResolver(auth.NewRoleTemplateResolver(state.rtCacheMock, nil), state.grCacheMock)
 			gbrResolvers := resolvers.NewGRBRuleResolvers(state.grbCacheMock, grResolver)
-			admitters := globalrolebinding.NewValidator(state.resolver, gbrResolvers, state.sarMock, grResolver).Admitters()
-			require.Len(t, admitters, 1)
+			validator := globalrolebinding.NewValidator(state.resolver, gbrResolvers, state.sarMock, grResolver, nil)
+			require.Len(t, validator.Admitters(), 1)
 
 			req := createGRBRequest(t, test)
 
-			response, err := admitters[0].Admit(req)
+			response, err := validate(validator, req)
 			if test.wantError {
 				assert.Error(t, err)
 				return
@@ -836,7 +897,7 @@ func Test_UnexpectedErrors(t *testing.T) {
 	state := newDefaultState(t)
 	grResolver := auth.NewGlobalRoleResolver(auth.NewRoleTemplateResolver(state.rtCacheMock, nil), state.grCacheMock)
 	gbrResolvers := resolvers.NewGRBRuleResolvers(state.grbCacheMock, grResolver)
-	validator := globalrolebinding.NewValidator(state.resolver, gbrResolvers, state.sarMock, grResolver)
+	validator := globalrolebinding.NewValidator(state.resolver, gbrResolvers, state.sarMock, grResolver, nil)
 	admitters := validator.Admitters()
 	require.Len(t, admitters, 1, "wanted only one admitter")
 	admitter := admitters[0]
@@ -874,3 +935,22 @@ func setSarResponse(allowed bool, testErr error, targetUser string, targetGrName
 		return false, nil, nil
 	})
 }
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*v1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
@@ -4,6 +4,7 @@ package podsecurityadmissionconfigurationtemplate
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,8 +14,10 @@ import (
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	v1 "github.com/rancher/webhook/pkg/generated/controllers/provisioning.cattle.io/v1"
 	objectsv3 "github.com/rancher/webhook/pkg/generated/objects/management.cattle.io/v3"
+	corecontroller "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	machinery "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -41,11 +44,13 @@ const (
 	rancherRestrictedPSACTName              = "rancher-restricted"
 )
 
-// NewValidator returns a validator for PodSecurityAdmissionConfigurationTemplates.
-func NewValidator(managementCache v3.ClusterCache, provisioningCache v1.ClusterCache) *Validator {
+// NewValidator returns a validator for PodSecurityAdmissionConfigurationTemplates. The namespace cache is used to warn
+// about exempted namespaces which do not exist, and can be nil.
+func NewValidator(managementCache v3.ClusterCache, provisioningCache v1.ClusterCache, namespaceCache corecontroller.NamespaceCache) *Validator {
 	adm := admitter{
 		ManagementClusterCache:   managementCache,
 		provisioningClusterCache: provisioningCache,
+		namespaceCache:           namespaceCache,
 	}
 	adm.ManagementClusterCache.AddIndexer(byPodSecurityAdmissionConfigurationName, byPodSecurityAdmissionConfigurationTemplateV3)
 	adm.provisioningClusterCache.AddIndexer(byPodSecurityAdmissionConfigurationName, byPodSecurityAdmissionConfigurationTemplateV1)
@@ -94,6 +99,7 @@ func (v *Validator) Admitters() []admission.Admitter {
 type admitter struct {
 	ManagementClusterCache   v3.ClusterCache
 	provisioningClusterCache v1.ClusterCache
+	namespaceCache           corecontroller.NamespaceCache
 }
 
 // Admit handles the webhook admission request sent to this webhook.
@@ -102,6 +108,7 @@ func (a *admitter) Admit(req *admission.Request) (*admissionv1.AdmissionResponse
 	defer listTrace.LogIfLong(2 * time.Second)
 
 	resp := &admissionv1.AdmissionResponse{}
+	builder := admission.NewResponseBuilder()
 	oldTemplate, newTemplate, err := objectsv3.PodSecurityAdmissionConfigurationTemplateOldAndNewFromRequest(&req.AdmissionRequest)
 	if err != nil {
 		return resp, fmt.Errorf("failed to parse PodSecurityAdmissionConfigurationTemplate object from request:%w", err)
@@ -121,6 +128,9 @@ func (a *admitter) Admit(req *admission.Request) (*admissionv1.AdmissionResponse
 			break
 		}
 		resp.Allowed = true
+		if err := a.warnUnknownNamespaces(req, oldTemplate, newTemplate, builder); err != nil {
+			return resp, err
+		}
 	case admissionv1.Delete:
 		// do not allow the default 'restricted' and 'privileged' templates from being deleted
 		if oldTemplate.Name == rancherPrivilegedPSACTName || oldTemplate.Name == rancherRestrictedPSACTName {
@@ -168,7 +178,31 @@ func (a *admitter) Admit(req *admission.Request) (*admissionv1.AdmissionResponse
 		resp.Allowed = true
 	}
 
-	return resp, nil
+	return builder.Respond(resp), nil
+}
+
+// warnUnknownNamespaces warns about the exempted namespaces which do not exist in the local cluster, as they may be
+// misspelled. They are only reported when the exempted namespaces change, since the template also applies to
+// downstream clusters, where they may exist.
+func (a *admitter) warnUnknownNamespaces(req *admission.Request, oldTemplate, newTemplate *mgmtv3.PodSecurityAdmissionConfigurationTemplate,
+	builder *admission.ResponseBuilder) error {
+	namespaces := newTemplate.Configuration.Exemptions.Namespaces
+	if a.namespaceCache == nil || (req.Operation == admissionv1.Update && slices.Equal(oldTemplate.Configuration.Exemptions.Namespaces, namespaces)) {
+		return nil
+	}
+	var unknown []string
+	for _, namespace := range namespaces {
+		_, err := a.namespaceCache.Get(namespace)
+		if apierrors.IsNotFound(err) {
+			unknown = append(unknown, namespace)
+		} else if err != nil {
+			return fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+		}
+	}
+	if len(unknown) > 0 {
+		builder.Warn("exempted namespaces %v do not exist in the local cluster, make sure they are not misspelled", unknown)
+	}
+	return nil
 }
 
 func (a *admitter) handleDeletion(oldTemplate *mgmtv3.PodSecurityAdmissionConfigurationTemplate) (clustersUsingTemplate int, clusterType string, err error) {
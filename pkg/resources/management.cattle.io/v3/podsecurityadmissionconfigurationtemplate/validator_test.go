@@ -9,9 +9,14 @@ import (
 	provv1 "github.com/rancher/rancher/pkg/apis/provisioning.cattle.io/v1"
 	"github.com/rancher/webhook/pkg/admission"
 	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/pod-security-admission/api"
 )
 
@@ -632,3 +637,62 @@ func createRequest(obj *v3.PodSecurityAdmissionConfigurationTemplate, operation
 	req.OldObject.Raw = j
 	return req, nil
 }
+
+func TestAdmitUnknownNamespaces(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	namespaceCache := fake.NewMockNonNamespacedCacheInterface[*corev1.Namespace](ctrl)
+	namespaceCache.EXPECT().Get("cattle-system").Return(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cattle-system"}}, nil).AnyTimes()
+	namespaceCache.EXPECT().Get(gomock.Any()).Return(nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "")).AnyTimes()
+	validator := Validator{admitter: admitter{namespaceCache: namespaceCache}}
+	template := func(namespaces ...string) *v3.PodSecurityAdmissionConfigurationTemplate {
+		return &v3.PodSecurityAdmissionConfigurationTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "template"},
+			Configuration: v3.PodSecurityAdmissionConfigurationTemplateSpec{
+				Exemptions: v3.PodSecurityAdmissionConfigurationTemplateExemptions{Namespaces: namespaces},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		oldTemplate  *v3.PodSecurityAdmissionConfigurationTemplate
+		newTemplate  *v3.PodSecurityAdmissionConfigurationTemplate
+		wantWarnings []string
+	}{
+		{
+			name:        "existing namespaces",
+			newTemplate: template("cattle-system"),
+		},
+		{
+			name:         "unknown namespaces on create",
+			newTemplate:  template("cattle-system", "catle-fleet-system", "ingress"),
+			wantWarnings: []string{"exempted namespaces [catle-fleet-system ingress] do not exist in the local cluster, make sure they are not misspelled"},
+		},
+		{
+			name:         "unknown namespaces added on update",
+			oldTemplate:  template("cattle-system"),
+			newTemplate:  template("cattle-system", "ingress"),
+			wantWarnings: []string{"exempted namespaces [ingress] do not exist in the local cluster, make sure they are not misspelled"},
+		},
+		{
+			name:        "unchanged namespaces on update",
+			oldTemplate: template("ingress"),
+			newTemplate: template("ingress"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := createRequest(test.newTemplate, admissionv1.Create)
+			require.NoError(t, err)
+			if test.oldTemplate != nil {
+				req.Operation = admissionv1.Update
+				req.OldObject.Raw, err = json.Marshal(test.oldTemplate)
+				require.NoError(t, err)
+			}
+			resp, err := validator.Admitters()[0].Admit(&req)
+			require.NoError(t, err)
+			assert.True(t, resp.Allowed)
+			assert.Equal(t, test.wantWarnings, resp.Warnings)
+		})
+	}
+}
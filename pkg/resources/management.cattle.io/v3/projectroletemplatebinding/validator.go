@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/admission"
@@ -12,11 +13,15 @@ import (
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	objectsv3 "github.com/rancher/webhook/pkg/generated/objects/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/resolvers"
+	"github.com/rancher/webhook/pkg/resources/common"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
 	k8validation "k8s.io/kubernetes/pkg/registry/rbac/validation"
 	"k8s.io/utils/trace"
 )
@@ -27,19 +32,30 @@ var gvr = schema.GroupVersionResource{
 	Resource: "projectroletemplatebindings",
 }
 
+const (
+	// projectOwnerRole is the role template making its subjects owners of the project.
+	projectOwnerRole = "project-owner"
+	// deleteLastOwnerVerb allows deleting the last project-owner binding of a project.
+	deleteLastOwnerVerb = "delete-last-owner"
+)
+
 // NewValidator returns a new validator used for validation PRTB.
 func NewValidator(prtb *resolvers.PRTBRuleResolver, crtb *resolvers.CRTBRuleResolver,
 	defaultResolver k8validation.AuthorizationRuleResolver, roleTemplateResolver *auth.RoleTemplateResolver,
-	clusterCache v3.ClusterCache, projectCache v3.ProjectCache) *Validator {
+	clusterCache v3.ClusterCache, projectCache v3.ProjectCache, sar authorizationv1.SubjectAccessReviewInterface,
+	separationOfDuties *resolvers.SeparationOfDuties) *Validator {
 	clusterResolver := resolvers.NewAggregateRuleResolver(defaultResolver, crtb)
 	projectResolver := resolvers.NewAggregateRuleResolver(defaultResolver, prtb)
 	return &Validator{
 		admitter: admitter{
+			prtbCache:            prtb.ProjectRoleTemplateBindings,
 			clusterResolver:      clusterResolver,
 			projectResolver:      projectResolver,
 			roleTemplateResolver: roleTemplateResolver,
 			clusterCache:         clusterCache,
 			projectCache:         projectCache,
+			sar:                  sar,
+			separationOfDuties:   separationOfDuties,
 		},
 	}
 }
@@ -49,6 +65,15 @@ type Validator struct {
 	admitter admitter
 }
 
+// ImmutableFields returns the immutability rules of PRTBs. The subject of the binding can only be completed, e.g. by
+// setting the userName of a binding created with a userPrincipalName.
+func (v *Validator) ImmutableFields() []admission.ImmutabilityRule {
+	return []admission.ImmutabilityRule{
+		{Fields: []string{"roleTemplateName", "projectName", "serviceAccount"}},
+		{Fields: []string{"userName", "userPrincipalName", "groupName", "groupPrincipalName"}, AllowSet: true},
+	}
+}
+
 // GVR returns the GroupVersionKind for this CRD.
 func (v *Validator) GVR() schema.GroupVersionResource {
 	return gvr
@@ -56,7 +81,7 @@ func (v *Validator) GVR() schema.GroupVersionResource {
 
 // Operations returns list of operations handled by this validator.
 func (v *Validator) Operations() []admissionregistrationv1.OperationType {
-	return []admissionregistrationv1.OperationType{admissionregistrationv1.Update, admissionregistrationv1.Create}
+	return []admissionregistrationv1.OperationType{admissionregistrationv1.Update, admissionregistrationv1.Create, admissionregistrationv1.Delete}
 }
 
 // ValidatingWebhook returns the ValidatingWebhook used for this CRD.
@@ -70,11 +95,14 @@ func (v *Validator) Admitters() []admission.Admitter {
 }
 
 type admitter struct {
+	prtbCache            v3.ProjectRoleTemplateBindingCache
 	clusterResolver      k8validation.AuthorizationRuleResolver
 	projectResolver      k8validation.AuthorizationRuleResolver
 	roleTemplateResolver *auth.RoleTemplateResolver
 	clusterCache         v3.ClusterCache
 	projectCache         v3.ProjectCache
+	sar                  authorizationv1.SubjectAccessReviewInterface
+	separationOfDuties   *resolvers.SeparationOfDuties
 }
 
 // Admit is the entrypoint for the validator. Admit will return an error if it's unable to process the request.
@@ -85,11 +113,22 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 
 	fieldPath := field.NewPath("projectroletemplatebinding")
 
+	if request.Operation == admissionv1.Delete {
+		return a.validateDelete(request, fieldPath)
+	}
+
+	// oldBinding stays nil on create
+	var oldBinding metav1.Object
+	checkDuties := request.Operation == admissionv1.Create
 	if request.Operation == admissionv1.Update {
 		oldPRTB, newPRTB, err := objectsv3.ProjectRoleTemplateBindingOldAndNewFromRequest(&request.AdmissionRequest)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode old and new PRTB objects from request: %w", err)
 		}
+		oldBinding = oldPRTB
+		// Rancher sets the userName of bindings created with a userPrincipalName later on, which can resolve their
+		// subject to a user holding conflicting roles
+		checkDuties = dutySubject(oldPRTB) != dutySubject(newPRTB)
 		if err := validateUpdateFields(oldPRTB, newPRTB, fieldPath); err != nil {
 			return admission.ResponseBadRequest(err.Error()), nil
 		}
@@ -110,6 +149,19 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		}
 	}
 
+	if checkDuties {
+		clusterName, projectName := clusterAndProjectID(prtb.ProjectName)
+		scope := resolvers.DutyScope{ClusterName: clusterName, ProjectName: projectName}
+		role := auth.DutyRole{Kind: auth.RoleTemplateDutyKind, Name: prtb.RoleTemplateName}
+		if response, err := common.CheckSeparationOfDuties(a.separationOfDuties, dutySubject(prtb), scope, role, fieldPath); response != nil || err != nil {
+			return response, err
+		}
+	}
+
+	if response, err := common.ValidateBindingExpiration(request, gvr, a.sar, oldBinding, prtb, fieldPath); response != nil || err != nil {
+		return response, err
+	}
+
 	roleTemplate, err := a.roleTemplateResolver.RoleTemplateCache().Get(prtb.RoleTemplateName)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -145,30 +197,67 @@ func clusterAndProjectID(projectName string) (string, string) {
 	return pieces[0], pieces[1]
 }
 
-// validUpdateFields checks if the fields being changed are valid update fields.
+// validateDelete denies deleting the last project-owner binding of a project, which would leave the project without
+// owners, unless the project is being deleted or the user has the delete-last-owner verb on the binding.
+func (a *admitter) validateDelete(request *admission.Request, fieldPath *field.Path) (*admissionv1.AdmissionResponse, error) {
+	prtb, err := objectsv3.ProjectRoleTemplateBindingFromRequest(&request.AdmissionRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PRTB object from request: %w", err)
+	}
+	now := time.Now()
+	// bindings which are already deleting or expired do not make anyone an owner
+	if prtb.RoleTemplateName != projectOwnerRole || prtb.DeletionTimestamp != nil || auth.BindingExpired(prtb, now) {
+		return admission.ResponseAllowed(), nil
+	}
+
+	clusterName, projectName := clusterAndProjectID(prtb.ProjectName)
+	project, err := a.projectCache.Get(clusterName, projectName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.ResponseAllowed(), nil
+		}
+		return nil, fmt.Errorf("failed to get project %s: %w", prtb.ProjectName, err)
+	}
+	if project.DeletionTimestamp != nil {
+		return admission.ResponseAllowed(), nil
+	}
+
+	prtbs, err := a.prtbCache.List(prtb.Namespace, labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PRTBs in namespace %s: %w", prtb.Namespace, err)
+	}
+	for _, other := range prtbs {
+		if other.Name != prtb.Name && other.ProjectName == prtb.ProjectName && other.RoleTemplateName == projectOwnerRole &&
+			other.DeletionTimestamp == nil && !auth.BindingExpired(other, now) {
+			return admission.ResponseAllowed(), nil
+		}
+	}
+
+	allowed, err := auth.RequestUserHasVerb(request, gvr, a.sar, deleteLastOwnerVerb, prtb.Name, prtb.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if user can delete the last owner of project %s: %w", prtb.ProjectName, err)
+	}
+	if allowed {
+		return admission.ResponseAllowed(), nil
+	}
+	fieldErr := field.Forbidden(fieldPath, fmt.Sprintf("binding %s is the last %s binding of project %s, deleting it requires the %s verb",
+		prtb.Name, projectOwnerRole, prtb.ProjectName, deleteLastOwnerVerb))
+	return admission.ResponseBadRequest(fieldErr.Error()), nil
+}
+
+// dutySubject returns the subject of the PRTB checked against the separation of duties policy.
+func dutySubject(prtb *apisv3.ProjectRoleTemplateBinding) resolvers.DutySubject {
+	return resolvers.BindingDutySubject(prtb.UserName, prtb.UserPrincipalName, prtb.GroupPrincipalName, prtb.GroupName)
+}
+
+// validateUpdateFields checks that the binding still targets either a user or a group. The immutable fields are
+// checked by the rules of ImmutableFields.
 func validateUpdateFields(oldPRTB, newPRTB *apisv3.ProjectRoleTemplateBinding, fieldPath *field.Path) *field.Error {
-	const reason = "field is immutable"
-	switch {
-	case oldPRTB.RoleTemplateName != newPRTB.RoleTemplateName:
-		return field.Invalid(fieldPath.Child("roleTemplateName"), newPRTB.RoleTemplateName, reason)
-	case oldPRTB.ProjectName != newPRTB.ProjectName:
-		return field.Invalid(fieldPath.Child("projectName"), newPRTB.ProjectName, reason)
-	case oldPRTB.UserName != newPRTB.UserName && oldPRTB.UserName != "":
-		return field.Invalid(fieldPath.Child("userName"), newPRTB.UserName, reason)
-	case oldPRTB.UserPrincipalName != newPRTB.UserPrincipalName && oldPRTB.UserPrincipalName != "":
-		return field.Invalid(fieldPath.Child("userPrincipalName"), newPRTB.UserPrincipalName, reason)
-	case oldPRTB.GroupName != newPRTB.GroupName && oldPRTB.GroupName != "":
-		return field.Invalid(fieldPath.Child("groupName"), newPRTB.GroupName, reason)
-	case oldPRTB.GroupPrincipalName != newPRTB.GroupPrincipalName && oldPRTB.GroupPrincipalName != "":
-		return field.Invalid(fieldPath.Child("groupPrincipalName"), newPRTB.GroupPrincipalName, reason)
-	case (newPRTB.GroupName != "" || oldPRTB.GroupPrincipalName != "") && (newPRTB.UserName != "" || oldPRTB.UserPrincipalName != ""):
+	if (newPRTB.GroupName != "" || oldPRTB.GroupPrincipalName != "") && (newPRTB.UserName != "" || oldPRTB.UserPrincipalName != "") {
 		return field.Forbidden(fieldPath,
 			"binding must target either a user [userName]/[userPrincipalName] OR a group [groupName]/[groupPrincipalName]")
-	case oldPRTB.ServiceAccount != newPRTB.ServiceAccount:
-		return field.Forbidden(fieldPath.Child("serviceAccount"), "update is not allowed")
-	default:
-		return nil
 	}
+	return nil
 }
 
 // validateCreateFields checks if all required fields are present and valid.
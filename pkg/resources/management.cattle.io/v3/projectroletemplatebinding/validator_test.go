@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	apisv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 	"github.com/rancher/webhook/pkg/admission"
@@ -18,11 +19,14 @@ import (
 	"go.uber.org/mock/gomock"
 	v1 "k8s.io/api/admission/v1"
 	v1authentication "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8fake "k8s.io/client-go/kubernetes/typed/authorization/v1/fake"
+	k8testing "k8s.io/client-go/testing"
 	"k8s.io/kubernetes/pkg/registry/rbac/validation"
 )
 
@@ -220,7 +224,7 @@ func (p *ProjectRoleTemplateBindingSuite) TestPrivilegeEscalation() {
 			ClusterName: clusterID,
 		},
 	}, nil).AnyTimes()
-	validator := projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache)
+	validator := projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache, nil, nil)
 	type args struct {
 		oldPRTB  func() *apisv3.ProjectRoleTemplateBinding
 		newPRTB  func() *apisv3.ProjectRoleTemplateBinding
@@ -395,7 +399,7 @@ func (p *ProjectRoleTemplateBindingSuite) TestValidationOnUpdate() {
 		},
 	}, nil).AnyTimes()
 
-	validator := projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache)
+	validator := projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache, nil, nil)
 	type args struct {
 		oldPRTB  func() *apisv3.ProjectRoleTemplateBinding
 		newPRTB  func() *apisv3.ProjectRoleTemplateBinding
@@ -705,9 +709,7 @@ func (p *ProjectRoleTemplateBindingSuite) TestValidationOnUpdate() {
 		p.Run(test.name, func() {
 			p.T().Parallel()
 			req := createPRTBRequest(p.T(), test.args.oldPRTB(), test.args.newPRTB(), test.args.username)
-			admitters := validator.Admitters()
-			p.Len(admitters, 1)
-			resp, err := admitters[0].Admit(req)
+			resp, err := validate(validator, req)
 			p.NoError(err, "Admit failed")
 			if resp.Allowed != test.allowed {
 				p.Failf("Response was incorrectly validated", "Wanted response.Allowed = '%v' got %v: result=%+v", test.allowed, resp.Allowed, resp.Result)
@@ -814,7 +816,7 @@ func (p *ProjectRoleTemplateBindingSuite) TestValidationOnCreate() {
 			},
 		}, nil).AnyTimes()
 
-		return projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache)
+		return projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, resolver, roleResolver, clusterCache, projectCache, nil, nil)
 	}
 
 	type args struct {
@@ -1287,3 +1289,130 @@ func newBasePRTB() *apisv3.ProjectRoleTemplateBinding {
 		ProjectName:      fmt.Sprintf("%s:%s", clusterID, projectID),
 	}
 }
+
+func (p *ProjectRoleTemplateBindingSuite) TestValidationOnDelete() {
+	const (
+		ownerRole       = "project-owner"
+		deletingProject = "p-deleting"
+	)
+	owner := func(name string) *apisv3.ProjectRoleTemplateBinding {
+		prtb := newBasePRTB()
+		prtb.Name = name
+		prtb.RoleTemplateName = ownerRole
+		return prtb
+	}
+	deletingOwner := owner("prtb-deleting")
+	deletingOwner.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	expiredOwner := owner("prtb-expired")
+	expiredOwner.Annotations = map[string]string{auth.ExpiresAtAnnotation: time.Now().Add(-time.Hour).Format(time.RFC3339)}
+	inDeletingProject := owner("prtb-deleting-project")
+	inDeletingProject.Namespace = deletingProject
+	inDeletingProject.ProjectName = fmt.Sprintf("%s:%s", clusterID, deletingProject)
+
+	tests := []struct {
+		name    string
+		prtb    *apisv3.ProjectRoleTemplateBinding
+		others  []*apisv3.ProjectRoleTemplateBinding
+		hasVerb bool
+		allowed bool
+		wantSAR bool
+	}{
+		{
+			name:    "delete a binding which is not an owner",
+			prtb:    newBasePRTB(),
+			allowed: true,
+		},
+		{
+			name:    "delete an owner when another owner remains",
+			prtb:    owner("prtb-owner"),
+			others:  []*apisv3.ProjectRoleTemplateBinding{owner("prtb-owner"), owner("prtb-other-owner")},
+			allowed: true,
+		},
+		{
+			name:    "delete the last owner",
+			prtb:    owner("prtb-owner"),
+			others:  []*apisv3.ProjectRoleTemplateBinding{owner("prtb-owner"), deletingOwner, expiredOwner, newBasePRTB()},
+			wantSAR: true,
+		},
+		{
+			name:    "delete the last owner with the delete-last-owner verb",
+			prtb:    owner("prtb-owner"),
+			others:  []*apisv3.ProjectRoleTemplateBinding{owner("prtb-owner")},
+			hasVerb: true,
+			allowed: true,
+			wantSAR: true,
+		},
+		{
+			name:    "delete an expired owner",
+			prtb:    expiredOwner,
+			allowed: true,
+		},
+		{
+			name:    "delete the last owner of a deleting project",
+			prtb:    inDeletingProject,
+			allowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		p.Run(test.name, func() {
+			ctrl := gomock.NewController(p.T())
+			prtbCache := fake.NewMockCacheInterface[*apisv3.ProjectRoleTemplateBinding](ctrl)
+			prtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+			prtbCache.EXPECT().List(projectID, gomock.Any()).Return(test.others, nil).AnyTimes()
+			crtbCache := fake.NewMockCacheInterface[*apisv3.ClusterRoleTemplateBinding](ctrl)
+			crtbCache.EXPECT().AddIndexer(gomock.Any(), gomock.Any())
+			projectCache := fake.NewMockCacheInterface[*apisv3.Project](ctrl)
+			projectCache.EXPECT().Get(clusterID, projectID).Return(&apisv3.Project{
+				ObjectMeta: metav1.ObjectMeta{Namespace: clusterID, Name: projectID},
+			}, nil).AnyTimes()
+			projectCache.EXPECT().Get(clusterID, deletingProject).Return(&apisv3.Project{
+				ObjectMeta: metav1.ObjectMeta{Namespace: clusterID, Name: deletingProject, DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+			}, nil).AnyTimes()
+
+			sarCalled := false
+			k8Fake := &k8testing.Fake{}
+			fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+			fakeSAR.Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (bool, runtime.Object, error) {
+				sarCalled = true
+				review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+				p.Equal("delete-last-owner", review.Spec.ResourceAttributes.Verb)
+				p.Equal(test.prtb.Name, review.Spec.ResourceAttributes.Name)
+				review.Status.Allowed = test.hasVerb
+				return true, review, nil
+			})
+
+			prtbResolver := resolvers.NewPRTBRuleResolver(prtbCache, nil)
+			crtbResolver := resolvers.NewCRTBRuleResolver(crtbCache, nil)
+			validator := projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, nil, nil, nil, projectCache, fakeSAR, nil)
+			req := createPRTBRequest(p.T(), test.prtb, test.prtb, "user1")
+			req.Operation = v1.Delete
+			admitters := validator.Admitters()
+			p.Len(admitters, 1)
+			resp, err := admitters[0].Admit(req)
+			p.NoError(err)
+			p.Equal(test.allowed, resp.Allowed, "result=%+v", resp.Result)
+			p.Equal(test.wantSAR, sarCalled)
+		})
+	}
+}
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*v1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
@@ -0,0 +1,210 @@
+package roletemplate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Limits bound the inheritance graph of RoleTemplates, since every escalation check involving a RoleTemplate flattens
+// the templates it inherits. A limit of 0 disables the check.
+type Limits struct {
+	// MaxInheritanceDepth is the maximum length of the chains of RoleTemplates inherited by a RoleTemplate.
+	MaxInheritanceDepth int `json:"maxInheritanceDepth"`
+	// MaxInheritedTemplates is the maximum number of RoleTemplates inherited by a RoleTemplate, directly or not.
+	MaxInheritedTemplates int `json:"maxInheritedTemplates"`
+	// MaxRules is the maximum number of rules of a RoleTemplate once the rules of the templates it inherits are added.
+	MaxRules int `json:"maxRules"`
+}
+
+// DefaultLimits are the limits used unless others are set with SetLimits.
+var DefaultLimits = Limits{
+	MaxInheritanceDepth:   8,
+	MaxInheritedTemplates: 100,
+	MaxRules:              2000,
+}
+
+var (
+	limits      = DefaultLimits
+	limitsMutex sync.RWMutex
+)
+
+// Validate returns an error if a limit is negative.
+func (l Limits) Validate() error {
+	if l.MaxInheritanceDepth < 0 || l.MaxInheritedTemplates < 0 || l.MaxRules < 0 {
+		return fmt.Errorf("RoleTemplate limits must not be negative")
+	}
+	return nil
+}
+
+// SetLimits replaces the limits enforced on RoleTemplates. A nil value restores DefaultLimits.
+func SetLimits(newLimits *Limits) {
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+	if newLimits == nil {
+		limits = DefaultLimits
+		return
+	}
+	limits = *newLimits
+}
+
+func currentLimits() Limits {
+	limitsMutex.RLock()
+	defer limitsMutex.RUnlock()
+	return limits
+}
+
+// inheritanceGraph walks the RoleTemplates inherited by a RoleTemplate.
+type inheritanceGraph struct {
+	getTemplate func(name string) (*v3.RoleTemplate, error)
+	// chains memoizes the longest chain of inherited templates starting at each visited template.
+	chains map[string][]string
+	// templates holds the visited templates.
+	templates map[string]*v3.RoleTemplate
+	// visiting holds the templates of the chain being walked, to skip reference cycles.
+	visiting sets.Set[string]
+}
+
+// checkInheritanceLimits returns a message describing the first inheritance limit exceeded by the template or, when
+// checkInheriting is set, by the RoleTemplates inheriting it once it is changed. It returns an empty string if there is
+// none. The rules limit of the template itself is left to the caller, which flattens its rules anyway.
+func (a *admitter) checkInheritanceLimits(template *v3.RoleTemplate, checkInheriting bool, limits Limits) (string, error) {
+	if limits.MaxInheritanceDepth == 0 && limits.MaxInheritedTemplates == 0 && (!checkInheriting || limits.MaxRules == 0) {
+		return "", nil
+	}
+	// the templates inheriting the changed template are evaluated with its new version
+	getTemplate := func(name string) (*v3.RoleTemplate, error) {
+		if name == template.Name {
+			return template, nil
+		}
+		return a.roleTemplateResolver.RoleTemplateCache().Get(name)
+	}
+	limitsWithoutRules := limits
+	limitsWithoutRules.MaxRules = 0
+	msg, err := a.checkTemplateLimits(template, "RoleTemplate "+template.Name, getTemplate, limitsWithoutRules)
+	if err != nil || msg != "" || !checkInheriting {
+		return msg, err
+	}
+
+	chains, err := a.inheritingChains(template.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, chain := range chains {
+		inheriting, err := getTemplate(chain[0])
+		if err != nil {
+			return "", fmt.Errorf("unable to get roletemplate %s with error %w", chain[0], err)
+		}
+		subject := fmt.Sprintf("RoleTemplate %s, which inherits RoleTemplate %s through %s,", inheriting.Name, template.Name, strings.Join(chain, " -> "))
+		msg, err := a.checkTemplateLimits(inheriting, subject, getTemplate, limits)
+		if err != nil || msg != "" {
+			return msg, err
+		}
+	}
+	return "", nil
+}
+
+// checkTemplateLimits returns a message describing the first limit exceeded by the template, designated by subject in
+// the message, or an empty string if there is none.
+func (a *admitter) checkTemplateLimits(template *v3.RoleTemplate, subject string, getTemplate func(name string) (*v3.RoleTemplate, error), limits Limits) (string, error) {
+	graph := &inheritanceGraph{
+		getTemplate: getTemplate,
+		chains:      map[string][]string{},
+		templates:   map[string]*v3.RoleTemplate{},
+		visiting:    sets.New[string](),
+	}
+	chain, err := graph.longestChain(template)
+	if err != nil {
+		return "", err
+	}
+	// the chain starts with the template itself
+	if depth := len(chain) - 1; limits.MaxInheritanceDepth > 0 && depth > limits.MaxInheritanceDepth {
+		return fmt.Sprintf("%s inherits RoleTemplates %d levels deep, which exceeds the limit of %d: %s",
+			subject, depth, limits.MaxInheritanceDepth, strings.Join(chain, " -> ")), nil
+	}
+	inherited := len(graph.chains) - 1
+	if limits.MaxInheritedTemplates > 0 && inherited > limits.MaxInheritedTemplates {
+		return fmt.Sprintf("%s inherits %d RoleTemplates, which exceeds the limit of %d",
+			subject, inherited, limits.MaxInheritedTemplates), nil
+	}
+	if limits.MaxRules == 0 {
+		return "", nil
+	}
+	// flattening the rules keeps one copy of the rules of each template, however many times it is inherited
+	var rules int
+	for _, visited := range graph.templates {
+		templateRules, err := a.roleTemplateResolver.TemplateRules(visited)
+		if err != nil {
+			return "", err
+		}
+		rules += len(templateRules)
+	}
+	if rules > limits.MaxRules {
+		return fmt.Sprintf("%s has %d rules including the rules of the RoleTemplates it inherits, which exceeds the limit of %d",
+			subject, rules, limits.MaxRules), nil
+	}
+	return "", nil
+}
+
+// inheritingChains returns the chains of RoleTemplates inheriting the named template, directly or not, e.g. [a b name]
+// if a inherits b which inherits name. Each inheriting template is listed once, with the shortest chain.
+func (a *admitter) inheritingChains(name string) ([][]string, error) {
+	var chains [][]string
+	seen := sets.New(name)
+	pending := [][]string{{name}}
+	for len(pending) > 0 {
+		chain := pending[0]
+		pending = pending[1:]
+		inheriting, err := a.roleTemplateResolver.RoleTemplateCache().GetByIndex(rtRefIndex, chain[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to list RoleTemplates that reference '%s': %w", chain[0], err)
+		}
+		for _, rt := range inheriting {
+			if seen.Has(rt.Name) {
+				continue
+			}
+			seen.Insert(rt.Name)
+			inheritingChain := append([]string{rt.Name}, chain...)
+			chains = append(chains, inheritingChain)
+			pending = append(pending, inheritingChain)
+		}
+	}
+	return chains, nil
+}
+
+// longestChain returns the longest chain of inherited templates starting at the template, e.g. [a b c] if a inherits b
+// which inherits c.
+func (g *inheritanceGraph) longestChain(template *v3.RoleTemplate) ([]string, error) {
+	if chain, ok := g.chains[template.Name]; ok {
+		return chain, nil
+	}
+	g.visiting.Insert(template.Name)
+	defer g.visiting.Delete(template.Name)
+	g.templates[template.Name] = template
+
+	var longest []string
+	for _, name := range template.RoleTemplateNames {
+		if g.visiting.Has(name) {
+			continue
+		}
+		chain, ok := g.chains[name]
+		if !ok {
+			inherited, err := g.getTemplate(name)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get roletemplate %s with error %w", name, err)
+			}
+			if chain, err = g.longestChain(inherited); err != nil {
+				return nil, err
+			}
+		}
+		if len(chain) > len(longest) {
+			longest = chain
+		}
+	}
+	chain := append([]string{template.Name}, longest...)
+	g.chains[template.Name] = chain
+	return chain, nil
+}
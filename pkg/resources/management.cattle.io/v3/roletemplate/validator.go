@@ -3,6 +3,7 @@ package roletemplate
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
@@ -14,6 +15,7 @@ import (
 	"github.com/sirupsen/logrus"
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -127,6 +129,21 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		return admission.ResponseBadRequest(fmt.Sprintf("Circular Reference: RoleTemplate %s already inherits RoleTemplate %s", circularTemplate.Name, newRT.Name)), nil
 	}
 
+	// existing RoleTemplates exceeding the limits can still be updated, as long as their rules and inherited templates
+	// do not change.
+	limits := currentLimits()
+	enforceLimits := request.Operation == admissionv1.Create || rulesOrInheritanceChanged(oldRT, newRT)
+	if enforceLimits {
+		// templates can only be inherited once they exist
+		msg, err := a.checkInheritanceLimits(newRT, request.Operation == admissionv1.Update, limits)
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			return admission.ResponseBadRequest(msg), nil
+		}
+	}
+
 	if newRT.ExternalRules != nil {
 		if !newRT.External {
 			return admission.ResponseBadRequest("ExternalRules can't be set in RoleTemplates with external=false"), nil
@@ -141,6 +158,10 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all rules for '%s': %w", newRT.Name, err)
 	}
+	if enforceLimits && limits.MaxRules > 0 && len(rules) > limits.MaxRules {
+		return admission.ResponseBadRequest(fmt.Sprintf("RoleTemplate %s has %d rules including the rules of the RoleTemplates it inherits, which exceeds the limit of %d",
+			newRT.Name, len(rules), limits.MaxRules)), nil
+	}
 
 	// Verify template rules as per kubernetes rbac rules. Note that we're
 	// validating according to the non-namespaced rules to allow .rules
@@ -149,6 +170,35 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		return admission.ResponseBadRequest(err.Error()), nil
 	}
 
+	// dangerous rules are checked before the escalate verb, which bypasses the escalation checks below.
+	builder := admission.NewResponseBuilder()
+	if request.Operation == admissionv1.Create || rulesChanged(oldRT, newRT) {
+		dangerousGrants := auth.CurrentDangerousRulesPolicy().Check(rules, newRT.Context == clusterContext)
+		if denied := dangerousGrants.Denied(); len(denied) > 0 {
+			return admission.ResponseFailedEscalation(strings.Join(denied.Messages("RoleTemplate", newRT.Name), "; ")), nil
+		}
+		builder.AddWarnings(dangerousGrants.Messages("RoleTemplate", newRT.Name)...)
+		warnWildcardVerbs(newRT, builder)
+	}
+
+	response, err := a.checkEscalation(request, newRT, rules)
+	return builder.Respond(response), err
+}
+
+// warnWildcardVerbs warns about the rules of the RoleTemplate granting all verbs, which also grant the verbs added to
+// their resources later on.
+func warnWildcardVerbs(rt *v3.RoleTemplate, builder *admission.ResponseBuilder) {
+	for _, rules := range [][]rbacv1.PolicyRule{rt.Rules, rt.ExternalRules} {
+		for _, rule := range rules {
+			if slices.Contains(rule.Verbs, rbacv1.VerbAll) {
+				builder.Warn("RoleTemplate %s grants %s, which includes any verb added later, consider listing the verbs explicitly", rt.Name, auth.DescribeRule(rule))
+			}
+		}
+	}
+}
+
+// checkEscalation verifies that the user has the escalate verb, or holds all the rules of the RoleTemplate.
+func (a *admitter) checkEscalation(request *admission.Request, newRT *v3.RoleTemplate, rules []rbacv1.PolicyRule) (*admissionv1.AdmissionResponse, error) {
 	allowed, err := auth.RequestUserHasVerb(request, gvr, a.sar, escalateVerb, "", "")
 	if err != nil {
 		logrus.Warnf("Failed to check for the 'escalate' verb on RoleTemplates: %v", err)
@@ -163,7 +213,7 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 
 	err = auth.ConfirmNoEscalation(request, rules, "", a.resolver)
 	if err != nil {
-		return admission.ResponseFailedEscalation(err.Error()), nil
+		return auth.FailedEscalationResponse(err.Error(), err), nil
 	}
 
 	return admission.ResponseAllowed(), nil
@@ -198,6 +248,20 @@ func (a *admitter) validateUpdateFields(oldRole, newRole *v3.RoleTemplate, fldPa
 	return nil
 }
 
+// rulesOrInheritanceChanged returns true if the rules or the inherited templates of the RoleTemplate changed.
+func rulesOrInheritanceChanged(oldRole, newRole *v3.RoleTemplate) bool {
+	return !equality.Semantic.DeepEqual(oldRole.Rules, newRole.Rules) ||
+		!equality.Semantic.DeepEqual(oldRole.RoleTemplateNames, newRole.RoleTemplateNames) ||
+		oldRole.External != newRole.External ||
+		!equality.Semantic.DeepEqual(oldRole.ExternalRules, newRole.ExternalRules)
+}
+
+// rulesChanged returns true if the rules granted by the RoleTemplate, directly or through inherited templates, or the
+// context they are granted in changed.
+func rulesChanged(oldRole, newRole *v3.RoleTemplate) bool {
+	return rulesOrInheritanceChanged(oldRole, newRole) || oldRole.Context != newRole.Context
+}
+
 // validateCreateFields checks if all required fields are present and valid.
 func validateCreateFields(newRole *v3.RoleTemplate, fldPath *field.Path) *field.Error {
 	if newRole.Builtin {
@@ -2,6 +2,7 @@ package roletemplate_test
 
 import (
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -55,6 +56,7 @@ func (r *RoleTemplateSuite) Test_PrivilegeEscalation() {
 
 	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
 	roleTemplateCache.EXPECT().AddIndexer(expectedIndexerName, gomock.Any()).AnyTimes()
+	roleTemplateCache.EXPECT().GetByIndex(expectedIndexerName, gomock.Any()).Return(nil, nil).AnyTimes()
 	roleTemplateCache.EXPECT().Get(r.adminRT.Name).Return(r.adminRT, nil).AnyTimes()
 	roleTemplateCache.EXPECT().Get(r.readNodesRT.Name).Return(r.readNodesRT, nil).AnyTimes()
 	roleTemplateCache.EXPECT().Get(notFoundRoleTemplateName).Return(nil, newNotFound(notFoundRoleTemplateName)).AnyTimes()
@@ -262,6 +264,7 @@ func (r *RoleTemplateSuite) Test_UpdateValidation() {
 	ctrl := gomock.NewController(r.T())
 	roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
 	roleTemplateCache.EXPECT().AddIndexer(expectedIndexerName, gomock.Any())
+	roleTemplateCache.EXPECT().GetByIndex(expectedIndexerName, gomock.Any()).Return(nil, nil).AnyTimes()
 	roleTemplateCache.EXPECT().Get(r.adminRT.Name).Return(r.adminRT, nil).AnyTimes()
 	clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
 	roleResolver := auth.NewRoleTemplateResolver(roleTemplateCache, clusterRoleCache)
@@ -1063,6 +1066,341 @@ func (r *RoleTemplateSuite) Test_CheckCircularRef() {
 	}
 }
 
+func (r *RoleTemplateSuite) Test_InheritanceLimits() {
+	defer roletemplate.SetLimits(nil)
+	clusterRoles := []*rbacv1.ClusterRole{r.adminCR}
+	clusterRoleBindings := []*rbacv1.ClusterRoleBinding{
+		{
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.UserKind, Name: adminUser},
+			},
+			RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: r.adminCR.Name},
+		},
+	}
+	resolver, _ := validation.NewTestRuleResolver(nil, nil, clusterRoles, clusterRoleBindings)
+
+	k8Fake := &k8testing.Fake{}
+	fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+
+	tests := []struct {
+		name   string
+		limits roletemplate.Limits
+		update bool
+		// inheriting is the length of the chain of templates inheriting input-role, which is updated with a new rule
+		inheriting  int
+		wantAllowed bool
+		wantMessage string
+	}{
+		{
+			name:        "within the limits",
+			limits:      roletemplate.Limits{MaxInheritanceDepth: 3, MaxInheritedTemplates: 3, MaxRules: 4},
+			wantAllowed: true,
+		},
+		{
+			name:        "too deep",
+			limits:      roletemplate.Limits{MaxInheritanceDepth: 2},
+			wantMessage: "RoleTemplate input-role inherits RoleTemplates 3 levels deep, which exceeds the limit of 2: input-role -> current-0 -> current-1 -> current-2",
+		},
+		{
+			name:        "too many inherited templates",
+			limits:      roletemplate.Limits{MaxInheritedTemplates: 2},
+			wantMessage: "RoleTemplate input-role inherits 3 RoleTemplates, which exceeds the limit of 2",
+		},
+		{
+			name:        "too many rules",
+			limits:      roletemplate.Limits{MaxRules: 3},
+			wantMessage: "RoleTemplate input-role has 4 rules including the rules of the RoleTemplates it inherits, which exceeds the limit of 3",
+		},
+		{
+			name:        "update which does not change the rules nor the inheritance",
+			limits:      roletemplate.Limits{MaxInheritanceDepth: 1, MaxInheritedTemplates: 1, MaxRules: 1},
+			update:      true,
+			wantAllowed: true,
+		},
+		{
+			name:        "update keeping the inheriting templates within the limits",
+			limits:      roletemplate.Limits{MaxInheritanceDepth: 5, MaxInheritedTemplates: 5, MaxRules: 7},
+			inheriting:  2,
+			wantAllowed: true,
+		},
+		{
+			name:        "update making an inheriting template too deep",
+			limits:      roletemplate.Limits{MaxInheritanceDepth: 4},
+			inheriting:  2,
+			wantMessage: "RoleTemplate inheriting-1, which inherits RoleTemplate input-role through inheriting-1 -> inheriting-0 -> input-role, inherits RoleTemplates 5 levels deep, which exceeds the limit of 4: inheriting-1 -> inheriting-0 -> input-role -> current-0 -> current-1 -> current-2",
+		},
+		{
+			name:        "update making an inheriting template inherit too many templates",
+			limits:      roletemplate.Limits{MaxInheritedTemplates: 4},
+			inheriting:  2,
+			wantMessage: "RoleTemplate inheriting-1, which inherits RoleTemplate input-role through inheriting-1 -> inheriting-0 -> input-role, inherits 5 RoleTemplates, which exceeds the limit of 4",
+		},
+		{
+			name:        "update giving an inheriting template too many rules",
+			limits:      roletemplate.Limits{MaxRules: 6},
+			inheriting:  2,
+			wantMessage: "RoleTemplate inheriting-1, which inherits RoleTemplate input-role through inheriting-1 -> inheriting-0 -> input-role, has 7 rules including the rules of the RoleTemplates it inherits, which exceeds the limit of 6",
+		},
+	}
+
+	for i := range tests {
+		testCase := tests[i]
+		r.Run(testCase.name, func() {
+			roletemplate.SetLimits(&testCase.limits)
+			ctrl := gomock.NewController(r.T())
+			roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
+			roleTemplateCache.EXPECT().AddIndexer(expectedIndexerName, gomock.Any())
+			grCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRole](ctrl)
+			grCache.EXPECT().AddIndexer(expectedGlobalRefIndex, gomock.Any())
+
+			// input-role inherits current-0, which inherits current-1, which inherits current-2
+			newRT := createNestedRoleTemplate("input-role", roleTemplateCache, 3, -1, -1)
+			var oldRT *v3.RoleTemplate
+			if testCase.update {
+				oldRT = newRT.DeepCopy()
+				newRT.Labels = map[string]string{"updated": "true"}
+			}
+			if testCase.inheriting > 0 {
+				oldRT = newRT.DeepCopy()
+				newRT.Rules = append(newRT.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get"}})
+				inheritedBy := map[string][]*v3.RoleTemplate{}
+				inherited := newRT.Name
+				for i := 0; i < testCase.inheriting; i++ {
+					inheriting := createRoleTemplate("inheriting-" + strconv.Itoa(i))
+					inheriting.RoleTemplateNames = []string{inherited}
+					roleTemplateCache.EXPECT().Get(inheriting.Name).Return(inheriting, nil).AnyTimes()
+					inheritedBy[inherited] = []*v3.RoleTemplate{inheriting}
+					inherited = inheriting.Name
+				}
+				roleTemplateCache.EXPECT().GetByIndex(expectedIndexerName, gomock.Any()).DoAndReturn(func(_ string, name string) ([]*v3.RoleTemplate, error) {
+					return inheritedBy[name], nil
+				}).AnyTimes()
+			}
+
+			req := createRTRequest(r.T(), oldRT, newRT, adminUser)
+			clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+			roleResolver := auth.NewRoleTemplateResolver(roleTemplateCache, clusterRoleCache)
+
+			validator := roletemplate.NewValidator(resolver, roleResolver, fakeSAR, grCache)
+			admitters := validator.Admitters()
+			r.Len(admitters, 1, "wanted only one admitter")
+			resp, err := admitters[0].Admit(req)
+			r.NoError(err)
+			r.Equal(testCase.wantAllowed, resp.Allowed)
+			if !testCase.wantAllowed && r.NotNil(resp.Result, "expected response result to be set") {
+				r.Equal(testCase.wantMessage, resp.Result.Message)
+			}
+		})
+	}
+}
+
+func (r *RoleTemplateSuite) Test_DangerousRules() {
+	defer auth.SetDangerousRulesPolicy(nil)
+	resolver, _ := validation.NewTestRuleResolver(nil, nil, nil, nil)
+
+	// every user has the escalate verb, which does not bypass the dangerous rules policy
+	k8Fake := &k8testing.Fake{}
+	fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+	k8Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (handled bool, ret runtime.Object, err error) {
+		review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Verb == "escalate"
+		return true, review, nil
+	})
+	denyPolicy := auth.DefaultDangerousRulesPolicy
+	denyPolicy.Action = auth.DangerousRuleDeny
+	readSecrets := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}}
+
+	tests := []struct {
+		name         string
+		policy       *auth.DangerousRulesPolicy
+		oldRT        func() *v3.RoleTemplate
+		newRT        func() *v3.RoleTemplate
+		wantAllowed  bool
+		wantWarnings []string
+	}{
+		{
+			name:  "cluster-wide secrets are reported",
+			oldRT: func() *v3.RoleTemplate { return nil },
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+			wantAllowed:  true,
+			wantWarnings: []string{`RoleTemplate rt-new grants [list] on secrets, which matches the dangerous rule "cluster-wide-secrets"`},
+		},
+		{
+			name:  "project secrets are not reported",
+			oldRT: func() *v3.RoleTemplate { return nil },
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Context = "project"
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+			wantAllowed: true,
+		},
+		{
+			name: "changing the context to cluster reports secrets",
+			oldRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Context = "project"
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+			wantAllowed:  true,
+			wantWarnings: []string{`RoleTemplate rt-new grants [list] on secrets, which matches the dangerous rule "cluster-wide-secrets"`},
+		},
+		{
+			name:   "denied even with escalate",
+			policy: &denyPolicy,
+			oldRT:  func() *v3.RoleTemplate { return nil },
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+		},
+		{
+			name:   "unchanged rules are not checked",
+			policy: &denyPolicy,
+			oldRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				return rt
+			},
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{readSecrets}
+				rt.Labels = map[string]string{"updated": "true"}
+				return rt
+			},
+			wantAllowed: true,
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		r.Run(test.name, func() {
+			auth.SetDangerousRulesPolicy(test.policy)
+			ctrl := gomock.NewController(r.T())
+			roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
+			roleTemplateCache.EXPECT().AddIndexer(expectedIndexerName, gomock.Any())
+			roleTemplateCache.EXPECT().GetByIndex(expectedIndexerName, gomock.Any()).Return(nil, nil).AnyTimes()
+			grCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRole](ctrl)
+			grCache.EXPECT().AddIndexer(expectedGlobalRefIndex, gomock.Any())
+			clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+			roleResolver := auth.NewRoleTemplateResolver(roleTemplateCache, clusterRoleCache)
+
+			validator := roletemplate.NewValidator(resolver, roleResolver, fakeSAR, grCache)
+			req := createRTRequest(r.T(), test.oldRT(), test.newRT(), testUser)
+			resp, err := validator.Admitters()[0].Admit(req)
+			r.NoError(err)
+			r.Equal(test.wantAllowed, resp.Allowed)
+			r.Equal(test.wantWarnings, resp.Warnings)
+			if !test.wantAllowed && r.NotNil(resp.Result) {
+				r.Equal(`RoleTemplate rt-new grants [list] on secrets, which matches the dangerous rule "cluster-wide-secrets"`, resp.Result.Message)
+				r.Equal(int32(http.StatusForbidden), resp.Result.Code)
+			}
+		})
+	}
+}
+
+func (r *RoleTemplateSuite) Test_WildcardVerbs() {
+	resolver, _ := validation.NewTestRuleResolver(nil, nil, nil, nil)
+	k8Fake := &k8testing.Fake{}
+	fakeSAR := &k8fake.FakeSubjectAccessReviews{Fake: &k8fake.FakeAuthorizationV1{Fake: k8Fake}}
+	k8Fake.AddReactor("create", "subjectaccessreviews", func(action k8testing.Action) (handled bool, ret runtime.Object, err error) {
+		review := action.(k8testing.CreateActionImpl).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Verb == "escalate"
+		return true, review, nil
+	})
+	allPods := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"*"}}
+	getPods := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+
+	tests := []struct {
+		name         string
+		oldRT        func() *v3.RoleTemplate
+		newRT        func() *v3.RoleTemplate
+		wantWarnings []string
+	}{
+		{
+			name:  "all verbs are reported on create",
+			oldRT: func() *v3.RoleTemplate { return nil },
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{getPods, allPods}
+				return rt
+			},
+			wantWarnings: []string{"RoleTemplate rt-new grants [*] on pods, which includes any verb added later, consider listing the verbs explicitly"},
+		},
+		{
+			name:  "explicit verbs are not reported",
+			oldRT: func() *v3.RoleTemplate { return nil },
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{getPods}
+				return rt
+			},
+		},
+		{
+			name: "unchanged rules are not reported",
+			oldRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{allPods}
+				return rt
+			},
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{allPods}
+				rt.Labels = map[string]string{"updated": "true"}
+				return rt
+			},
+		},
+		{
+			name: "all verbs are reported when the context changes",
+			oldRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{allPods}
+				return rt
+			},
+			newRT: func() *v3.RoleTemplate {
+				rt := newDefaultRT()
+				rt.Rules = []rbacv1.PolicyRule{allPods}
+				rt.Context = "project"
+				return rt
+			},
+			wantWarnings: []string{"RoleTemplate rt-new grants [*] on pods, which includes any verb added later, consider listing the verbs explicitly"},
+		},
+	}
+
+	for i := range tests {
+		test := tests[i]
+		r.Run(test.name, func() {
+			ctrl := gomock.NewController(r.T())
+			roleTemplateCache := fake.NewMockNonNamespacedCacheInterface[*v3.RoleTemplate](ctrl)
+			roleTemplateCache.EXPECT().AddIndexer(expectedIndexerName, gomock.Any())
+			roleTemplateCache.EXPECT().GetByIndex(expectedIndexerName, gomock.Any()).Return(nil, nil).AnyTimes()
+			grCache := fake.NewMockNonNamespacedCacheInterface[*v3.GlobalRole](ctrl)
+			grCache.EXPECT().AddIndexer(expectedGlobalRefIndex, gomock.Any())
+			clusterRoleCache := fake.NewMockNonNamespacedCacheInterface[*rbacv1.ClusterRole](ctrl)
+			roleResolver := auth.NewRoleTemplateResolver(roleTemplateCache, clusterRoleCache)
+
+			validator := roletemplate.NewValidator(resolver, roleResolver, fakeSAR, grCache)
+			req := createRTRequest(r.T(), test.oldRT(), test.newRT(), testUser)
+			resp, err := validator.Admitters()[0].Admit(req)
+			r.NoError(err)
+			r.True(resp.Allowed)
+			r.Equal(test.wantWarnings, resp.Warnings)
+		})
+	}
+}
+
 func createNestedRoleTemplate(name string, cache *fake.MockNonNamespacedCacheInterface[*v3.RoleTemplate], depth int, circleDepth int, errDepth int) *v3.RoleTemplate {
 	start := createRoleTemplate(name)
 	prior := start
@@ -95,26 +95,64 @@ func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResp
 		return nil, fmt.Errorf("failed to get Setting from request: %w", err)
 	}
 
+	builder := admission.NewResponseBuilder()
+
 	switch request.Operation {
 	case admissionv1.Create:
-		return a.admitCreate(newSetting)
+		warnDeprecatedValue(nil, newSetting, builder)
+		response, err := a.admitCreate(newSetting)
+		return builder.Respond(response), err
 	case admissionv1.Update:
-		return a.admitUpdate(oldSetting, newSetting)
+		warnDeprecatedValue(oldSetting, newSetting, builder)
+		response, err := a.admitUpdate(oldSetting, newSetting, builder)
+		return builder.Respond(response), err
 	default:
 		return admission.ResponseAllowed(), nil
 	}
 }
 
+// deprecatedValue is a value of a setting which is still accepted, but should be replaced.
+type deprecatedValue struct {
+	matches func(value string) bool
+	// replacement tells what to set instead of the deprecated value.
+	replacement string
+}
+
+// deprecatedValues holds the deprecated values of each setting.
+var deprecatedValues = map[string][]deprecatedValue{
+	DisableInactiveUserAfter: {{matches: isZeroDuration, replacement: "leave the value empty to never disable inactive users"}},
+	DeleteInactiveUserAfter:  {{matches: isZeroDuration, replacement: "leave the value empty to never delete inactive users"}},
+}
+
+// warnDeprecatedValue warns when the value of the setting is set to a deprecated value. Updates which keep the value
+// of the setting do not warn again.
+func warnDeprecatedValue(oldSetting, newSetting *v3.Setting, builder *admission.ResponseBuilder) {
+	if newSetting.Value == "" || (oldSetting != nil && oldSetting.Value == newSetting.Value) {
+		return
+	}
+	for _, deprecated := range deprecatedValues[newSetting.Name] {
+		if deprecated.matches(newSetting.Value) {
+			builder.Warn("value %q of setting %s is deprecated, %s", newSetting.Value, newSetting.Name, deprecated.replacement)
+		}
+	}
+}
+
+// isZeroDuration returns true if the value is a zero duration, e.g. 0s, which is equivalent to an empty value.
+func isZeroDuration(value string) bool {
+	dur, err := time.ParseDuration(value)
+	return err == nil && dur == 0
+}
+
 func (a *admitter) admitCreate(newSetting *v3.Setting) (*admissionv1.AdmissionResponse, error) {
 	return a.admitCommonCreateUpdate(nil, newSetting)
 }
 
-func (a *admitter) admitUpdate(oldSetting, newSetting *v3.Setting) (*admissionv1.AdmissionResponse, error) {
+func (a *admitter) admitUpdate(oldSetting, newSetting *v3.Setting, builder *admission.ResponseBuilder) (*admissionv1.AdmissionResponse, error) {
 	var err error
 
 	switch newSetting.Name {
 	case AgentTLSMode:
-		err = a.validateAgentTLSMode(oldSetting, newSetting)
+		err = a.validateAgentTLSMode(oldSetting, newSetting, builder)
 	default:
 	}
 
@@ -318,9 +356,13 @@ func parseMinutes(value string) (time.Duration, error) {
 	return time.Duration(minutes) * time.Minute, nil
 }
 
-func (a *admitter) validateAgentTLSMode(oldSetting, newSetting *v3.Setting) error {
+// validateAgentTLSMode makes sure all downstream clusters are ready for the strict agent TLS mode
+// before switching to it. Forcing the switch skips the check, which is surfaced as a warning.
+func (a *admitter) validateAgentTLSMode(oldSetting, newSetting *v3.Setting, builder *admission.ResponseBuilder) error {
 	if effectiveValue(oldSetting) == "system-store" && effectiveValue(newSetting) == "strict" {
 		if force := newSetting.Annotations["cattle.io/force"]; force == "true" {
+			builder.Warn("%s was forced to strict without checking the AgentTlsStrictCheck condition of the clusters, "+
+				"agents which do not trust the Rancher certificate will fail to connect", AgentTLSMode)
 			return nil
 		}
 		clusters, err := a.clusterCache.List(labels.NewSelector())
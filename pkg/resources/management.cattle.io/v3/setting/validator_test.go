@@ -536,6 +536,67 @@ func (s *SettingSuite) testAdmit(t *testing.T, validator *setting.Validator, old
 	assert.Equal(t, allowed, resp.Allowed)
 }
 
+func (s *SettingSuite) TestDeprecatedValueWarnings() {
+	tests := []struct {
+		desc         string
+		name         string
+		oldValue     *string
+		value        string
+		wantWarnings []string
+	}{
+		{
+			desc:         "zero duration on create",
+			name:         setting.DisableInactiveUserAfter,
+			value:        "0s",
+			wantWarnings: []string{`value "0s" of setting disable-inactive-user-after is deprecated, leave the value empty to never disable inactive users`},
+		},
+		{
+			desc:         "zero duration on update",
+			name:         setting.DeleteInactiveUserAfter,
+			oldValue:     admission.Ptr("336h"),
+			value:        "0",
+			wantWarnings: []string{`value "0" of setting delete-inactive-user-after is deprecated, leave the value empty to never delete inactive users`},
+		},
+		{
+			desc:     "update keeping a deprecated value",
+			name:     setting.DisableInactiveUserAfter,
+			oldValue: admission.Ptr("0s"),
+			value:    "0s",
+		},
+		{
+			desc:  "setting without deprecated values",
+			name:  "server-url",
+			value: "0",
+		},
+		{
+			desc:  "empty value",
+			name:  setting.DeleteInactiveUserAfter,
+			value: "",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		s.Run(test.desc, func() {
+			newSetting := &v3.Setting{ObjectMeta: metav1.ObjectMeta{Name: test.name}, Value: test.value}
+			objRaw, err := json.Marshal(newSetting)
+			s.Require().NoError(err)
+			op := v1.Create
+			var oldObjRaw []byte
+			if test.oldValue != nil {
+				op = v1.Update
+				oldObjRaw, err = json.Marshal(&v3.Setting{ObjectMeta: metav1.ObjectMeta{Name: test.name}, Value: *test.oldValue})
+				s.Require().NoError(err)
+			}
+
+			resp, err := setting.NewValidator(nil, nil).Admitters()[0].Admit(newRequest(op, objRaw, oldObjRaw))
+			s.Require().NoError(err)
+			s.True(resp.Allowed)
+			s.Equal(test.wantWarnings, resp.Warnings)
+		})
+	}
+}
+
 func (s *SettingSuite) TestValidatingWebhookFailurePolicy() {
 	t := s.T()
 	validator := setting.NewValidator(nil, nil)
@@ -572,6 +633,7 @@ func TestValidateAgentTLSMode(t *testing.T) {
 		clusters           []*v3.Cluster
 		clusterListerFails bool
 		allowed            bool
+		warned             bool
 	}{
 		"create allowed for system store": {
 			newSetting: v3.Setting{
@@ -675,6 +737,7 @@ func TestValidateAgentTLSMode(t *testing.T) {
 			},
 			operation: v1.Update,
 			allowed:   true,
+			warned:    true,
 		},
 		"update forbidden without cluster status and non-true force annotation": {
 			oldSetting: v3.Setting{
@@ -756,6 +819,7 @@ func TestValidateAgentTLSMode(t *testing.T) {
 			},
 			operation: v1.Update,
 			allowed:   true,
+			warned:    true,
 		},
 		"update allowed from strict to system store": {
 			oldSetting: v3.Setting{
@@ -1009,6 +1073,11 @@ func TestValidateAgentTLSMode(t *testing.T) {
 			})
 			require.NoError(t, err)
 			assert.Equal(t, tc.allowed, res.Allowed)
+			if tc.warned {
+				assert.Len(t, res.Warnings, 1)
+			} else {
+				assert.Empty(t, res.Warnings)
+			}
 		})
 	}
 }
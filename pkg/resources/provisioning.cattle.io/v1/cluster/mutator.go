@@ -3,7 +3,6 @@ package cluster
 import (
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -16,7 +15,6 @@ import (
 	"github.com/rancher/webhook/pkg/admission"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
 	objectsv1 "github.com/rancher/webhook/pkg/generated/objects/provisioning.cattle.io/v1"
-	"github.com/rancher/webhook/pkg/patch"
 	psa "github.com/rancher/webhook/pkg/podsecurityadmission"
 	"github.com/rancher/webhook/pkg/resources/common"
 	"github.com/rancher/wrangler/v3/pkg/data/convert"
@@ -94,52 +92,42 @@ func (m *ProvisioningClusterMutator) MutatingWebhook(clientConfig admissionregis
 
 // Admit is the entrypoint for the mutator. Admit will return an error if it unable to process the request.
 func (m *ProvisioningClusterMutator) Admit(request *admission.Request) (*admissionv1.AdmissionResponse, error) {
-	if request.DryRun != nil && *request.DryRun {
-		return &admissionv1.AdmissionResponse{
-			Allowed: true,
-		}, nil
-	}
-
 	listTrace := trace.New("provisioningCluster Admit", trace.Field{Key: "user", Value: request.UserInfo.Username})
 	defer listTrace.LogIfLong(admission.SlowTraceDuration)
 
-	oldCluster, cluster, err := objectsv1.ClusterOldAndNewFromRequest(&request.AdmissionRequest)
-	if err != nil {
-		return nil, err
-	}
-
-	// Re-marshal the cluster for generating the JSON patch. If the webhook's provisioning cluster CRD is out of date, the
-	// patch will unintentionally drop new (unknown) fields. This ensures the patch is generated based solely on the
-	// patches we expect.
-	clusterJSON, err := json.Marshal(cluster)
-	if err != nil {
-		return nil, err
-	}
-
-	if request.Operation == admissionv1.Create {
-		common.SetCreatorIDAnnotation(request, cluster)
-	}
-
-	response, err := m.handlePSACT(request, cluster)
-	if err != nil {
-		return nil, err
-	}
-	if response.Result != nil {
-		return response, nil
-	}
-
-	if request.Operation == admissionv1.Update {
-		response = m.handleDynamicSchemaDrop(request, oldCluster, cluster)
-		if response.Result != nil {
-			return response, nil
-		}
-	}
+	return admission.NewMutatorChain(objectsv1.ClusterOldAndNewFromRequest, m.mutationSteps()...).Admit(request)
+}
 
-	response.Allowed = true
-	if err = patch.CreatePatch(clusterJSON, cluster, response); err != nil {
-		return nil, fmt.Errorf("failed to create patch: %w", err)
+// mutationSteps returns the mutations of provisioning clusters, in the order they are applied.
+func (m *ProvisioningClusterMutator) mutationSteps() []admission.MutationStep[*v1.Cluster] {
+	return []admission.MutationStep[*v1.Cluster]{
+		{
+			Name: "creator-id",
+			Mutate: func(request *admission.Request, _, cluster *v1.Cluster) (*admissionv1.AdmissionResponse, error) {
+				if request.Operation == admissionv1.Create {
+					common.SetCreatorIDAnnotation(request, cluster)
+				}
+				return admission.ResponseAllowed(), nil
+			},
+		},
+		{
+			Name: "psact",
+			// the PSACT secret is created, updated and deleted by the mutator
+			SkipOnDryRun: true,
+			Mutate: func(request *admission.Request, _, cluster *v1.Cluster) (*admissionv1.AdmissionResponse, error) {
+				return m.handlePSACT(request, cluster)
+			},
+		},
+		{
+			Name: "dynamic-schema-drop",
+			Mutate: func(request *admission.Request, oldCluster, cluster *v1.Cluster) (*admissionv1.AdmissionResponse, error) {
+				if request.Operation != admissionv1.Update {
+					return admission.ResponseAllowed(), nil
+				}
+				return m.handleDynamicSchemaDrop(request, oldCluster, cluster), nil
+			},
+		},
 	}
-	return response, nil
 }
 
 // handleDynamicSchemaDrop watches for provisioning cluster updates, and reinserts the previous value of the
@@ -10,6 +10,7 @@ import (
 	"github.com/rancher/webhook/pkg/admission"
 	data2 "github.com/rancher/wrangler/v3/pkg/data"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	admissionv1 "k8s.io/api/admission/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -622,6 +623,44 @@ func TestAdmitPreserveUnknownFields(t *testing.T) {
 
 }
 
+func TestAdmitDryRun(t *testing.T) {
+	t.Parallel()
+	pool := v1.RKEMachinePool{Name: "a", DynamicSchemaSpec: "a"}
+	oldCluster := &v1.Cluster{Spec: v1.ClusterSpec{RKEConfig: &v1.RKEConfig{MachinePools: []v1.RKEMachinePool{pool}}}}
+	cluster := &v1.Cluster{
+		Spec: v1.ClusterSpec{
+			// the mutator has no clients, so the PSACT mutation would fail if it was not skipped
+			DefaultPodSecurityAdmissionConfigurationTemplateName: "restricted",
+			RKEConfig: &v1.RKEConfig{MachinePools: []v1.RKEMachinePool{{Name: "a"}}},
+		},
+	}
+	oldRaw, err := json.Marshal(oldCluster)
+	require.NoError(t, err)
+	raw, err := json.Marshal(cluster)
+	require.NoError(t, err)
+	request := &admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Object:    runtime.RawExtension{Raw: raw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+			DryRun:    admission.Ptr(true),
+		},
+	}
+	m := ProvisioningClusterMutator{}
+
+	// dry runs get the same creatorId and dynamic schema patches as the actual requests
+	request.Operation = admissionv1.Create
+	response, err := m.Admit(request)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, `[{"op":"add","path":"/metadata/annotations","value":{"field.cattle.io/creatorId":""}}]`, string(response.Patch))
+
+	request.Operation = admissionv1.Update
+	response, err = m.Admit(request)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, `[{"op":"add","path":"/spec/rkeConfig/machinePools/0/dynamicSchemaSpec","value":"a"}]`, string(response.Patch))
+}
+
 func TestDynamicSchemaDrop(t *testing.T) {
 	t.Parallel()
 
@@ -1,16 +1,10 @@
 package clusterrolebinding
 
 import (
-	"fmt"
-
 	"github.com/rancher/webhook/pkg/admission"
-	objectsv1 "github.com/rancher/webhook/pkg/generated/objects/rbac.authorization.k8s.io/v1"
-	"github.com/rancher/webhook/pkg/resources/common"
-	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/utils/trace"
 )
 
 const (
@@ -18,15 +12,16 @@ const (
 )
 
 // Validator implements admission.ValidatingAdmissionHandler.
-type Validator struct {
-	admitter admitter
-}
+type Validator struct{}
 
 // NewValidator returns a new validator for clusterrolebindings.
 func NewValidator() *Validator {
-	return &Validator{
-		admitter: admitter{},
-	}
+	return &Validator{}
+}
+
+// ImmutableFields returns the immutability rules of clusterrolebindings: the owner label can be added but not changed or removed.
+func (v *Validator) ImmutableFields() []admission.ImmutabilityRule {
+	return []admission.ImmutabilityRule{{Labels: []string{grbOwnerLabel}, AllowSet: true}}
 }
 
 // GVR returns the GroupVersionKind for this CRD.
@@ -60,26 +55,8 @@ func (v *Validator) ValidatingWebhook(clientConfig admissionregistrationv1.Webho
 	return []admissionregistrationv1.ValidatingWebhook{*webhook}
 }
 
-// Admitters returns the admitter objects used to validate roles.
+// Admitters returns no admitters, the validator only registers the webhook. The owner label is protected by the
+// rules of ImmutableFields.
 func (v *Validator) Admitters() []admission.Admitter {
-	return []admission.Admitter{&v.admitter}
-}
-
-type admitter struct{}
-
-// Admit is the entrypoint for the validator. Admit will return an error if it's unable to process the request.
-func (a *admitter) Admit(request *admission.Request) (*admissionv1.AdmissionResponse, error) {
-	listTrace := trace.New("clusterRolebindingValidator Admit", trace.Field{Key: "user", Value: request.UserInfo.Username})
-	defer listTrace.LogIfLong(admission.SlowTraceDuration)
-
-	oldRoleBinding, newRoleBinding, err := objectsv1.ClusterRoleBindingOldAndNewFromRequest(&request.AdmissionRequest)
-	if err != nil {
-		return nil, err
-	}
-
-	if common.IsModifyingLabel(oldRoleBinding.Labels, newRoleBinding.Labels, grbOwnerLabel) {
-		return admission.ResponseBadRequest(fmt.Sprintf("cannot modify or remove label %s", grbOwnerLabel)), nil
-	}
-
-	return admission.ResponseAllowed(), nil
+	return nil
 }
@@ -157,10 +157,7 @@ func TestAdmit(t *testing.T) {
 			req.OldObject.Raw, err = json.Marshal(test.args.oldRB)
 			require.NoError(t, err)
 
-			validator := NewValidator()
-			admitter := validator.Admitters()
-
-			response, err := admitter[0].Admit(req)
+			response, err := validate(NewValidator(), req)
 
 			require.NoError(t, err)
 			require.Equalf(t, test.allowed, response.Allowed, "Response was incorrectly validated wanted response.Allowed = '%v' got '%v' message=%+v", test.allowed, response.Allowed, response.Result)
@@ -186,8 +183,25 @@ func TestAdmin_errors(t *testing.T) {
 	}
 	req.Object = runtime.RawExtension{}
 
-	validator := NewValidator()
-	admitter := validator.Admitters()
-	_, err := admitter[0].Admit(req)
+	_, err := validate(NewValidator(), req)
 	require.Error(t, err, "Admit should fail on bad request object")
 }
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*admissionv1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
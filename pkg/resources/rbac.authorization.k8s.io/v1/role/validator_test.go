@@ -157,9 +157,7 @@ func TestAdmit(t *testing.T) {
 			req.OldObject.Raw, err = json.Marshal(test.args.oldRole)
 			require.NoError(t, err)
 
-			admitter := NewValidator().Admitters()
-
-			response, err := admitter[0].Admit(req)
+			response, err := validate(NewValidator(), req)
 			if test.wantErr {
 				require.Error(t, err)
 				return
@@ -170,3 +168,22 @@ func TestAdmit(t *testing.T) {
 		})
 	}
 }
+
+// validate checks the request against the immutability rules of the validator and then with its admitters, in the
+// order of its webhook, until one of them denies the request.
+func validate(validator admission.ImmutableFieldsHandler, request *admission.Request) (*admissionv1.AdmissionResponse, error) {
+	errs, err := admission.ValidateImmutableFields(request, validator.GVR(), validator.ImmutableFields())
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return admission.ResponseFromErrorList(errs)
+	}
+	response := admission.ResponseAllowed()
+	for _, admitter := range validator.Admitters() {
+		if response, err = admitter.Admit(request); err != nil || !response.Allowed {
+			break
+		}
+	}
+	return response, err
+}
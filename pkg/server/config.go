@@ -0,0 +1,404 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/clients"
+	"github.com/rancher/webhook/pkg/resources/management.cattle.io/v3/roletemplate"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// configMapName is the name of the ConfigMap, in the webhook's namespace, used to configure the webhook at runtime.
+	configMapName = clients.ConfigMapName
+	// enforcementModesKey is the ConfigMap key holding a YAML map of webhook names to enforcement modes.
+	enforcementModesKey = "enforcement-modes"
+	// webhookOverridesKey is the ConfigMap key holding a YAML map of webhook names to webhookOverride.
+	webhookOverridesKey = "webhook-overrides"
+	// disabledHandlersKey is the ConfigMap key holding a YAML list of the subpaths of handlers to disable.
+	disabledHandlersKey = "disabled-handlers"
+	// roleTemplateLimitsKey is the ConfigMap key holding the roletemplate.Limits enforced on RoleTemplates. Limits which
+	// are not set keep their default value.
+	roleTemplateLimitsKey = "roletemplate-limits"
+	// dangerousRulesKey is the ConfigMap key holding the auth.DangerousRulesPolicy enforced on RoleTemplates and
+	// GlobalRoles. If the rules are not set, the default rules are kept.
+	dangerousRulesKey = "dangerous-rules"
+	// bindingMaxTTLKey is the ConfigMap key holding the maximum time until the expiration of a ClusterRoleTemplateBinding,
+	// ProjectRoleTemplateBinding or GlobalRoleBinding, as a duration such as 168h.
+	bindingMaxTTLKey = "binding-max-ttl"
+	// separationOfDutiesKey is the ConfigMap key holding the auth.SeparationOfDutiesPolicy enforced on
+	// ClusterRoleTemplateBindings, ProjectRoleTemplateBindings and GlobalRoleBindings.
+	separationOfDutiesKey = "separation-of-duties"
+
+	minTimeoutSeconds = 1
+	maxTimeoutSeconds = 30
+)
+
+// webhookConfig is the runtime configuration read from the rancher-webhook-config ConfigMap.
+type webhookConfig struct {
+	enforcementModes map[string]admission.EnforcementMode
+	overrides        map[string]webhookOverride
+	disabledHandlers map[string]bool
+	// roleTemplateLimits is nil if the limits are not configured.
+	roleTemplateLimits *roletemplate.Limits
+	// dangerousRules is nil if the policy is not configured.
+	dangerousRules *auth.DangerousRulesPolicy
+	// bindingMaxTTL is nil if the maximum binding TTL is not configured.
+	bindingMaxTTL *time.Duration
+	// separationOfDuties is nil if the policy is not configured.
+	separationOfDuties *auth.SeparationOfDutiesPolicy
+}
+
+// webhookOverride holds the fields of a generated ValidatingWebhook or MutatingWebhook that can be overridden by operators.
+// Fields left empty keep the value set by the handler.
+type webhookOverride struct {
+	FailurePolicy     *v1.FailurePolicyType `json:"failurePolicy,omitempty"`
+	TimeoutSeconds    *int32                `json:"timeoutSeconds,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	ObjectSelector    *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	MatchConditions   []v1.MatchCondition   `json:"matchConditions,omitempty"`
+}
+
+// validate returns an error if the override would produce an invalid webhook.
+func (o *webhookOverride) validate() error {
+	if o.FailurePolicy != nil && *o.FailurePolicy != v1.Fail && *o.FailurePolicy != v1.Ignore {
+		return fmt.Errorf("failurePolicy must be %s or %s", v1.Fail, v1.Ignore)
+	}
+	if o.TimeoutSeconds != nil && (*o.TimeoutSeconds < minTimeoutSeconds || *o.TimeoutSeconds > maxTimeoutSeconds) {
+		return fmt.Errorf("timeoutSeconds must be between %d and %d", minTimeoutSeconds, maxTimeoutSeconds)
+	}
+	for _, selector := range []*metav1.LabelSelector{o.NamespaceSelector, o.ObjectSelector} {
+		if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			return fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+	for _, condition := range o.MatchConditions {
+		if condition.Name == "" || condition.Expression == "" {
+			return fmt.Errorf("matchConditions must have a name and an expression")
+		}
+	}
+	return nil
+}
+
+// applyValidating overrides the fields of the given webhook.
+func (o *webhookOverride) applyValidating(webhook *v1.ValidatingWebhook) {
+	if o.FailurePolicy != nil {
+		webhook.FailurePolicy = admission.Ptr(*o.FailurePolicy)
+	}
+	if o.TimeoutSeconds != nil {
+		webhook.TimeoutSeconds = admission.Ptr(*o.TimeoutSeconds)
+	}
+	if o.NamespaceSelector != nil {
+		webhook.NamespaceSelector = o.NamespaceSelector.DeepCopy()
+	}
+	if o.ObjectSelector != nil {
+		webhook.ObjectSelector = o.ObjectSelector.DeepCopy()
+	}
+	if o.MatchConditions != nil {
+		webhook.MatchConditions = append([]v1.MatchCondition(nil), o.MatchConditions...)
+	}
+}
+
+// applyMutating overrides the fields of the given webhook.
+func (o *webhookOverride) applyMutating(webhook *v1.MutatingWebhook) {
+	if o.FailurePolicy != nil {
+		webhook.FailurePolicy = admission.Ptr(*o.FailurePolicy)
+	}
+	if o.TimeoutSeconds != nil {
+		webhook.TimeoutSeconds = admission.Ptr(*o.TimeoutSeconds)
+	}
+	if o.NamespaceSelector != nil {
+		webhook.NamespaceSelector = o.NamespaceSelector.DeepCopy()
+	}
+	if o.ObjectSelector != nil {
+		webhook.ObjectSelector = o.ObjectSelector.DeepCopy()
+	}
+	if o.MatchConditions != nil {
+		webhook.MatchConditions = append([]v1.MatchCondition(nil), o.MatchConditions...)
+	}
+}
+
+// configKeys lists the keys of the ConfigMap, with the functions parsing them into a webhookConfig and copying their
+// value from another webhookConfig.
+var configKeys = []struct {
+	key      string
+	parse    func(data string, config *webhookConfig) error
+	copyFrom func(config, from *webhookConfig)
+}{
+	{
+		key:      enforcementModesKey,
+		parse:    parseEnforcementModes,
+		copyFrom: func(config, from *webhookConfig) { config.enforcementModes = from.enforcementModes },
+	},
+	{
+		key:      webhookOverridesKey,
+		parse:    parseWebhookOverrides,
+		copyFrom: func(config, from *webhookConfig) { config.overrides = from.overrides },
+	},
+	{
+		key:      disabledHandlersKey,
+		parse:    parseDisabledHandlersKey,
+		copyFrom: func(config, from *webhookConfig) { config.disabledHandlers = from.disabledHandlers },
+	},
+	{
+		key:      roleTemplateLimitsKey,
+		parse:    parseRoleTemplateLimits,
+		copyFrom: func(config, from *webhookConfig) { config.roleTemplateLimits = from.roleTemplateLimits },
+	},
+	{
+		key:      dangerousRulesKey,
+		parse:    parseDangerousRules,
+		copyFrom: func(config, from *webhookConfig) { config.dangerousRules = from.dangerousRules },
+	},
+	{
+		key:      bindingMaxTTLKey,
+		parse:    parseBindingMaxTTL,
+		copyFrom: func(config, from *webhookConfig) { config.bindingMaxTTL = from.bindingMaxTTL },
+	},
+	{
+		key:      separationOfDutiesKey,
+		parse:    parseSeparationOfDuties,
+		copyFrom: func(config, from *webhookConfig) { config.separationOfDuties = from.separationOfDuties },
+	},
+}
+
+// parseWebhookConfig parses the runtime configuration held by the given ConfigMap. Each key is parsed on its own: an
+// invalid key keeps its value from the previous configuration, which may be nil, and its error is returned along with
+// the configuration.
+func parseWebhookConfig(configMap *corev1.ConfigMap, previous *webhookConfig) (*webhookConfig, error) {
+	config := &webhookConfig{}
+	if configMap == nil {
+		return config, nil
+	}
+	if previous == nil {
+		previous = &webhookConfig{}
+	}
+	var errs []error
+	for _, configKey := range configKeys {
+		data := configMap.Data[configKey.key]
+		if strings.TrimSpace(data) == "" {
+			continue
+		}
+		// keys are parsed into a separate configuration so that an invalid key does not leave a partial value
+		parsed := &webhookConfig{}
+		if err := configKey.parse(data, parsed); err != nil {
+			errs = append(errs, err)
+			configKey.copyFrom(config, previous)
+			continue
+		}
+		configKey.copyFrom(config, parsed)
+	}
+	return config, errors.Join(errs...)
+}
+
+func parseEnforcementModes(data string, config *webhookConfig) error {
+	var modes map[string]string
+	if err := yaml.Unmarshal([]byte(data), &modes); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", enforcementModesKey, err)
+	}
+	config.enforcementModes = make(map[string]admission.EnforcementMode, len(modes))
+	for name, value := range modes {
+		mode, err := admission.ParseEnforcementMode(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s for webhook %s: %w", enforcementModesKey, name, err)
+		}
+		config.enforcementModes[name] = mode
+	}
+	return nil
+}
+
+func parseWebhookOverrides(data string, config *webhookConfig) error {
+	if err := yaml.UnmarshalStrict([]byte(data), &config.overrides); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", webhookOverridesKey, err)
+	}
+	for name, override := range config.overrides {
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("invalid %s for webhook %s: %w", webhookOverridesKey, name, err)
+		}
+	}
+	return nil
+}
+
+func parseDisabledHandlersKey(data string, config *webhookConfig) error {
+	var subPaths []string
+	if err := yaml.Unmarshal([]byte(data), &subPaths); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", disabledHandlersKey, err)
+	}
+	config.disabledHandlers = parseDisabledHandlers(subPaths...)
+	return nil
+}
+
+func parseRoleTemplateLimits(data string, config *webhookConfig) error {
+	limits := roletemplate.DefaultLimits
+	if err := yaml.UnmarshalStrict([]byte(data), &limits); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", roleTemplateLimitsKey, err)
+	}
+	if err := limits.Validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", roleTemplateLimitsKey, err)
+	}
+	config.roleTemplateLimits = &limits
+	return nil
+}
+
+func parseDangerousRules(data string, config *webhookConfig) error {
+	// the default rules are not decoded into, since decoding reuses the elements of existing slices
+	policy := auth.DangerousRulesPolicy{Action: auth.DefaultDangerousRulesPolicy.Action}
+	if err := yaml.UnmarshalStrict([]byte(data), &policy); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", dangerousRulesKey, err)
+	}
+	if policy.Rules == nil {
+		policy.Rules = auth.DefaultDangerousRulesPolicy.Rules
+	}
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", dangerousRulesKey, err)
+	}
+	config.dangerousRules = &policy
+	return nil
+}
+
+func parseBindingMaxTTL(data string, config *webhookConfig) error {
+	ttl, err := time.ParseDuration(strings.TrimSpace(data))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", bindingMaxTTLKey, err)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("invalid %s: must be positive", bindingMaxTTLKey)
+	}
+	config.bindingMaxTTL = &ttl
+	return nil
+}
+
+func parseSeparationOfDuties(data string, config *webhookConfig) error {
+	var policy auth.SeparationOfDutiesPolicy
+	if err := yaml.UnmarshalStrict([]byte(data), &policy); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", separationOfDutiesKey, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", separationOfDutiesKey, err)
+	}
+	config.separationOfDuties = &policy
+	return nil
+}
+
+// parseDisabledHandlers returns the set of the given handler subpaths, ignoring empty values.
+func parseDisabledHandlers(subPaths ...string) map[string]bool {
+	disabled := map[string]bool{}
+	for _, subPath := range subPaths {
+		if subPath = strings.TrimSpace(subPath); subPath != "" {
+			disabled[subPath] = true
+		}
+	}
+	return disabled
+}
+
+// configHandler applies the rancher-webhook-config ConfigMap and holds the webhook overrides and disabled handlers
+// used by the secretHandler and the webhook routes.
+type configHandler struct {
+	secrets corecontrollers.SecretController
+	// envDisabledHandlers holds the handlers disabled through the environment, which can not be re-enabled by the ConfigMap.
+	envDisabledHandlers map[string]bool
+
+	mutex            sync.RWMutex
+	overrides        map[string]webhookOverride
+	disabledHandlers map[string]bool
+	// applied is the last applied configuration, whose values are kept for the invalid keys of the ConfigMap.
+	applied *webhookConfig
+}
+
+// sync applies the runtime configuration whenever the rancher-webhook-config ConfigMap changes.
+// Invalid keys are logged and ignored so that their previously applied values stay in place, while valid keys are applied.
+func (c *configHandler) sync(key string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if key != namespace+"/"+configMapName {
+		return configMap, nil
+	}
+	c.mutex.RLock()
+	previous := c.applied
+	c.mutex.RUnlock()
+	config, err := parseWebhookConfig(configMap, previous)
+	if err != nil {
+		logrus.Errorf("Ignoring invalid keys in ConfigMap %s, their previous values are kept: %v", key, err)
+	}
+	admission.SetEnforcementModes(config.enforcementModes)
+	for name, mode := range config.enforcementModes {
+		if mode != admission.EnforcementModeEnforce {
+			logrus.Infof("Webhook %s is in %s mode and will not deny requests", name, mode)
+		}
+	}
+
+	roletemplate.SetLimits(config.roleTemplateLimits)
+	auth.SetDangerousRulesPolicy(config.dangerousRules)
+	auth.SetMaxBindingTTL(config.bindingMaxTTL)
+	auth.SetSeparationOfDutiesPolicy(config.separationOfDuties)
+
+	for subPath := range config.disabledHandlers {
+		logrus.Infof("Handler %s is disabled", subPath)
+	}
+
+	c.mutex.Lock()
+	changed := !equality.Semantic.DeepEqual(c.overrides, config.overrides) ||
+		!equality.Semantic.DeepEqual(c.disabledHandlers, config.disabledHandlers)
+	c.overrides = config.overrides
+	c.disabledHandlers = config.disabledHandlers
+	c.applied = config
+	c.mutex.Unlock()
+	if changed && c.secrets != nil {
+		// the webhook configurations are reconciled by the secretHandler whenever the CA secret changes
+		logrus.Info("Webhook configuration changed, re-applying webhook configuration")
+		c.secrets.Enqueue(namespace, caName)
+	}
+	return configMap, nil
+}
+
+// handlerEnabled returns false if the given handler was disabled through the environment or the ConfigMap.
+func (c *configHandler) handlerEnabled(handler admission.WebhookHandler) bool {
+	if c == nil {
+		return true
+	}
+	subPath := admission.SubPath(handler.GVR())
+	if c.envDisabledHandlers[subPath] {
+		return false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return !c.disabledHandlers[subPath]
+}
+
+// applyValidatingOverrides applies the current overrides to the given webhooks, matched by name.
+func (c *configHandler) applyValidatingOverrides(webhooks []v1.ValidatingWebhook) {
+	if c == nil {
+		return
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for i := range webhooks {
+		if override, ok := c.overrides[webhooks[i].Name]; ok {
+			override.applyValidating(&webhooks[i])
+		}
+	}
+}
+
+// applyMutatingOverrides applies the current overrides to the given webhooks, matched by name.
+func (c *configHandler) applyMutatingOverrides(webhooks []v1.MutatingWebhook) {
+	if c == nil {
+		return
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for i := range webhooks {
+		if override, ok := c.overrides[webhooks[i].Name]; ok {
+			override.applyMutating(&webhooks[i])
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/auth"
+	"github.com/rancher/webhook/pkg/resources/management.cattle.io/v3/roletemplate"
+	"github.com/rancher/wrangler/v3/pkg/generic/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type fakeHandler struct {
+	gvr schema.GroupVersionResource
+}
+
+func (f *fakeHandler) GVR() schema.GroupVersionResource { return f.gvr }
+
+func (f *fakeHandler) Operations() []v1.OperationType { return nil }
+
+func TestParseWebhookConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       map[string]string
+		wantModes  map[string]admission.EnforcementMode
+		wantLimits *roletemplate.Limits
+		wantPolicy *auth.DangerousRulesPolicy
+		wantTTL    *time.Duration
+		wantSoD    *auth.SeparationOfDutiesPolicy
+		wantErr    bool
+	}{
+		{
+			name: "no configuration",
+		},
+		{
+			name: "enforcement modes",
+			data: map[string]string{
+				enforcementModesKey: "rancher.cattle.io.settings.management.cattle.io: warn\nrancher.cattle.io.features.management.cattle.io: audit\n",
+			},
+			wantModes: map[string]admission.EnforcementMode{
+				"rancher.cattle.io.settings.management.cattle.io": admission.EnforcementModeWarn,
+				"rancher.cattle.io.features.management.cattle.io": admission.EnforcementModeAudit,
+			},
+		},
+		{
+			name: "webhook overrides",
+			data: map[string]string{
+				webhookOverridesKey: `
+rancher.cattle.io.settings.management.cattle.io:
+  failurePolicy: Ignore
+  timeoutSeconds: 5
+`,
+			},
+		},
+		{
+			name:    "unknown override field",
+			data:    map[string]string{webhookOverridesKey: "rancher.cattle.io.settings.management.cattle.io:\n  sideEffects: None"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid failure policy",
+			data:    map[string]string{webhookOverridesKey: "rancher.cattle.io.settings.management.cattle.io:\n  failurePolicy: Sometimes"},
+			wantErr: true,
+		},
+		{
+			name:    "timeout too long",
+			data:    map[string]string{webhookOverridesKey: "rancher.cattle.io.settings.management.cattle.io:\n  timeoutSeconds: 60"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid selector",
+			data:    map[string]string{webhookOverridesKey: "rancher.cattle.io.settings.management.cattle.io:\n  objectSelector:\n    matchExpressions:\n    - key: a\n      operator: Maybe"},
+			wantErr: true,
+		},
+		{
+			name: "roletemplate limits",
+			data: map[string]string{roleTemplateLimitsKey: "maxInheritanceDepth: 3\nmaxRules: 0\n"},
+			wantLimits: &roletemplate.Limits{
+				MaxInheritanceDepth:   3,
+				MaxInheritedTemplates: roletemplate.DefaultLimits.MaxInheritedTemplates,
+				MaxRules:              0,
+			},
+		},
+		{
+			name:    "negative roletemplate limit",
+			data:    map[string]string{roleTemplateLimitsKey: "maxInheritedTemplates: -1"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown roletemplate limit",
+			data:    map[string]string{roleTemplateLimitsKey: "maxWidth: 3"},
+			wantErr: true,
+		},
+		{
+			name: "dangerous rules action",
+			data: map[string]string{dangerousRulesKey: "action: Deny"},
+			wantPolicy: &auth.DangerousRulesPolicy{
+				Action: auth.DangerousRuleDeny,
+				Rules:  auth.DefaultDangerousRulesPolicy.Rules,
+			},
+		},
+		{
+			name: "dangerous rules",
+			data: map[string]string{dangerousRulesKey: `
+action: Warn
+rules:
+- name: pods
+  apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["delete"]
+  action: Deny
+`},
+			wantPolicy: &auth.DangerousRulesPolicy{
+				Action: auth.DangerousRuleWarn,
+				Rules: []auth.DangerousRule{
+					{
+						Name:       "pods",
+						PolicyRule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"delete"}},
+						Action:     auth.DangerousRuleDeny,
+					},
+				},
+			},
+		},
+		{
+			name:    "unknown dangerous rules action",
+			data:    map[string]string{dangerousRulesKey: "action: Ignore"},
+			wantErr: true,
+		},
+		{
+			name:    "dangerous rule without verbs",
+			data:    map[string]string{dangerousRulesKey: "rules:\n- name: pods\n  apiGroups: [\"\"]\n  resources: [pods]\n"},
+			wantErr: true,
+		},
+		{
+			name:    "binding max TTL",
+			data:    map[string]string{bindingMaxTTLKey: "168h"},
+			wantTTL: admission.Ptr(168 * time.Hour),
+		},
+		{
+			name:    "invalid binding max TTL",
+			data:    map[string]string{bindingMaxTTLKey: "a week"},
+			wantErr: true,
+		},
+		{
+			name:    "negative binding max TTL",
+			data:    map[string]string{bindingMaxTTLKey: "-1h"},
+			wantErr: true,
+		},
+		{
+			name: "separation of duties",
+			data: map[string]string{separationOfDutiesKey: `
+conflicts:
+- name: owner-auditor
+  roleTemplates: ["cluster-owner", "auditor"]
+  globalRoles: ["admin"]
+`},
+			wantSoD: &auth.SeparationOfDutiesPolicy{
+				Conflicts: []auth.DutyConflict{
+					{Name: "owner-auditor", RoleTemplates: []string{"cluster-owner", "auditor"}, GlobalRoles: []string{"admin"}},
+				},
+			},
+		},
+		{
+			name:    "separation of duties conflict with a single role",
+			data:    map[string]string{separationOfDutiesKey: "conflicts:\n- name: owner\n  roleTemplates: [cluster-owner]\n"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown separation of duties field",
+			data:    map[string]string{separationOfDutiesKey: "conflicts:\n- name: owner\n  roles: [cluster-owner, auditor]\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			data:    map[string]string{enforcementModesKey: "[warn"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			data:    map[string]string{enforcementModesKey: "rancher.cattle.io.settings.management.cattle.io: off"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := parseWebhookConfig(&corev1.ConfigMap{Data: test.data}, nil)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantModes, config.enforcementModes)
+			assert.Equal(t, test.wantLimits, config.roleTemplateLimits)
+			assert.Equal(t, test.wantPolicy, config.dangerousRules)
+			assert.Equal(t, test.wantTTL, config.bindingMaxTTL)
+			assert.Equal(t, test.wantSoD, config.separationOfDuties)
+		})
+	}
+}
+
+func TestParseWebhookConfigKeepsInvalidKeys(t *testing.T) {
+	previousTTL := time.Hour
+	previous := &webhookConfig{
+		bindingMaxTTL:    &previousTTL,
+		enforcementModes: map[string]admission.EnforcementMode{"rancher.cattle.io.secrets": admission.EnforcementModeWarn},
+	}
+	config, err := parseWebhookConfig(&corev1.ConfigMap{Data: map[string]string{
+		bindingMaxTTLKey:    "a week",
+		enforcementModesKey: "rancher.cattle.io.settings.management.cattle.io: audit",
+		disabledHandlersKey: "[secrets",
+	}}, previous)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, bindingMaxTTLKey)
+	assert.ErrorContains(t, err, disabledHandlersKey)
+	// invalid keys keep their previous value, while valid keys are applied
+	assert.Equal(t, &previousTTL, config.bindingMaxTTL)
+	assert.Nil(t, config.disabledHandlers)
+	assert.Equal(t, map[string]admission.EnforcementMode{"rancher.cattle.io.settings.management.cattle.io": admission.EnforcementModeAudit}, config.enforcementModes)
+}
+
+func TestConfigHandlerSync(t *testing.T) {
+	t.Cleanup(func() { admission.SetEnforcementModes(nil) })
+	settings := &fakeHandler{gvr: schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "settings"}}
+	handler := &configHandler{}
+	key := namespace + "/" + configMapName
+	newConfigMap := func(name, modes string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string]string{enforcementModesKey: modes},
+		}
+	}
+
+	_, err := handler.sync(key, newConfigMap(configMapName, "rancher.cattle.io.settings.management.cattle.io: warn"))
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeWarn, admission.EnforcementModeFor(settings))
+
+	// other ConfigMaps are ignored
+	_, err = handler.sync(namespace+"/other", newConfigMap("other", "rancher.cattle.io.settings.management.cattle.io: audit"))
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeWarn, admission.EnforcementModeFor(settings))
+
+	// an invalid key keeps its previous value
+	_, err = handler.sync(key, newConfigMap(configMapName, "rancher.cattle.io.settings.management.cattle.io: off"))
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeWarn, admission.EnforcementModeFor(settings))
+
+	// other keys are applied even if one of them is invalid
+	configMap := newConfigMap(configMapName, "rancher.cattle.io.settings.management.cattle.io: audit")
+	configMap.Data[bindingMaxTTLKey] = "a week"
+	_, err = handler.sync(key, configMap)
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeAudit, admission.EnforcementModeFor(settings))
+
+	// deleting the ConfigMap goes back to enforcing
+	_, err = handler.sync(key, nil)
+	require.NoError(t, err)
+	assert.Equal(t, admission.EnforcementModeEnforce, admission.EnforcementModeFor(settings))
+}
+
+func TestConfigHandlerOverrides(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	secrets := fake.NewMockControllerInterface[*corev1.Secret, *corev1.SecretList](ctrl)
+	secrets.EXPECT().Enqueue(namespace, caName).Times(2)
+	handler := &configHandler{secrets: secrets}
+	key := namespace + "/" + configMapName
+	overrides := `
+rancher.cattle.io.settings.management.cattle.io:
+  failurePolicy: Fail
+  timeoutSeconds: 5
+  namespaceSelector:
+    matchLabels:
+      team: a
+  objectSelector:
+    matchLabels:
+      managed: "true"
+  matchConditions:
+  - name: not-system
+    expression: "!request.userInfo.username.startsWith('system:')"
+rancher.cattle.io.secrets:
+  timeoutSeconds: 3
+`
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: namespace},
+		Data:       map[string]string{webhookOverridesKey: overrides},
+	}
+
+	_, err := handler.sync(key, configMap)
+	require.NoError(t, err)
+	// re-applying the same overrides does not trigger a new reconcile
+	_, err = handler.sync(key, configMap.DeepCopy())
+	require.NoError(t, err)
+
+	validating := []v1.ValidatingWebhook{
+		{Name: "rancher.cattle.io.settings.management.cattle.io", FailurePolicy: admission.Ptr(v1.Ignore)},
+		{Name: "rancher.cattle.io.features.management.cattle.io", FailurePolicy: admission.Ptr(v1.Ignore)},
+	}
+	handler.applyValidatingOverrides(validating)
+	assert.Equal(t, v1.Fail, *validating[0].FailurePolicy)
+	assert.Equal(t, int32(5), *validating[0].TimeoutSeconds)
+	assert.Equal(t, map[string]string{"team": "a"}, validating[0].NamespaceSelector.MatchLabels)
+	assert.Equal(t, map[string]string{"managed": "true"}, validating[0].ObjectSelector.MatchLabels)
+	require.Len(t, validating[0].MatchConditions, 1)
+	assert.Equal(t, "not-system", validating[0].MatchConditions[0].Name)
+	// webhooks without overrides are untouched
+	assert.Equal(t, v1.Ignore, *validating[1].FailurePolicy)
+	assert.Nil(t, validating[1].TimeoutSeconds)
+
+	mutating := []v1.MutatingWebhook{{Name: "rancher.cattle.io.secrets", TimeoutSeconds: admission.Ptr(int32(15))}}
+	handler.applyMutatingOverrides(mutating)
+	assert.Equal(t, int32(3), *mutating[0].TimeoutSeconds)
+
+	// removing the overrides triggers a reconcile
+	_, err = handler.sync(key, nil)
+	require.NoError(t, err)
+	mutating = []v1.MutatingWebhook{{Name: "rancher.cattle.io.secrets", TimeoutSeconds: admission.Ptr(int32(15))}}
+	handler.applyMutatingOverrides(mutating)
+	assert.Equal(t, int32(15), *mutating[0].TimeoutSeconds)
+}
+
+func TestConfigHandlerDisabledHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	secrets := fake.NewMockControllerInterface[*corev1.Secret, *corev1.SecretList](ctrl)
+	secrets.EXPECT().Enqueue(namespace, caName).Times(2)
+	handler := &configHandler{
+		secrets:             secrets,
+		envDisabledHandlers: parseDisabledHandlers(strings.Split("features.management.cattle.io, ", ",")...),
+	}
+	settings := &fakeHandler{gvr: schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "settings"}}
+	features := &fakeHandler{gvr: schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "features"}}
+	provisioning := &fakeHandler{gvr: schema.GroupVersionResource{Group: "provisioning.cattle.io", Version: "v1", Resource: "*"}}
+	key := namespace + "/" + configMapName
+
+	assert.True(t, handler.handlerEnabled(settings))
+	assert.False(t, handler.handlerEnabled(features))
+
+	_, err := handler.sync(key, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: namespace},
+		Data:       map[string]string{disabledHandlersKey: "- settings.management.cattle.io\n- provisioning.cattle.io\n"},
+	})
+	require.NoError(t, err)
+	assert.False(t, handler.handlerEnabled(settings))
+	assert.False(t, handler.handlerEnabled(provisioning))
+
+	// the ConfigMap can not re-enable handlers disabled through the environment
+	_, err = handler.sync(key, nil)
+	require.NoError(t, err)
+	assert.True(t, handler.handlerEnabled(settings))
+	assert.True(t, handler.handlerEnabled(provisioning))
+	assert.False(t, handler.handlerEnabled(features))
+
+	var nilHandler *configHandler
+	assert.True(t, nilHandler.handlerEnabled(features))
+}
@@ -4,7 +4,6 @@ import (
 	"github.com/rancher/webhook/pkg/admission"
 	"github.com/rancher/webhook/pkg/clients"
 	v3 "github.com/rancher/webhook/pkg/generated/controllers/management.cattle.io/v3"
-	"github.com/rancher/webhook/pkg/resolvers"
 	"github.com/rancher/webhook/pkg/resources/catalog.cattle.io/v1/clusterrepo"
 	"github.com/rancher/webhook/pkg/resources/cluster.cattle.io/v3/clusterauthtoken"
 	nshandler "github.com/rancher/webhook/pkg/resources/core/v1/namespace"
@@ -30,6 +29,7 @@ import (
 	"github.com/rancher/webhook/pkg/resources/rbac.authorization.k8s.io/v1/role"
 	"github.com/rancher/webhook/pkg/resources/rbac.authorization.k8s.io/v1/rolebinding"
 	"github.com/rancher/webhook/pkg/resources/rke-machine-config.cattle.io/v1/machineconfig"
+	"k8s.io/client-go/tools/cache"
 )
 
 // Validation returns a list of all ValidatingAdmissionHandlers used by the webhook.
@@ -55,18 +55,14 @@ func Validation(clients *clients.Clients) ([]admission.ValidatingAdmissionHandle
 	}
 
 	if clients.MultiClusterManagement {
-		crtbResolver := resolvers.NewCRTBRuleResolver(clients.Management.ClusterRoleTemplateBinding().Cache(), clients.RoleTemplateResolver)
-		prtbResolver := resolvers.NewPRTBRuleResolver(clients.Management.ProjectRoleTemplateBinding().Cache(), clients.RoleTemplateResolver)
-		grbResolvers := resolvers.NewGRBRuleResolvers(clients.Management.GlobalRoleBinding().Cache(), clients.GlobalRoleResolver)
-
 		handlers = append(
 			handlers,
 			clusterproxyconfig.NewValidator(clients.Management.ClusterProxyConfig().Cache()),
-			podsecurityadmissionconfigurationtemplate.NewValidator(clients.Management.Cluster().Cache(), clients.Provisioning.Cluster().Cache()),
-			globalrole.NewValidator(clients.DefaultResolver, grbResolvers, clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.GlobalRoleResolver),
-			globalrolebinding.NewValidator(clients.DefaultResolver, grbResolvers, clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.GlobalRoleResolver),
-			projectroletemplatebinding.NewValidator(prtbResolver, crtbResolver, clients.DefaultResolver, clients.RoleTemplateResolver, clients.Management.Cluster().Cache(), clients.Management.Project().Cache()),
-			clusterroletemplatebinding.NewValidator(crtbResolver, clients.DefaultResolver, clients.RoleTemplateResolver, clients.Management.GlobalRoleBinding().Cache(), clients.Management.Cluster().Cache()),
+			podsecurityadmissionconfigurationtemplate.NewValidator(clients.Management.Cluster().Cache(), clients.Provisioning.Cluster().Cache(), clients.Core.Namespace().Cache()),
+			globalrole.NewValidator(clients.DefaultResolver, clients.GRBResolvers, clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.GlobalRoleResolver),
+			globalrolebinding.NewValidator(clients.DefaultResolver, clients.GRBResolvers, clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.GlobalRoleResolver, clients.SeparationOfDuties),
+			projectroletemplatebinding.NewValidator(clients.PRTBResolver, clients.CRTBResolver, clients.DefaultResolver, clients.RoleTemplateResolver, clients.Management.Cluster().Cache(), clients.Management.Project().Cache(), clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.SeparationOfDuties),
+			clusterroletemplatebinding.NewValidator(clients.CRTBResolver, clients.DefaultResolver, clients.RoleTemplateResolver, clients.Management.GlobalRoleBinding().Cache(), clients.Management.Cluster().Cache(), clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.SeparationOfDuties),
 			roletemplate.NewValidator(clients.DefaultResolver, clients.RoleTemplateResolver, clients.K8s.AuthorizationV1().SubjectAccessReviews(), clients.Management.GlobalRole().Cache()),
 			secret.NewValidator(clients.RBAC.Role().Cache(), clients.RBAC.RoleBinding().Cache()),
 			nodedriver.NewValidator(clients.Management.Node().Cache(), clients.Dynamic),
@@ -104,3 +100,33 @@ func Mutation(clients *clients.Clients) ([]admission.MutatingAdmissionHandler, e
 
 	return mutators, nil
 }
+
+// cacheInformers returns the informers of the caches used by the handlers returned by Validation and Mutation, keyed
+// by resource. The webhook is not ready until all of them have synced.
+func cacheInformers(clients *clients.Clients) map[string]cache.SharedIndexInformer {
+	informers := map[string]cache.SharedIndexInformer{
+		"secrets":                                                         clients.Core.Secret().Informer(),
+		"roles.rbac.authorization.k8s.io":                                 clients.RBAC.Role().Informer(),
+		"rolebindings.rbac.authorization.k8s.io":                          clients.RBAC.RoleBinding().Informer(),
+		"clusterroles.rbac.authorization.k8s.io":                          clients.RBAC.ClusterRole().Informer(),
+		"clusterrolebindings.rbac.authorization.k8s.io":                   clients.RBAC.ClusterRoleBinding().Informer(),
+		"podsecurityadmissionconfigurationtemplates.management.cattle.io": clients.Management.PodSecurityAdmissionConfigurationTemplate().Informer(),
+	}
+	if clients.MultiClusterManagement {
+		informers["roletemplates.management.cattle.io"] = clients.Management.RoleTemplate().Informer()
+		informers["globalroles.management.cattle.io"] = clients.Management.GlobalRole().Informer()
+		informers["globalrolebindings.management.cattle.io"] = clients.Management.GlobalRoleBinding().Informer()
+		informers["clusterroletemplatebindings.management.cattle.io"] = clients.Management.ClusterRoleTemplateBinding().Informer()
+		informers["projectroletemplatebindings.management.cattle.io"] = clients.Management.ProjectRoleTemplateBinding().Informer()
+		informers["clusters.management.cattle.io"] = clients.Management.Cluster().Informer()
+		informers["clusters.provisioning.cattle.io"] = clients.Provisioning.Cluster().Informer()
+		informers["clusterproxyconfigs.management.cattle.io"] = clients.Management.ClusterProxyConfig().Informer()
+		informers["projects.management.cattle.io"] = clients.Management.Project().Informer()
+		informers["userattributes.management.cattle.io"] = clients.Management.UserAttribute().Informer()
+		informers["users.management.cattle.io"] = clients.Management.User().Informer()
+		informers["nodes.management.cattle.io"] = clients.Management.Node().Informer()
+		informers["settings.management.cattle.io"] = clients.Management.Setting().Informer()
+		informers["namespaces"] = clients.Core.Namespace().Informer()
+	}
+	return informers
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaderLockName      = "rancher-webhook"
+	leaderLeaseDuration = 45 * time.Second
+	leaderRenewDeadline = 30 * time.Second
+	leaderRetryPeriod   = 2 * time.Second
+)
+
+// runLeaderElection campaigns for the leader lock of the webhook until ctx is done, calling onStartedLeading and
+// onStoppedLeading whenever this replica gains or loses the lock. Unlike wrangler's leader package, losing the lock
+// does not exit the process: every replica keeps serving admission requests, and only the leader writes the webhook
+// configurations. The lock is released when ctx is done so that another replica can take over during a rollout.
+func runLeaderElection(ctx context.Context, k8s kubernetes.Interface, onStartedLeading, onStoppedLeading func()) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get leader election identity: %w", err)
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, leaderLockName, k8s.CoreV1(), k8s.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return fmt.Errorf("failed to create leader lock: %w", err)
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            leaderLockName,
+		LeaseDuration:   leaderLeaseDuration,
+		RenewDeadline:   leaderRenewDeadline,
+		RetryPeriod:     leaderRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				logrus.Infof("Acquired the %s lock, reconciling webhook configurations", leaderLockName)
+				onStartedLeading()
+			},
+			OnStoppedLeading: func() {
+				logrus.Infof("Released the %s lock, no longer reconciling webhook configurations", leaderLockName)
+				onStoppedLeading()
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
+	}
+	go func() {
+		// Run returns whenever the lock is lost, in which case this replica campaigns again.
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rancher/webhook/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// metricsPortEnvKey is the environment variable holding the port serving the metrics. A value of 0 disables them.
+	metricsPortEnvKey     = "CATTLE_WEBHOOK_METRICS_PORT"
+	defaultMetricsPort    = 9090
+	metricsReadTimeout    = 10 * time.Second
+	metricsShutdownPeriod = 5 * time.Second
+)
+
+// metricsPortFromEnv returns the port configured through the metricsPortEnvKey environment variable.
+func metricsPortFromEnv() (int, error) {
+	value := os.Getenv(metricsPortEnvKey)
+	if value == "" {
+		return defaultMetricsPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid value '%s' for %s: must be a port number, or 0 to disable the metrics", value, metricsPortEnvKey)
+	}
+	return port, nil
+}
+
+// serveMetrics serves the metrics on their own port until ctx is done. They are kept off the router of the webhook port
+// since, when a client CA is configured, every endpoint of that port other than the health checks requires a client
+// certificate issued by the apiserver's CA, which metrics scrapers don't have.
+func serveMetrics(ctx context.Context, port int) {
+	if port == 0 {
+		logrus.Info("Not serving metrics: the metrics port is 0")
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Handler())
+	metricsServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadTimeout,
+	}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("Failed to serve metrics on port %d: %v", port, err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownPeriod)
+		defer cancel()
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logrus.Warnf("Failed to shut down the metrics server: %v", err)
+		}
+	}()
+}
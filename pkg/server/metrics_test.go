@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsPortFromEnv(t *testing.T) {
+	t.Setenv(metricsPortEnvKey, "")
+	port, err := metricsPortFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, defaultMetricsPort, port)
+
+	t.Setenv(metricsPortEnvKey, "0")
+	port, err = metricsPortFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 0, port)
+
+	t.Setenv(metricsPortEnvKey, "8080")
+	port, err = metricsPortFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 8080, port)
+
+	t.Setenv(metricsPortEnvKey, "metrics")
+	_, err = metricsPortFromEnv()
+	assert.Error(t, err)
+}
@@ -12,21 +12,30 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rancher/dynamiclistener"
 	"github.com/rancher/dynamiclistener/server"
 	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/audit"
 	"github.com/rancher/webhook/pkg/clients"
 	"github.com/rancher/webhook/pkg/health"
+	"github.com/rancher/webhook/pkg/permissions"
 	admissionregistration "github.com/rancher/wrangler/v3/pkg/generated/controllers/admissionregistration.k8s.io/v1"
+	corecontrollers "github.com/rancher/wrangler/v3/pkg/generated/controllers/core/v1"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/server/healthz"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	admissionregistrationdefaults "k8s.io/kubernetes/pkg/apis/admissionregistration/v1"
 )
 
 const (
@@ -37,12 +46,20 @@ const (
 	caName                  = "cattle-webhook-ca"
 	validationPath          = "/v1/webhook/validation"
 	mutationPath            = "/v1/webhook/mutation"
+	metricsPath             = "/metrics"
+	permissionsPath         = "/v1/permissions"
+	healthzPath             = "/healthz"
+	readyzPath              = "/readyz"
+	livezPath               = "/livez"
+	cacheSyncTimeout        = 5 * time.Minute
 	clientPort              = int32(443)
 	webhookHTTPPort         = 0 // value of 0 indicates we do not want to use http.
 	defaultWebhookHTTPSPort = 9443
 	webhookPortEnvKey       = "CATTLE_PORT"
 	webhookURLEnvKey        = "CATTLE_WEBHOOK_URL"
+	webhookConfigName       = "rancher.cattle.io"
 	allowedCNsEnv           = "ALLOWED_CNS"
+	disabledHandlersEnvKey  = "CATTLE_WEBHOOK_DISABLED_HANDLERS"
 )
 
 var caFile = filepath.Join(os.TempDir(), "k8s-webhook-server", "client-ca", "ca.crt")
@@ -61,7 +78,7 @@ var tlsOpt = func(config *tls.Config) {
 	config.ClientAuth = tls.RequestClientCert
 }
 
-// ListenAndServe starts the webhook server.
+// ListenAndServe starts the webhook server and blocks until ctx is done and the server has shut down.
 func ListenAndServe(ctx context.Context, cfg *rest.Config, mcmEnabled bool) error {
 	clients, err := clients.New(ctx, cfg, mcmEnabled)
 	if err != nil {
@@ -75,6 +92,12 @@ func ListenAndServe(ctx context.Context, cfg *rest.Config, mcmEnabled bool) erro
 		logrus.Infof("[ListenAndServe] could not set certificate expiration days via environment variable: %v", err)
 	}
 
+	auditLogger, err := audit.NewLoggerFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to configure the audit log: %w", err)
+	}
+	audit.SetDefault(auditLogger)
+
 	validators, err := Validation(clients)
 	if err != nil {
 		return err
@@ -85,15 +108,30 @@ func ListenAndServe(ctx context.Context, cfg *rest.Config, mcmEnabled bool) erro
 		return err
 	}
 
-	if err = listenAndServe(ctx, clients, validators, mutators); err != nil {
+	drainer, err := newDrainerFromEnv()
+	if err != nil {
+		return err
+	}
+	metricsPort, err := metricsPortFromEnv()
+	if err != nil {
+		return err
+	}
+	// the server outlives ctx so that in-flight requests can be drained once ctx is done
+	serverCtx, stopServer := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopServer()
+	serveMetrics(serverCtx, metricsPort)
+
+	// leadership is released as soon as ctx is done, letting another replica take over while this one drains
+	if err = listenAndServe(serverCtx, ctx, clients, validators, mutators, drainer); err != nil {
 		return err
 	}
 
-	if err = clients.Start(ctx); err != nil {
+	if err = clients.Start(serverCtx); err != nil {
 		return fmt.Errorf("failed to start client: %w", err)
 	}
 
-	return nil
+	<-ctx.Done()
+	return drainer.shutdown(stopServer)
 }
 
 // By default, dynamiclistener sets newly signed certificates to expire after 365 days. Since the
@@ -107,20 +145,39 @@ func setCertificateExpirationDays() error {
 	return nil
 }
 
-func listenAndServe(ctx context.Context, clients *clients.Clients, validators []admission.ValidatingAdmissionHandler, mutators []admission.MutatingAdmissionHandler) (rErr error) {
+func listenAndServe(ctx, leaderCtx context.Context, clients *clients.Clients, validators []admission.ValidatingAdmissionHandler, mutators []admission.MutatingAdmissionHandler, drainer *drainer) (rErr error) {
 	router := mux.NewRouter()
 	errChecker := health.NewErrorChecker("Config Applied")
+	informers := cacheInformers(clients)
+	readinessCheckers := []healthz.HealthChecker{errChecker, drainer.readiness}
+	cacheSyncs := make([]cache.InformerSynced, 0, len(informers))
+	for _, resource := range sets.List(sets.KeySet(informers)) {
+		readinessCheckers = append(readinessCheckers, health.NewInformerSyncChecker("cache-sync-"+resource, informers[resource]))
+		cacheSyncs = append(cacheSyncs, informers[resource].HasSynced)
+	}
 	health.RegisterHealthCheckers(router, errChecker)
+	health.RegisterReadinessCheckers(router, readinessCheckers...)
+	health.RegisterLivenessCheckers(router)
+	if clients.MultiClusterManagement {
+		router.Handle(permissionsPath, permissions.NewHandler(clients.DefaultResolver, clients.CRTBResolver, clients.PRTBResolver, clients.GRBResolvers,
+			clients.K8s.AuthenticationV1().TokenReviews(), clients.K8s.AuthorizationV1().SubjectAccessReviews()))
+	}
+	router.Use(drainer.track)
 	router.Use(certAuth())
 
+	config := &configHandler{
+		secrets:             clients.Core.Secret(),
+		envDisabledHandlers: parseDisabledHandlers(strings.Split(os.Getenv(disabledHandlersEnvKey), ",")...),
+	}
+
 	logrus.Debug("Creating Webhook routes")
 	for _, webhook := range validators {
-		route := router.HandleFunc(admission.Path(validationPath, webhook), admission.NewValidatingHandlerFunc(webhook))
+		route := router.HandleFunc(admission.Path(validationPath, webhook), enabledHandler(config, webhook, admission.NewValidatingHandlerFunc(webhook)))
 		path, _ := route.GetPathTemplate()
 		logrus.Debugf("creating route: %s", path)
 	}
 	for _, webhook := range mutators {
-		route := router.HandleFunc(admission.Path(mutationPath, webhook), admission.NewMutatingHandlerFunc(webhook))
+		route := router.HandleFunc(admission.Path(mutationPath, webhook), enabledHandler(config, webhook, admission.NewMutatingHandlerFunc(webhook)))
 		path, _ := route.GetPathTemplate()
 		logrus.Debugf("creating route: %s", path)
 	}
@@ -129,10 +186,20 @@ func listenAndServe(ctx context.Context, clients *clients.Clients, validators []
 		validators:           validators,
 		mutators:             mutators,
 		errChecker:           errChecker,
+		config:               config,
+		cacheSyncs:           cacheSyncs,
+		secrets:              clients.Core.Secret(),
 		validatingController: clients.Admission.ValidatingWebhookConfiguration(),
 		mutatingController:   clients.Admission.MutatingWebhookConfiguration(),
 	}
 	clients.Core.Secret().OnChange(ctx, "secrets", handler.sync)
+	// the ConfigMap informer only watches the rancher-webhook-config ConfigMap, see clients.New
+	clients.Core.ConfigMap().OnChange(ctx, "webhook-config", config.sync)
+	clients.Admission.ValidatingWebhookConfiguration().OnChange(ctx, "validating-webhook-config", handler.syncValidatingConfiguration)
+	clients.Admission.MutatingWebhookConfiguration().OnChange(ctx, "mutating-webhook-config", handler.syncMutatingConfiguration)
+	if err := runLeaderElection(leaderCtx, clients.K8s, handler.startedLeading, handler.stoppedLeading); err != nil {
+		return err
+	}
 
 	defer func() {
 		if rErr != nil {
@@ -167,12 +234,61 @@ func listenAndServe(ctx context.Context, clients *clients.Clients, validators []
 	})
 }
 
+// enabledHandler returns a HandlerFunc calling next while the handler is enabled. Requests sent to a disabled handler
+// are allowed, since the webhook configurations keep referencing it until the leader reconciles them, and failing
+// these requests would deny them under a Fail failure policy.
+func enabledHandler(config *configHandler, handler admission.WebhookHandler, next http.HandlerFunc) http.HandlerFunc {
+	allow := admission.NewAllowingHandlerFunc()
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		if !config.handlerEnabled(handler) {
+			allow(responseWriter, req)
+			return
+		}
+		next(responseWriter, req)
+	}
+}
+
 type secretHandler struct {
 	validators           []admission.ValidatingAdmissionHandler
 	mutators             []admission.MutatingAdmissionHandler
 	errChecker           *health.ErrorChecker
+	config               *configHandler
+	cacheSyncs           []cache.InformerSynced
+	secrets              corecontrollers.SecretController
 	validatingController admissionregistration.ValidatingWebhookConfigurationClient
 	mutatingController   admissionregistration.MutatingWebhookConfigurationClient
+	// leading is true while this replica holds the leader lock. Only the leader writes the webhook configurations.
+	leading atomic.Bool
+}
+
+// startedLeading enqueues the CA secret so that the new leader applies its webhook configurations.
+func (s *secretHandler) startedLeading() {
+	s.leading.Store(true)
+	s.secrets.Enqueue(namespace, caName)
+}
+
+func (s *secretHandler) stoppedLeading() {
+	s.leading.Store(false)
+}
+
+// syncValidatingConfiguration re-applies the webhook configurations when the validating configuration is edited or deleted.
+func (s *secretHandler) syncValidatingConfiguration(name string, _ *v1.ValidatingWebhookConfiguration) (*v1.ValidatingWebhookConfiguration, error) {
+	s.enqueueIfChanged(name)
+	return nil, nil
+}
+
+// syncMutatingConfiguration re-applies the webhook configurations when the mutating configuration is edited or deleted.
+func (s *secretHandler) syncMutatingConfiguration(name string, _ *v1.MutatingWebhookConfiguration) (*v1.MutatingWebhookConfiguration, error) {
+	s.enqueueIfChanged(name)
+	return nil, nil
+}
+
+// enqueueIfChanged enqueues the CA secret when one of the webhook configurations changes on the leader. Changes made
+// by the leader itself are enqueued as well, but are then found to match the desired configurations.
+func (s *secretHandler) enqueueIfChanged(name string) {
+	if name == webhookConfigName && s.leading.Load() {
+		s.secrets.Enqueue(namespace, caName)
+	}
 }
 
 // sync updates the validating admission configuration whenever the TLS cert changes.
@@ -181,9 +297,16 @@ func (s *secretHandler) sync(_ string, secret *corev1.Secret) (*corev1.Secret, e
 		return nil, nil
 	}
 
-	logrus.Info("Sleeping for 15 seconds then applying webhook config")
-	// Sleep here to make sure server is listening and all caches are primed
-	time.Sleep(15 * time.Second)
+	// The server is already listening when controllers start, but the handlers must not be called before the caches
+	// they read from are primed.
+	logrus.Info("Waiting for caches to sync then applying webhook config")
+	ctx, cancel := context.WithTimeout(context.Background(), cacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), s.cacheSyncs...) {
+		err := fmt.Errorf("caches did not sync within %s", cacheSyncTimeout)
+		s.errChecker.Store(err)
+		return secret, err
+	}
 
 	validationClientConfig := v1.WebhookClientConfig{
 		Service: &v1.ServiceReference{
@@ -216,21 +339,35 @@ func (s *secretHandler) sync(_ string, secret *corev1.Secret) (*corev1.Secret, e
 	}
 	validatingWebhooks := make([]v1.ValidatingWebhook, 0, len(s.validators))
 	for _, webhook := range s.validators {
+		if !s.config.handlerEnabled(webhook) {
+			continue
+		}
 		validatingWebhooks = append(validatingWebhooks, webhook.ValidatingWebhook(validationClientConfig)...)
 	}
 	mutatingWebhooks := make([]v1.MutatingWebhook, 0, len(s.mutators))
 	for _, webhook := range s.mutators {
+		if !s.config.handlerEnabled(webhook) {
+			continue
+		}
 		mutatingWebhooks = append(mutatingWebhooks, webhook.MutatingWebhook(mutationClientConfig)...)
 	}
+	s.config.applyValidatingOverrides(validatingWebhooks)
+	s.config.applyMutatingOverrides(mutatingWebhooks)
+	if !s.leading.Load() {
+		// the webhook configurations are written by the leader, this replica is ready to serve requests
+		logrus.Debug("Not the leader, skipping webhook config")
+		s.errChecker.Store(nil)
+		return secret, nil
+	}
 	validatingConfig := &v1.ValidatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "rancher.cattle.io",
+			Name: webhookConfigName,
 		},
 		Webhooks: validatingWebhooks,
 	}
 	mutatingConfig := &v1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "rancher.cattle.io",
+			Name: webhookConfigName,
 		},
 		Webhooks: mutatingWebhooks,
 	}
@@ -245,6 +382,7 @@ func (s *secretHandler) sync(_ string, secret *corev1.Secret) (*corev1.Secret, e
 }
 
 // ensureWebhookConfiguration creates or updates the current validating and mutating webhook configuration to have the desired webhook.
+// Updates are skipped when the current webhooks already match the desired ones once defaulted by the apiserver.
 func (s *secretHandler) ensureWebhookConfiguration(validatingConfig *v1.ValidatingWebhookConfiguration, mutatingConfig *v1.MutatingWebhookConfiguration) error {
 
 	currValidating, err := s.validatingController.Get(validatingConfig.Name, metav1.GetOptions{})
@@ -255,7 +393,8 @@ func (s *secretHandler) ensureWebhookConfiguration(validatingConfig *v1.Validati
 		}
 	} else if err != nil {
 		return fmt.Errorf("failed to get validating configuration: %w", err)
-	} else {
+	} else if !validatingWebhooksEqual(currValidating.Webhooks, validatingConfig.Webhooks) {
+		logrus.Infof("Updating validating webhook configuration %s", validatingConfig.Name)
 		currValidating.Webhooks = validatingConfig.Webhooks
 		_, err = s.validatingController.Update(currValidating)
 		if err != nil {
@@ -271,7 +410,8 @@ func (s *secretHandler) ensureWebhookConfiguration(validatingConfig *v1.Validati
 		}
 	} else if err != nil {
 		return fmt.Errorf("failed to get mutating configuration: %w", err)
-	} else {
+	} else if !mutatingWebhooksEqual(currMutation.Webhooks, mutatingConfig.Webhooks) {
+		logrus.Infof("Updating mutating webhook configuration %s", mutatingConfig.Name)
 		currMutation.Webhooks = mutatingConfig.Webhooks
 		_, err = s.mutatingController.Update(currMutation)
 		if err != nil {
@@ -282,9 +422,24 @@ func (s *secretHandler) ensureWebhookConfiguration(validatingConfig *v1.Validati
 	return nil
 }
 
+// validatingWebhooksEqual returns true if the current webhooks match the desired webhooks once defaulted.
+func validatingWebhooksEqual(current, desired []v1.ValidatingWebhook) bool {
+	defaulted := (&v1.ValidatingWebhookConfiguration{Webhooks: desired}).DeepCopy()
+	admissionregistrationdefaults.SetObjectDefaults_ValidatingWebhookConfiguration(defaulted)
+	return equality.Semantic.DeepEqual(current, defaulted.Webhooks)
+}
+
+// mutatingWebhooksEqual returns true if the current webhooks match the desired webhooks once defaulted.
+func mutatingWebhooksEqual(current, desired []v1.MutatingWebhook) bool {
+	defaulted := (&v1.MutatingWebhookConfiguration{Webhooks: desired}).DeepCopy()
+	admissionregistrationdefaults.SetObjectDefaults_MutatingWebhookConfiguration(defaulted)
+	return equality.Semantic.DeepEqual(current, defaulted.Webhooks)
+}
+
 // certAuth returns a middleware for cert-based authentication.
 // This is done as a middleware instead of using tls.RequireAndVerifyClientCert because an exception
-// needs to be made for the unauthenticated /healthz endpoint.
+// needs to be made for the unauthenticated health endpoints, and for the permissions endpoint which
+// authenticates its callers with bearer tokens.
 func certAuth() func(next http.Handler) http.Handler {
 	opts := getVerifyOptions()
 	allowedCNs := getAllowedCNs()
@@ -295,7 +450,11 @@ func certAuth() func(next http.Handler) http.Handler {
 				next.ServeHTTP(w, r)
 				return
 			}
-			if r.URL.Path == "/healthz" { // apiserver does not present client cert for health checks
+			if isHealthPath(r.URL.Path) { // apiserver and kubelet do not present client certs for health checks
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == permissionsPath { // callers are authenticated by the handler with a TokenReview
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -335,6 +494,16 @@ func certAuth() func(next http.Handler) http.Handler {
 	}
 }
 
+// isHealthPath returns true for the health endpoints, including the endpoints of individual checks such as /readyz/ping.
+func isHealthPath(path string) bool {
+	for _, healthPath := range []string{healthzPath, readyzPath, livezPath} {
+		if path == healthPath || strings.HasPrefix(path, healthPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func getVerifyOptions() *x509.VerifyOptions {
 	caCert, err := ioutil.ReadFile(caFile)
 	if err != nil {
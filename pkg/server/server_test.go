@@ -1,16 +1,26 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gorilla/mux"
+	"github.com/rancher/webhook/pkg/admission"
+	"github.com/rancher/webhook/pkg/health"
 	"github.com/rancher/wrangler/v3/pkg/generic/fake"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	admissionregistrationdefaults "k8s.io/kubernetes/pkg/apis/admissionregistration/v1"
 )
 
 func TestSecretHandlerEnsureWebhookConfigurationCreate(t *testing.T) {
@@ -73,3 +83,118 @@ func TestSecretHandlerEnsureWebhookConfigurationCreate(t *testing.T) {
 	require.Len(t, storedMutatingConfig.Webhooks, 1)
 	assert.Equal(t, mutatingConfig.Webhooks[0].Name, storedMutatingConfig.Webhooks[0].Name)
 }
+
+func TestEnabledHandler(t *testing.T) {
+	handler := &fakeHandler{gvr: schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "settings"}}
+	config := &configHandler{}
+	router := mux.NewRouter()
+	router.HandleFunc(admission.Path(validationPath, handler), enabledHandler(config, handler, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	path := admission.Path(validationPath, handler)
+	review := func() *bytes.Reader {
+		body, err := json.Marshal(admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "123"}})
+		require.NoError(t, err)
+		return bytes.NewReader(body)
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, path, review()))
+	assert.Equal(t, http.StatusTeapot, response.Code)
+
+	// requests sent to a disabled handler are allowed
+	config.disabledHandlers = parseDisabledHandlers("settings.management.cattle.io")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodPost, path, review()))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var result admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+	require.NotNil(t, result.Response)
+	assert.True(t, result.Response.Allowed)
+	assert.Equal(t, "123", string(result.Response.UID))
+}
+
+func TestSecretHandlerEnsureWebhookConfigurationUpdate(t *testing.T) {
+	desiredValidating := &v1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName},
+		Webhooks: []v1.ValidatingWebhook{{
+			Name:         "rancher.cattle.io.features.management.cattle.io",
+			ClientConfig: v1.WebhookClientConfig{Service: &v1.ServiceReference{Namespace: namespace, Name: serviceName}},
+			Rules:        []v1.RuleWithOperations{{Operations: []v1.OperationType{v1.Update}}},
+		}},
+	}
+	desiredMutating := &v1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName},
+		Webhooks:   []v1.MutatingWebhook{{Name: "rancher.cattle.io.clusters.provisioning.cattle.io"}},
+	}
+	// the current configurations hold the desired webhooks as defaulted by the apiserver
+	currentValidating := desiredValidating.DeepCopy()
+	admissionregistrationdefaults.SetObjectDefaults_ValidatingWebhookConfiguration(currentValidating)
+	currentMutating := desiredMutating.DeepCopy()
+	admissionregistrationdefaults.SetObjectDefaults_MutatingWebhookConfiguration(currentMutating)
+
+	t.Run("up to date configurations are not updated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		validatingController := fake.NewMockNonNamespacedClientInterface[*v1.ValidatingWebhookConfiguration, *v1.ValidatingWebhookConfigurationList](ctrl)
+		validatingController.EXPECT().Get(webhookConfigName, gomock.Any()).Return(currentValidating.DeepCopy(), nil)
+		mutatingController := fake.NewMockNonNamespacedClientInterface[*v1.MutatingWebhookConfiguration, *v1.MutatingWebhookConfigurationList](ctrl)
+		mutatingController.EXPECT().Get(webhookConfigName, gomock.Any()).Return(currentMutating.DeepCopy(), nil)
+
+		handler := &secretHandler{validatingController: validatingController, mutatingController: mutatingController}
+		require.NoError(t, handler.ensureWebhookConfiguration(desiredValidating, desiredMutating))
+	})
+
+	t.Run("edited configurations are updated", func(t *testing.T) {
+		edited := currentValidating.DeepCopy()
+		edited.Webhooks[0].FailurePolicy = admission.Ptr(v1.Ignore)
+
+		ctrl := gomock.NewController(t)
+		validatingController := fake.NewMockNonNamespacedClientInterface[*v1.ValidatingWebhookConfiguration, *v1.ValidatingWebhookConfigurationList](ctrl)
+		validatingController.EXPECT().Get(webhookConfigName, gomock.Any()).Return(edited, nil)
+		validatingController.EXPECT().Update(gomock.Any()).DoAndReturn(func(obj *v1.ValidatingWebhookConfiguration) (*v1.ValidatingWebhookConfiguration, error) {
+			assert.Equal(t, desiredValidating.Webhooks, obj.Webhooks)
+			return obj, nil
+		})
+		mutatingController := fake.NewMockNonNamespacedClientInterface[*v1.MutatingWebhookConfiguration, *v1.MutatingWebhookConfigurationList](ctrl)
+		mutatingController.EXPECT().Get(webhookConfigName, gomock.Any()).Return(currentMutating.DeepCopy(), nil)
+
+		handler := &secretHandler{validatingController: validatingController, mutatingController: mutatingController}
+		require.NoError(t, handler.ensureWebhookConfiguration(desiredValidating, desiredMutating))
+	})
+}
+
+func TestSecretHandlerLeaderElection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	secrets := fake.NewMockControllerInterface[*corev1.Secret, *corev1.SecretList](ctrl)
+	// neither the validating nor the mutating controller is called by a replica that is not the leader
+	handler := &secretHandler{
+		errChecker: health.NewErrorChecker("Config Applied"),
+		secrets:    secrets,
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: caName, Namespace: namespace},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert")},
+	}
+
+	_, err := handler.sync(namespace+"/"+caName, secret)
+	require.NoError(t, err)
+	assert.NoError(t, handler.errChecker.Check(nil))
+
+	// edits are only re-applied by the leader
+	_, err = handler.syncValidatingConfiguration(webhookConfigName, nil)
+	require.NoError(t, err)
+
+	secrets.EXPECT().Enqueue(namespace, caName).Times(3)
+	handler.startedLeading()
+	_, err = handler.syncValidatingConfiguration(webhookConfigName, nil)
+	require.NoError(t, err)
+	_, err = handler.syncMutatingConfiguration(webhookConfigName, nil)
+	require.NoError(t, err)
+	// other configurations are ignored
+	_, err = handler.syncMutatingConfiguration("other", nil)
+	require.NoError(t, err)
+
+	handler.stoppedLeading()
+	_, err = handler.syncMutatingConfiguration(webhookConfigName, nil)
+	require.NoError(t, err)
+}
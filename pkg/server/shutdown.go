@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rancher/webhook/pkg/health"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// shutdownDelayEnvKey is the environment variable holding how long the webhook keeps serving requests after being
+	// marked as not ready, which gives the endpoints of the service time to stop routing requests to it.
+	shutdownDelayEnvKey = "CATTLE_WEBHOOK_SHUTDOWN_DELAY"
+	// drainTimeoutEnvKey is the environment variable holding how long the webhook waits for in-flight requests once it
+	// has stopped accepting connections.
+	drainTimeoutEnvKey = "CATTLE_WEBHOOK_DRAIN_TIMEOUT"
+
+	defaultShutdownDelay = 10 * time.Second
+	defaultDrainTimeout  = 15 * time.Second
+)
+
+var errShuttingDown = fmt.Errorf("shutting down")
+
+// drainer tracks the in-flight requests of the webhook so that they can be completed when shutting down.
+type drainer struct {
+	shutdownDelay time.Duration
+	drainTimeout  time.Duration
+	// readiness reports an error once the shutdown has started.
+	readiness *health.ErrorChecker
+
+	mutex     sync.Mutex
+	inFlight  int
+	draining  bool
+	drained   chan struct{}
+	drainOnce sync.Once
+}
+
+// newDrainerFromEnv returns a drainer configured through the shutdownDelayEnvKey and drainTimeoutEnvKey environment variables.
+func newDrainerFromEnv() (*drainer, error) {
+	shutdownDelay, err := durationFromEnv(shutdownDelayEnvKey, defaultShutdownDelay)
+	if err != nil {
+		return nil, err
+	}
+	drainTimeout, err := durationFromEnv(drainTimeoutEnvKey, defaultDrainTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newDrainer(shutdownDelay, drainTimeout), nil
+}
+
+func newDrainer(shutdownDelay, drainTimeout time.Duration) *drainer {
+	readiness := health.NewErrorChecker("Not Shutting Down")
+	readiness.Store(nil)
+	return &drainer{
+		shutdownDelay: shutdownDelay,
+		drainTimeout:  drainTimeout,
+		readiness:     readiness,
+		drained:       make(chan struct{}),
+	}
+}
+
+// track returns a middleware counting in-flight requests. The context of tracked requests is not canceled when the
+// server stops accepting connections, so that requests already being evaluated can complete while draining.
+func (d *drainer) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mutex.Lock()
+		d.inFlight++
+		d.mutex.Unlock()
+		defer d.done()
+		next.ServeHTTP(w, r.WithContext(context.WithoutCancel(r.Context())))
+	})
+}
+
+// done marks a request as completed.
+func (d *drainer) done() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.inFlight--
+	if d.draining && d.inFlight == 0 {
+		d.drainOnce.Do(func() { close(d.drained) })
+	}
+}
+
+// shutdown marks the webhook as not ready, waits for the shutdown delay, calls stopServer to stop accepting
+// connections and then waits for the in-flight requests to complete, or for the drain timeout to expire.
+func (d *drainer) shutdown(stopServer func()) error {
+	logrus.Infof("Shutting down: marking the webhook as not ready and waiting %s before closing the listener", d.shutdownDelay)
+	d.readiness.Store(errShuttingDown)
+	time.Sleep(d.shutdownDelay)
+
+	stopServer()
+
+	d.mutex.Lock()
+	d.draining = true
+	if d.inFlight == 0 {
+		d.drainOnce.Do(func() { close(d.drained) })
+	}
+	d.mutex.Unlock()
+
+	select {
+	case <-d.drained:
+		logrus.Info("All in-flight requests completed")
+		return nil
+	case <-time.After(d.drainTimeout):
+		return fmt.Errorf("in-flight requests did not complete within %s", d.drainTimeout)
+	}
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid value '%s' for %s: must be a non-negative duration such as 10s", value, key)
+	}
+	return duration, nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainerShutdown(t *testing.T) {
+	drainer := newDrainer(10*time.Millisecond, time.Second)
+	require.NoError(t, drainer.readiness.Check(nil))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := drainer.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		// the request context is not canceled when the server stops
+		assert.NoError(t, r.Context().Err())
+		w.WriteHeader(http.StatusOK)
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+
+	stopped := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		result <- drainer.shutdown(func() {
+			// readiness must fail before the server stops accepting connections
+			assert.ErrorIs(t, drainer.readiness.Check(nil), errShuttingDown)
+			close(stopped)
+		})
+	}()
+
+	<-stopped
+	select {
+	case err := <-result:
+		t.Fatalf("shutdown returned before the in-flight request completed: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-result)
+}
+
+func TestDrainerShutdownTimeout(t *testing.T) {
+	drainer := newDrainer(0, 10*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := drainer.track(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+
+	assert.Error(t, drainer.shutdown(func() {}))
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	t.Setenv(shutdownDelayEnvKey, "")
+	duration, err := durationFromEnv(shutdownDelayEnvKey, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, duration)
+
+	t.Setenv(shutdownDelayEnvKey, "500ms")
+	duration, err = durationFromEnv(shutdownDelayEnvKey, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, duration)
+
+	t.Setenv(shutdownDelayEnvKey, "-1s")
+	_, err = durationFromEnv(shutdownDelayEnvKey, time.Second)
+	assert.Error(t, err)
+}
+
+func TestIsHealthPath(t *testing.T) {
+	assert.True(t, isHealthPath("/healthz"))
+	assert.True(t, isHealthPath("/readyz"))
+	assert.True(t, isHealthPath("/readyz/Not Shutting Down"))
+	assert.True(t, isHealthPath("/livez"))
+	assert.False(t, isHealthPath("/readyzfoo"))
+	assert.False(t, isHealthPath("/v1/webhook/validation/settings.management.cattle.io"))
+}